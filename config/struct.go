@@ -1,6 +1,9 @@
 package config
 
 import (
+	"encoding/json"
+	"fmt"
+	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -36,30 +39,28 @@ func (cfg *Configuration) UnmarshalJSON(b []byte) error {
 
 // ConsumerConfiguration is the configuration of a consumer
 type ConsumerConfiguration struct {
-	rawConsumerConfiguration
-	Timeout time.Duration `json:"-"`
-}
-
-type rawConsumerConfiguration struct {
-	Type       string `json:"type"`
-	Server     string `json:"server"`
-	Port       int64  `json:"port"`
-	RawTimeout int64  `json:"timeout"`
-	Encryption int64  `json:"encryption"`
-	Key        string `json:"key"`
-	Instances  int64  `json:"instances"`
+	// Type is the name of the consumer that will run
+	Type string `json:"type"`
+	// Config is the custom configuration of the consumer: all keys of the consumer except type
+	Config map[string]interface{} `json:"-"`
 }
 
 // UnmarshalJSON explicits some variables from configuration file to proper Golang type
 func (cfg *ConsumerConfiguration) UnmarshalJSON(b []byte) error {
-	raw := &rawConsumerConfiguration{}
+	raw := make(map[string]interface{})
 
-	if err := UnmarshalConfig(b, raw); err != nil {
+	if err := UnmarshalConfig(b, &raw); err != nil {
 		return err
 	}
 
-	cfg.rawConsumerConfiguration = *raw
-	cfg.Timeout = time.Duration(raw.RawTimeout) * time.Millisecond
+	consumerType, ok := raw["type"].(string)
+	if !ok {
+		return fmt.Errorf("consumer: type is missing or is not a string")
+	}
+	delete(raw, "type")
+
+	cfg.Type = consumerType
+	cfg.Config = raw
 
 	return nil
 }
@@ -111,3 +112,192 @@ func (d *jsonDuration) UnmarshalJSON(b []byte) error {
 	*d = (jsonDuration)(duration)
 	return nil
 }
+
+// Percent is a percentage that can be written as a number or as a string suffixed by % in configuration file
+type Percent float64
+
+// UnmarshalJSON parses a percentage from configuration file
+func (p *Percent) UnmarshalJSON(b []byte) error {
+	str := strings.TrimSpace(strings.TrimSuffix(strings.Trim(string(b), `"`), "%"))
+	value, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return fmt.Errorf("invalid percentage %s", b)
+	}
+	if value < 0 || value > 100 {
+		return fmt.Errorf("percentage %s is out of range", b)
+	}
+
+	*p = Percent(value)
+	return nil
+}
+
+// sizeUnits are the multipliers of human-readable sizes, using binary prefixes as sauna does
+var sizeUnits = []string{"K", "M", "G", "T", "P", "E"}
+
+// Size is an amount of bytes that can be written in a human-readable form in configuration file, such as 512M or 2G
+type Size uint64
+
+// UnmarshalJSON parses a size from configuration file
+func (s *Size) UnmarshalJSON(b []byte) error {
+	str := strings.ToUpper(strings.TrimSpace(strings.Trim(string(b), `"`)))
+	str = strings.TrimSuffix(strings.TrimSuffix(str, "B"), "I")
+
+	multiplier := float64(1)
+	for i, unit := range sizeUnits {
+		if strings.HasSuffix(str, unit) {
+			str = strings.TrimSuffix(str, unit)
+			multiplier = float64(uint64(1) << (10 * uint(i+1)))
+			break
+		}
+	}
+
+	value, err := strconv.ParseFloat(strings.TrimSpace(str), 64)
+	if err != nil || value < 0 {
+		return fmt.Errorf("invalid size %s", b)
+	}
+
+	*s = Size(value * multiplier)
+	return nil
+}
+
+// String renders the size in a human-readable form
+func (s Size) String() string {
+	if s < 1024 {
+		return strconv.FormatUint(uint64(s), 10) + "B"
+	}
+
+	value := float64(s)
+	unit := ""
+	for _, u := range sizeUnits {
+		if value < 1024 {
+			break
+		}
+		value = value / 1024
+		unit = u
+	}
+	return strconv.FormatFloat(value, 'f', 1, 64) + unit
+}
+
+// secretEnvPrefix is the prefix of secrets read from an environment variable
+const secretEnvPrefix = "env:"
+
+// Secret is a sensitive string that can be read from an environment variable using env:VARIABLE_NAME syntax
+type Secret string
+
+// UnmarshalJSON reads the secret from configuration file or from the environment variable it refers to
+func (s *Secret) UnmarshalJSON(b []byte) error {
+	var value string
+	if err := json.Unmarshal(b, &value); err != nil {
+		return err
+	}
+
+	if strings.HasPrefix(value, secretEnvPrefix) {
+		name := strings.TrimPrefix(value, secretEnvPrefix)
+		envValue, ok := os.LookupEnv(name)
+		if !ok {
+			return fmt.Errorf("environment variable %q is not set", name)
+		}
+		value = envValue
+	}
+
+	*s = Secret(value)
+	return nil
+}
+
+// redactedSecret is displayed instead of secret values
+const redactedSecret = "<redacted>"
+
+// Redacted returns a placeholder to display instead of the secret, empty if the secret is empty
+func (s Secret) Redacted() Secret {
+	if s == "" {
+		return s
+	}
+	return redactedSecret
+}
+
+// RedactedSecrets returns a copy of secrets with values replaced by a placeholder
+func RedactedSecrets(secrets map[string]Secret) map[string]Secret {
+	if secrets == nil {
+		return nil
+	}
+	redacted := make(map[string]Secret, len(secrets))
+	for key, secret := range secrets {
+		redacted[key] = secret.Redacted()
+	}
+	return redacted
+}
+
+// Range is a Nagios threshold range: N means 0 to N, N: means N or more, ~:N means N or less, and N:M means N to M
+type Range struct {
+	// Min is the lower bound of the range, nil if unbounded
+	Min *float64
+	// Max is the upper bound of the range, nil if unbounded
+	Max *float64
+}
+
+// ParseRange parses a range written using Nagios format
+func ParseRange(str string) (Range, error) {
+	str = strings.TrimSpace(str)
+	bounds := strings.SplitN(str, ":", 2)
+	if len(bounds) == 1 {
+		bounds = []string{"0", bounds[0]}
+	}
+
+	var r Range
+	for i, bound := range bounds {
+		bound = strings.TrimSpace(bound)
+		if bound == "" || (i == 0 && bound == "~") {
+			continue
+		}
+		value, err := strconv.ParseFloat(bound, 64)
+		if err != nil {
+			return Range{}, fmt.Errorf("invalid range %q", str)
+		}
+		if i == 0 {
+			r.Min = &value
+		} else {
+			r.Max = &value
+		}
+	}
+
+	if r.Min == nil && r.Max == nil && str != "~:" {
+		return Range{}, fmt.Errorf("invalid range %q", str)
+	}
+	if r.Min != nil && r.Max != nil && *r.Min > *r.Max {
+		return Range{}, fmt.Errorf("invalid range %q: start is greater than end", str)
+	}
+	return r, nil
+}
+
+// UnmarshalJSON parses a range from configuration file, written as a number or as a string
+func (r *Range) UnmarshalJSON(b []byte) error {
+	parsed, err := ParseRange(strings.Trim(string(b), `"`))
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
+
+// Contains returns true if the value is inside the range
+func (r Range) Contains(value float64) bool {
+	return (r.Min == nil || value >= *r.Min) && (r.Max == nil || value <= *r.Max)
+}
+
+// String renders the range using Nagios format
+func (r Range) String() string {
+	var min, max string
+	if r.Min == nil {
+		min = "~"
+	} else if *r.Min != 0 || r.Max == nil {
+		min = strconv.FormatFloat(*r.Min, 'f', -1, 64)
+	}
+	if r.Max != nil {
+		max = strconv.FormatFloat(*r.Max, 'f', -1, 64)
+	}
+
+	if min == "" {
+		return max
+	}
+	return min + ":" + max
+}
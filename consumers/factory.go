@@ -0,0 +1,79 @@
+package consumers
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var consumerFactories = make(map[string]ConsumerFactory)
+var consumerValidators = make(map[string]ConfigValidator)
+var launchLog sync.Once
+
+// ErrUnknownConsumerType is the error returned when the factory can't create a consumer because type is not registered
+var ErrUnknownConsumerType = errors.New("Unknown consumer name")
+
+// ConsumerFactory is the function interface to creates a consumer instance
+type ConsumerFactory func(consumerCfg interface{}) (Consumer, error)
+
+// ConfigValidator is the function interface to check a consumer configuration without creating the consumer
+type ConfigValidator func(consumerCfg interface{}) error
+
+// Register will be use to register a new consumer from a name and a factory function
+func Register(name string, factory ConsumerFactory) {
+	if factory == nil {
+		log.Panicf("Consumer factory %s does not exist.", name)
+	}
+	_, registered := consumerFactories[name]
+	if registered {
+		log.Errorf("Consumer factory %s already registered. Ignoring.", name)
+	}
+	consumerFactories[name] = factory
+}
+
+// RegisterValidator registers the function checking the configuration of a consumer before it is created; consumers
+// without validator have their configuration checked on creation only
+func RegisterValidator(name string, validator ConfigValidator) {
+	if validator == nil {
+		log.Panicf("Consumer validator %s does not exist.", name)
+	}
+	consumerValidators[name] = validator
+}
+
+func getConsumersName() []string {
+	var keys []string
+	for key := range consumerFactories {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// CreateConsumer instantiates registered consumer into a single instance
+func CreateConsumer(name string, consumerCfg interface{}) (Consumer, error) {
+	launchLog.Do(func() {
+		log.Debugf("Availables consumers: %s", strings.Join(getConsumersName(), ", "))
+	})
+
+	factory, ok := consumerFactories[name]
+	if !ok {
+		return nil, ErrUnknownConsumerType
+	}
+
+	// Run the factory with the configuration.
+	return factory(consumerCfg)
+}
+
+// ValidateConsumer checks the configuration of a registered consumer without instantiating it
+func ValidateConsumer(name string, consumerCfg interface{}) error {
+	if _, ok := consumerFactories[name]; !ok {
+		return ErrUnknownConsumerType
+	}
+
+	validator, ok := consumerValidators[name]
+	if !ok {
+		return nil
+	}
+	return validator(consumerCfg)
+}
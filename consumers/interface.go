@@ -1,6 +1,8 @@
 package consumers
 
 import (
+	"time"
+
 	"github.com/rbeuque74/jagozzi/plugins"
 )
 
@@ -8,6 +10,10 @@ import (
 type ResultWithHostname struct {
 	plugins.Result
 	Hostname string
+	// Date is the time when the checker started to run
+	Date time.Time
+	// Duration is the time taken by the checker to run
+	Duration time.Duration
 }
 
 // Consumer is the interface that allow jagozzi to send plugins results
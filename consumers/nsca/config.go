@@ -0,0 +1,56 @@
+package nsca
+
+import (
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/rbeuque74/jagozzi/config"
+	validator "gopkg.in/go-playground/validator.v9"
+	defaults "gopkg.in/mcuadros/go-defaults.v1"
+)
+
+type nscaConfig struct {
+	rawNSCAConfig
+	Timeout time.Duration `json:"-"`
+}
+
+type rawNSCAConfig struct {
+	Server     string `json:"server" validate:"required"`
+	Port       int64  `json:"port" default:"5667"`
+	RawTimeout int64  `json:"timeout"`
+	Encryption int64  `json:"encryption"`
+	Key        string `json:"key"`
+	Instances  int64  `json:"instances" default:"1"`
+}
+
+func loadConfiguration(conf interface{}) (nscaConfig, error) {
+	cfg := nscaConfig{}
+
+	out, err := yaml.Marshal(conf)
+	if err != nil {
+		return cfg, err
+	}
+
+	err = yaml.Unmarshal(out, &cfg)
+	return cfg, err
+}
+
+func (cfg *nscaConfig) UnmarshalJSON(b []byte) error {
+	raw := &rawNSCAConfig{}
+
+	if err := config.UnmarshalConfig(b, raw); err != nil {
+		return err
+	}
+
+	defaults.SetDefaults(raw)
+
+	validate := validator.New()
+	if err := validate.Struct(raw); err != nil {
+		return err
+	}
+
+	cfg.rawNSCAConfig = *raw
+	cfg.Timeout = time.Duration(raw.RawTimeout) * time.Millisecond
+
+	return nil
+}
@@ -5,28 +5,43 @@ import (
 	"strings"
 	"time"
 
-	"github.com/rbeuque74/jagozzi/config"
 	"github.com/rbeuque74/jagozzi/consumers"
+	"github.com/rbeuque74/jagozzi/plugins"
 	"github.com/rbeuque74/nsca"
 	log "github.com/sirupsen/logrus"
 )
 
-var replacer = strings.NewReplacer(",", "", "\"", "")
+const consumerName = "NSCA"
+
+var replacer = strings.NewReplacer(",", "", "\"", "", "|", "")
+
+func init() {
+	consumers.Register(consumerName, New)
+	consumers.RegisterValidator(consumerName, validate)
+}
 
 // Consumer is the representation of a NSCA consumer
 type Consumer struct {
-	cfg      config.ConsumerConfiguration
+	cfg      nscaConfig
 	nscaMsg  chan *nsca.Message
 	exit     chan interface{}
 	messages chan consumers.ResultWithHostname
 	error    chan error
 }
 
+// validate checks the configuration of a consumer
+func validate(conf interface{}) error {
+	if _, err := loadConfiguration(conf); err != nil {
+		return fmt.Errorf("nsca/cfg: %s", err)
+	}
+	return nil
+}
+
 // New generates a new NSCA Consumer instance
-func New(cfg config.ConsumerConfiguration) Consumer {
-	if cfg.Port == 0 {
-		// default nsca port
-		cfg.Port = 5667
+func New(conf interface{}) (consumers.Consumer, error) {
+	cfg, err := loadConfiguration(conf)
+	if err != nil {
+		return nil, fmt.Errorf("nsca/cfg: %s", err)
 	}
 
 	nscaMessageChannel := make(chan *nsca.Message, 10)
@@ -49,13 +64,14 @@ func New(cfg config.ConsumerConfiguration) Consumer {
 	}
 
 	consumer := Consumer{
+		cfg:      cfg,
 		messages: messagesChannel,
 		error:    errorChannel,
 		exit:     exitChannel,
 		nscaMsg:  nscaMessageChannel,
 	}
 	go consumer.handle()
-	return consumer
+	return consumer, nil
 }
 
 // MessageChannel is the channel to be use to push messages to remote provider
@@ -73,6 +89,16 @@ func (consumer Consumer) ErrorChannel() <-chan error {
 	return consumer.error
 }
 
+// formatMessage renders result message, followed by its performance data if any
+func formatMessage(result consumers.ResultWithHostname) string {
+	message := replacer.Replace(result.Message)
+	if len(result.PerfData) == 0 {
+		return message
+	}
+	// performance data are rendered after message sanitization as their format relies on some stripped characters
+	return strings.TrimSpace(message) + " | " + plugins.FormatPerfData(result.PerfData)
+}
+
 func (consumer Consumer) handle() {
 	for {
 		select {
@@ -83,7 +109,7 @@ func (consumer Consumer) handle() {
 				State:   int16(result.Status),
 				Host:    result.Hostname,
 				Service: result.Checker.ServiceName(),
-				Message: replacer.Replace(result.Message),
+				Message: formatMessage(result),
 				Status:  consumer.error,
 			}
 			log.Debugf("consumer: send message %+v", *msg)
@@ -2,12 +2,9 @@ package nsca
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
 	"testing"
 	"time"
 
-	"github.com/rbeuque74/jagozzi/config"
 	"github.com/rbeuque74/jagozzi/consumers"
 	"github.com/rbeuque74/jagozzi/plugins"
 	"github.com/rbeuque74/nsca"
@@ -48,11 +45,17 @@ func TestConsumerSendMessage(t *testing.T) {
 	time.Sleep(20 * time.Millisecond)
 
 	// creating NSCA client
-	cfg := &config.ConsumerConfiguration{}
-	cfgStr := []byte(fmt.Sprintf(`{"type":"NSCA","server":"localhost","timeout":1000,"encryption":%d,"key":"%s"}`, nsca.ENCRYPT_XOR, EncryptKey))
-	json.Unmarshal(cfgStr, cfg)
+	cfg := map[string]interface{}{
+		"server":     "localhost",
+		"timeout":    1000,
+		"encryption": nsca.ENCRYPT_XOR,
+		"key":        EncryptKey,
+	}
 
-	consumer := New(*cfg)
+	consumer, err := New(cfg)
+	if err != nil {
+		t.Fatalf("nsca consumer instantiation failed: %q", err)
+	}
 
 	var messages []string
 
@@ -86,6 +89,27 @@ func TestConsumerSendMessage(t *testing.T) {
 		Hostname: "hostname-example-1",
 	}
 
+	message = "message, with \"perfdata\""
+	res = plugins.Result{
+		Status:  plugins.STATE_WARNING,
+		Message: message,
+		Checker: fakeChecker{
+			t: t,
+		},
+		PerfData: []plugins.PerfData{
+			plugins.NewPerfData("time", 0.25, "s").WithThresholds(0.2, 0.4).WithMin(0),
+			plugins.NewPerfData("response size", 1024, "B"),
+			plugins.NewPerfData("running", 1, "").WithLowerThresholds(2, 1).WithMin(0).WithMax(3),
+		},
+	}
+	messages = append(messages, "message with perfdata | time=0.25s;0.2;0.4;0 'response size'=1024B running=1;2:;1:;0;3")
+
+	consumer.MessageChannel() <- consumers.ResultWithHostname{
+		Result:   res,
+		Hostname: "hostname-example-1",
+	}
+
+	expectedMessages := len(messages)
 	messageReceived := 0
 	for {
 		select {
@@ -103,14 +127,14 @@ func TestConsumerSendMessage(t *testing.T) {
 				return
 			}
 
-			if messageReceived == 2 {
+			if messageReceived == expectedMessages {
 				close(consumer.ExitChannel())
 			} else {
 				messages = messages[1:]
 			}
 		case <-time.After(time.Second):
 			t.Log("timed out")
-			if messageReceived != 2 {
+			if messageReceived != expectedMessages {
 				t.Fatal("timeout and message not received")
 			}
 			return
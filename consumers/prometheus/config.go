@@ -0,0 +1,56 @@
+package prometheus
+
+import (
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/rbeuque74/jagozzi/config"
+	validator "gopkg.in/go-playground/validator.v9"
+	defaults "gopkg.in/mcuadros/go-defaults.v1"
+)
+
+type prometheusConfig struct {
+	rawPrometheusConfig
+}
+
+type rawPrometheusConfig struct {
+	Listen string `json:"listen" default:":9271"`
+	Path   string `json:"path" default:"/metrics" validate:"startswith=/"`
+	// Expiration is the duration in seconds after which results of a checker that stopped reporting are dropped;
+	// it must be greater than checks periodicity
+	Expiration int64 `json:"expiration" default:"900" validate:"gt=0"`
+}
+
+func loadConfiguration(conf interface{}) (prometheusConfig, error) {
+	cfg := prometheusConfig{}
+
+	out, err := yaml.Marshal(conf)
+	if err != nil {
+		return cfg, err
+	}
+
+	err = yaml.Unmarshal(out, &cfg)
+	return cfg, err
+}
+
+func (cfg prometheusConfig) expiration() time.Duration {
+	return time.Duration(cfg.Expiration) * time.Second
+}
+
+func (cfg *prometheusConfig) UnmarshalJSON(b []byte) error {
+	raw := &rawPrometheusConfig{}
+
+	if err := config.UnmarshalConfig(b, raw); err != nil {
+		return err
+	}
+
+	defaults.SetDefaults(raw)
+
+	validate := validator.New()
+	if err := validate.Struct(raw); err != nil {
+		return err
+	}
+
+	cfg.rawPrometheusConfig = *raw
+	return nil
+}
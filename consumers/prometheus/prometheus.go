@@ -0,0 +1,225 @@
+package prometheus
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rbeuque74/jagozzi/consumers"
+	"github.com/rbeuque74/jagozzi/plugins"
+	log "github.com/sirupsen/logrus"
+)
+
+const consumerName = "Prometheus"
+
+var labelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func init() {
+	consumers.Register(consumerName, New)
+	consumers.RegisterValidator(consumerName, validate)
+}
+
+// Consumer is a consumer that exposes checkers results as Prometheus metrics
+type Consumer struct {
+	cfg      prometheusConfig
+	exit     chan interface{}
+	messages chan consumers.ResultWithHostname
+	error    chan error
+	metrics  *metrics
+}
+
+// metrics is the store of all results received by the consumer
+type metrics struct {
+	sync.RWMutex
+	results map[string]consumers.ResultWithHostname
+	counts  map[string]map[plugins.StatusEnum]uint64
+	// updated is the reception time of the last result of each key, results not updated during expiration are
+	// dropped as their checker was most likely removed by a configuration reload
+	updated    map[string]time.Time
+	expiration time.Duration
+}
+
+// validate checks the configuration of a consumer
+func validate(conf interface{}) error {
+	if _, err := loadConfiguration(conf); err != nil {
+		return fmt.Errorf("prometheus/cfg: %s", err)
+	}
+	return nil
+}
+
+// New generates a new Prometheus Consumer instance
+func New(conf interface{}) (consumers.Consumer, error) {
+	cfg, err := loadConfiguration(conf)
+	if err != nil {
+		return nil, fmt.Errorf("prometheus/cfg: %s", err)
+	}
+
+	consumer := Consumer{
+		cfg:      cfg,
+		exit:     make(chan interface{}),
+		messages: make(chan consumers.ResultWithHostname, 100),
+		error:    make(chan error),
+		metrics: &metrics{
+			results:    make(map[string]consumers.ResultWithHostname),
+			counts:     make(map[string]map[plugins.StatusEnum]uint64),
+			updated:    make(map[string]time.Time),
+			expiration: cfg.expiration(),
+		},
+	}
+
+	// binding synchronously, so that an unavailable address fails the configuration loading
+	if err := attach(cfg.Listen, cfg.Path, consumer.metrics); err != nil {
+		return nil, fmt.Errorf("prometheus: %s", err)
+	}
+
+	log.Infof("consumer: starting Prometheus endpoint on http://%s%s", cfg.Listen, cfg.Path)
+	go consumer.handle()
+	return consumer, nil
+}
+
+// MessageChannel is the channel to be use to push messages to the metrics endpoint
+func (consumer Consumer) MessageChannel() chan<- consumers.ResultWithHostname {
+	return consumer.messages
+}
+
+// ExitChannel is the channel we need to close in order to shutdown the metrics endpoint
+func (consumer Consumer) ExitChannel() chan interface{} {
+	return consumer.exit
+}
+
+// ErrorChannel is the channel that returns errors of the metrics endpoint
+func (consumer Consumer) ErrorChannel() <-chan error {
+	return consumer.error
+}
+
+func (consumer Consumer) handle() {
+	for {
+		select {
+		case <-consumer.exit:
+			detach(consumer.cfg.Listen, consumer.cfg.Path, consumer.metrics)
+			return
+		case result := <-consumer.messages:
+			consumer.metrics.add(result)
+		}
+	}
+}
+
+func generateMapKey(result consumers.ResultWithHostname) string {
+	return fmt.Sprintf("%s#%s", result.Hostname, result.Checker.ServiceName())
+}
+
+func (m *metrics) add(result consumers.ResultWithHostname) {
+	m.Lock()
+	defer m.Unlock()
+
+	key := generateMapKey(result)
+	m.results[key] = result
+	m.updated[key] = time.Now()
+	if _, ok := m.counts[key]; !ok {
+		m.counts[key] = make(map[plugins.StatusEnum]uint64)
+	}
+	m.counts[key][result.Status]++
+}
+
+// expire drops the results that were not updated during expiration
+func (m *metrics) expire(now time.Time) {
+	m.Lock()
+	defer m.Unlock()
+
+	for key, updated := range m.updated {
+		if now.Sub(updated) > m.expiration {
+			delete(m.results, key)
+			delete(m.counts, key)
+			delete(m.updated, key)
+		}
+	}
+}
+
+// ServeHTTP renders all results using Prometheus text exposition format
+func (m *metrics) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	m.expire(time.Now())
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if _, err := w.Write(m.render()); err != nil {
+		log.Debugf("consumer: unable to write Prometheus metrics: %s", err)
+	}
+}
+
+func (m *metrics) render() []byte {
+	m.RLock()
+	defer m.RUnlock()
+
+	keys := make([]string, 0, len(m.results))
+	for key := range m.results {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	buf := new(bytes.Buffer)
+
+	writeHeader(buf, "jagozzi_check_status", "gauge", "Status of the last check run (0: OK, 1: WARNING, 2: CRITICAL, 3: UNKNOWN)")
+	for _, key := range keys {
+		result := m.results[key]
+		fmt.Fprintf(buf, "jagozzi_check_status{%s} %d\n", labels(result), result.Status)
+	}
+
+	writeHeader(buf, "jagozzi_check_last_run_timestamp_seconds", "gauge", "Unix timestamp of the last check run")
+	for _, key := range keys {
+		result := m.results[key]
+		fmt.Fprintf(buf, "jagozzi_check_last_run_timestamp_seconds{%s} %g\n", labels(result), float64(result.Date.UnixNano())/1e9)
+	}
+
+	writeHeader(buf, "jagozzi_check_duration_seconds", "gauge", "Duration of the last check run")
+	for _, key := range keys {
+		result := m.results[key]
+		fmt.Fprintf(buf, "jagozzi_check_duration_seconds{%s} %g\n", labels(result), result.Duration.Seconds())
+	}
+
+	writeHeader(buf, "jagozzi_check_perfdata", "gauge", "Performance data reported by the last check run")
+	for _, key := range keys {
+		result := m.results[key]
+		for _, perfdata := range result.PerfData {
+			fmt.Fprintf(buf, "jagozzi_check_perfdata{%s,label=\"%s\",unit=\"%s\"} %g\n", labels(result), labelReplacer.Replace(perfdata.Label), labelReplacer.Replace(perfdata.Unit), perfdata.Value)
+		}
+	}
+
+	writeHeader(buf, "jagozzi_check_results_total", "counter", "Number of check results per state")
+	for _, key := range keys {
+		result := m.results[key]
+		for _, state := range []plugins.StatusEnum{plugins.STATE_OK, plugins.STATE_WARNING, plugins.STATE_CRITICAL, plugins.STATE_UNKNOWN} {
+			fmt.Fprintf(buf, "jagozzi_check_results_total{%s,state=%q} %d\n", labels(result), stateLabel(state), m.counts[key][state])
+		}
+	}
+
+	return buf.Bytes()
+}
+
+func writeHeader(buf *bytes.Buffer, name, kind, help string) {
+	fmt.Fprintf(buf, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(buf, "# TYPE %s %s\n", name, kind)
+}
+
+func labels(result consumers.ResultWithHostname) string {
+	return fmt.Sprintf(`hostname="%s",service="%s",checker="%s"`,
+		labelReplacer.Replace(result.Hostname),
+		labelReplacer.Replace(result.Checker.ServiceName()),
+		labelReplacer.Replace(result.Checker.Name()),
+	)
+}
+
+func stateLabel(state plugins.StatusEnum) string {
+	switch state {
+	case plugins.STATE_OK:
+		return "ok"
+	case plugins.STATE_WARNING:
+		return "warning"
+	case plugins.STATE_CRITICAL:
+		return "critical"
+	default:
+		return "unknown"
+	}
+}
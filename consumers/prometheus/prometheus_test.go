@@ -0,0 +1,182 @@
+package prometheus
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rbeuque74/jagozzi/consumers"
+	"github.com/rbeuque74/jagozzi/plugins"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeChecker struct {
+	t *testing.T
+}
+
+func (fc fakeChecker) Name() string {
+	return "fake-checker"
+}
+
+func (fc fakeChecker) ServiceName() string {
+	return "fake-service-name"
+}
+
+func (fc fakeChecker) Periodicity() *time.Duration {
+	return nil
+}
+
+func (fc fakeChecker) Run(ctx context.Context) plugins.Result {
+	fc.t.Fatal("fake checker should not run")
+	return plugins.Result{
+		Status:  plugins.STATE_CRITICAL,
+		Message: "fake checker should never run",
+		Checker: fc,
+	}
+}
+
+func fetchMetrics(t *testing.T, url string, expected string) string {
+	var body string
+	for i := 0; i < 50; i++ {
+		resp, err := http.Get(url)
+		if err == nil {
+			b, err := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			assert.Nil(t, err)
+			assert.Equal(t, 200, resp.StatusCode)
+			body = string(b)
+			if strings.Contains(body, expected) {
+				return body
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("metrics %q not found in %q", expected, body)
+	return body
+}
+
+func TestConsumerExposeMetrics(t *testing.T) {
+	cfg := map[string]interface{}{
+		"listen": "127.0.0.1:19271",
+	}
+
+	consumer, err := New(cfg)
+	assert.Nilf(t, err, "prometheus consumer instantiation failed: %q", err)
+	defer close(consumer.ExitChannel())
+
+	date := time.Unix(1500000000, 0)
+	consumer.MessageChannel() <- consumers.ResultWithHostname{
+		Result: plugins.Result{
+			Status:  plugins.STATE_WARNING,
+			Message: "example message",
+			Checker: fakeChecker{t: t},
+		},
+		Hostname: "hostname-example-1",
+		Date:     date,
+		Duration: 1500 * time.Millisecond,
+	}
+
+	labels := `hostname="hostname-example-1",service="fake-service-name",checker="fake-checker"`
+	body := fetchMetrics(t, "http://127.0.0.1:19271/metrics", "jagozzi_check_status{"+labels+"} 1\n")
+	assert.Contains(t, body, "# TYPE jagozzi_check_status gauge\n")
+	assert.Contains(t, body, "jagozzi_check_last_run_timestamp_seconds{"+labels+"} 1.5e+09\n")
+	assert.Contains(t, body, "jagozzi_check_duration_seconds{"+labels+"} 1.5\n")
+	assert.Contains(t, body, "jagozzi_check_results_total{"+labels+`,state="warning"} 1`+"\n")
+	assert.Contains(t, body, "jagozzi_check_results_total{"+labels+`,state="ok"} 0`+"\n")
+
+	consumer.MessageChannel() <- consumers.ResultWithHostname{
+		Result: plugins.Result{
+			Status:   plugins.STATE_OK,
+			Message:  "example message",
+			Checker:  fakeChecker{t: t},
+			PerfData: []plugins.PerfData{plugins.NewPerfData("time", 0.25, "s")},
+		},
+		Hostname: "hostname-example-1",
+		Date:     date.Add(time.Minute),
+		Duration: 20 * time.Millisecond,
+	}
+
+	body = fetchMetrics(t, "http://127.0.0.1:19271/metrics", "jagozzi_check_status{"+labels+"} 0\n")
+	assert.Contains(t, body, "jagozzi_check_duration_seconds{"+labels+"} 0.02\n")
+	assert.Contains(t, body, "jagozzi_check_perfdata{"+labels+`,label="time",unit="s"} 0.25`+"\n")
+	assert.Contains(t, body, "jagozzi_check_results_total{"+labels+`,state="warning"} 1`+"\n")
+	assert.Contains(t, body, "jagozzi_check_results_total{"+labels+`,state="ok"} 1`+"\n")
+}
+
+func TestConsumerAddressInUse(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+
+	cfg := map[string]interface{}{
+		"listen": listener.Addr().String(),
+	}
+	_, err = New(cfg)
+	assert.NotNil(t, err, "binding an address already in use should fail")
+}
+
+func TestConsumerSharedAddress(t *testing.T) {
+	cfg := map[string]interface{}{
+		"listen": "127.0.0.1:19272",
+	}
+	consumer, err := New(cfg)
+	assert.Nilf(t, err, "prometheus consumer instantiation failed: %q", err)
+
+	// consumer replacing the first one on the same address, as done by a configuration reload
+	cfg["path"] = "/other"
+	replacement, err := New(cfg)
+	assert.Nilf(t, err, "prometheus consumer instantiation failed: %q", err)
+	defer close(replacement.ExitChannel())
+
+	replacement.MessageChannel() <- consumers.ResultWithHostname{
+		Result: plugins.Result{
+			Status:  plugins.STATE_OK,
+			Message: "example message",
+			Checker: fakeChecker{t: t},
+		},
+		Hostname: "hostname-example-1",
+		Date:     time.Now(),
+	}
+	fetchMetrics(t, "http://127.0.0.1:19272/other", "jagozzi_check_status{")
+
+	close(consumer.ExitChannel())
+	for i := 0; i < 50; i++ {
+		resp, err := http.Get("http://127.0.0.1:19272/metrics")
+		assert.Nil(t, err)
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	fetchMetrics(t, "http://127.0.0.1:19272/other", "jagozzi_check_status{")
+}
+
+func TestMetricsExpire(t *testing.T) {
+	m := &metrics{
+		results:    make(map[string]consumers.ResultWithHostname),
+		counts:     make(map[string]map[plugins.StatusEnum]uint64),
+		updated:    make(map[string]time.Time),
+		expiration: time.Minute,
+	}
+	m.add(consumers.ResultWithHostname{
+		Result: plugins.Result{
+			Status:  plugins.STATE_OK,
+			Message: "example message",
+			Checker: fakeChecker{t: t},
+		},
+		Hostname: "hostname-example-1",
+		Date:     time.Now(),
+	})
+
+	m.expire(time.Now())
+	assert.Contains(t, string(m.render()), "jagozzi_check_status{")
+
+	m.expire(time.Now().Add(2 * time.Minute))
+	assert.NotContains(t, string(m.render()), "jagozzi_check_status{")
+	assert.Len(t, m.counts, 0)
+}
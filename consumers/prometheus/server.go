@@ -0,0 +1,109 @@
+package prometheus
+
+import (
+	"net"
+	"net/http"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// servers are the HTTP servers of Prometheus endpoints by listen address; consumers listening on the same address
+// share the server, so that a consumer replaced by a configuration reload doesn't hold the address of its replacement
+var (
+	servers      = make(map[string]*server)
+	serversMutex sync.Mutex
+)
+
+// server is a HTTP server exposing the metrics of the consumers attached to it
+type server struct {
+	http *http.Server
+	// handlers are the metrics exposed by path; the last attached metrics of a path are served
+	handlers map[string][]*metrics
+	mutex    sync.RWMutex
+}
+
+// attach exposes metrics on the address and path, binding the address if no consumer listens on it yet
+func attach(address, path string, m *metrics) error {
+	serversMutex.Lock()
+	defer serversMutex.Unlock()
+
+	s, ok := servers[address]
+	if !ok {
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			return err
+		}
+
+		s = &server{handlers: make(map[string][]*metrics)}
+		s.http = &http.Server{
+			Addr:    address,
+			Handler: s,
+		}
+		servers[address] = s
+		go s.serve(listener)
+	}
+
+	s.mutex.Lock()
+	s.handlers[path] = append(s.handlers[path], m)
+	s.mutex.Unlock()
+	return nil
+}
+
+// detach stops exposing metrics, closing the server when no consumer uses it anymore
+func detach(address, path string, m *metrics) {
+	serversMutex.Lock()
+	defer serversMutex.Unlock()
+
+	s, ok := servers[address]
+	if !ok {
+		return
+	}
+
+	s.mutex.Lock()
+	handlers := s.handlers[path][:0]
+	for _, handler := range s.handlers[path] {
+		if handler != m {
+			handlers = append(handlers, handler)
+		}
+	}
+	if len(handlers) == 0 {
+		delete(s.handlers, path)
+	} else {
+		s.handlers[path] = handlers
+	}
+	empty := len(s.handlers) == 0
+	s.mutex.Unlock()
+
+	if !empty {
+		return
+	}
+	delete(servers, address)
+	if err := s.http.Close(); err != nil {
+		log.Warnf("consumer: unable to close Prometheus endpoint: %s", err)
+	}
+}
+
+func (s *server) serve(listener net.Listener) {
+	err := s.http.Serve(listener)
+	if err != nil && err != http.ErrServerClosed {
+		log.Errorf("consumer: Prometheus endpoint on %s stopped: %s", s.http.Addr, err)
+	}
+}
+
+// ServeHTTP renders the metrics attached to the requested path
+func (s *server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.mutex.RLock()
+	handlers := s.handlers[req.URL.Path]
+	var m *metrics
+	if len(handlers) != 0 {
+		m = handlers[len(handlers)-1]
+	}
+	s.mutex.RUnlock()
+
+	if m == nil {
+		http.NotFound(w, req)
+		return
+	}
+	m.ServeHTTP(w, req)
+}
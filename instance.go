@@ -1,48 +1,127 @@
 package main
 
 import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
 	"github.com/rbeuque74/jagozzi/config"
 	"github.com/rbeuque74/jagozzi/consumers"
 	"github.com/rbeuque74/jagozzi/consumers/gui"
-	"github.com/rbeuque74/jagozzi/consumers/nsca"
 	"github.com/rbeuque74/jagozzi/plugins"
 	log "github.com/sirupsen/logrus"
 )
 
+const guiConsumerKey = "display"
+
 // Jagozzi is an instance of jagozzi checker
 type Jagozzi struct {
 	cfg       config.Configuration
-	checkers  []plugins.Checker
-	consumers []consumers.Consumer
+	checkers  []loadedChecker
+	consumers []loadedConsumer
+	loops     map[time.Duration]checkerLoop
+	mutex     sync.RWMutex
+}
+
+// loadedChecker is a checker instance along with the key of the configuration it was created from
+type loadedChecker struct {
+	plugins.Checker
+	key string
+}
+
+// loadedConsumer is a consumer instance along with the key of the configuration it was created from
+type loadedConsumer struct {
+	consumers.Consumer
+	key string
+}
+
+// checkerLoop is a running periodicity loop of the main loop
+type checkerLoop struct {
+	key    string
+	cancel func()
 }
 
 // Load is loading configuration from file and returns a jagozzi configuration
-// nolint: gocyclo
 func Load(cfg config.Configuration) (*Jagozzi, error) {
-	y := Jagozzi{
-		cfg: cfg,
+	y := &Jagozzi{
+		cfg:   cfg,
+		loops: make(map[time.Duration]checkerLoop),
 	}
 
-	// Consumers initialisation
-	for _, consumer := range y.cfg.Consumers {
-		if consumer.Type != "NSCA" {
-			log.Warnf("config: found an unknown consumer type %q", consumer.Type)
-			continue
-		}
+	checkers, err := y.loadCheckers(cfg)
+	if err != nil {
+		return nil, err
+	}
+	y.checkers = checkers
 
-		consumerInstance := nsca.New(consumer)
-		y.consumers = append(y.consumers, consumerInstance)
-		go ListenForConsumersError(consumerInstance)
+	_, pending, _, err := y.matchConsumers(cfg)
+	if err != nil {
+		return nil, err
+	}
+	y.consumers, err = createConsumers(pending)
+	if err != nil {
+		return nil, err
 	}
 
-	if guiConsumer != nil && *guiConsumer {
-		consumer := gui.New()
-		y.consumers = append(y.consumers, consumer)
+	return y, nil
+}
+
+// Reload applies a new configuration on a running instance; checkers and consumers that did not change are kept as is.
+// If the new configuration can't be loaded, an error is returned and the current configuration is left untouched.
+func (y *Jagozzi) Reload(cfg config.Configuration) error {
+	checkers, err := y.loadCheckers(cfg)
+	if err != nil {
+		return err
+	}
+	reused, pending, removed, err := y.matchConsumers(cfg)
+	if err != nil {
+		return err
+	}
+	if err := validateConsumers(pending); err != nil {
+		return err
+	}
+
+	// current consumers keep running while new ones are created, they are stopped only once the new
+	// configuration is fully loaded
+	created, err := createConsumers(pending)
+	if err != nil {
+		return err
+	}
+
+	y.mutex.Lock()
+	y.cfg = cfg
+	y.checkers = checkers
+	y.consumers = append(reused, created...)
+	y.mutex.Unlock()
+
+	for _, consumer := range removed {
+		close(consumer.ExitChannel())
+	}
+	return nil
+}
+
+// loadCheckers creates checkers from configuration, reusing current checkers when their configuration is unchanged
+func (y *Jagozzi) loadCheckers(cfg config.Configuration) ([]loadedChecker, error) {
+	existing := make(map[string][]plugins.Checker)
+	for _, checker := range y.checkers {
+		existing[checker.key] = append(existing[checker.key], checker.Checker)
 	}
 
-	// Pluggins initialisation
-	for _, plugin := range y.cfg.Plugins {
+	var checkers []loadedChecker
+	for _, plugin := range cfg.Plugins {
 		for _, check := range plugin.Checks {
+			key, err := configurationKey(plugin.Type, plugin.Config, check)
+			if err != nil {
+				return nil, err
+			}
+
+			if instances := existing[key]; len(instances) != 0 {
+				checkers = append(checkers, loadedChecker{Checker: instances[0], key: key})
+				existing[key] = instances[1:]
+				continue
+			}
+
 			checker, err := plugins.CreateChecker(plugin.Type, check, plugin.Config)
 			if err != nil && err == plugins.ErrUnknownCheckerType {
 				log.WithField("type", plugin.Type).Warn(err)
@@ -51,33 +130,164 @@ func Load(cfg config.Configuration) (*Jagozzi, error) {
 				return nil, err
 			}
 
-			y.checkers = append(y.checkers, checker)
+			checkers = append(checkers, loadedChecker{Checker: checker, key: key})
+		}
+	}
+
+	return checkers, nil
+}
+
+// pendingConsumer is a consumer of the configuration that has no current instance to reuse
+type pendingConsumer struct {
+	key string
+	cfg *config.ConsumerConfiguration
+}
+
+// matchConsumers matches the configuration against current consumers: consumers with an unchanged configuration are
+// returned as first value, consumers to create as second value and current consumers that are not part of the
+// configuration anymore as third value
+func (y *Jagozzi) matchConsumers(cfg config.Configuration) ([]loadedConsumer, []pendingConsumer, []loadedConsumer, error) {
+	existing := make(map[string][]loadedConsumer)
+	for _, consumer := range y.consumers {
+		existing[consumer.key] = append(existing[consumer.key], consumer)
+	}
+
+	var reused []loadedConsumer
+	var pending []pendingConsumer
+	match := func(key string, consumerCfg *config.ConsumerConfiguration) {
+		if instances := existing[key]; len(instances) != 0 {
+			reused = append(reused, instances[0])
+			existing[key] = instances[1:]
+			return
+		}
+		pending = append(pending, pendingConsumer{key: key, cfg: consumerCfg})
+	}
+
+	for i := range cfg.Consumers {
+		key, err := configurationKey(cfg.Consumers[i].Type, cfg.Consumers[i].Config)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		match(key, &cfg.Consumers[i])
+	}
+
+	if guiConsumer != nil && *guiConsumer {
+		match(guiConsumerKey, nil)
+	}
+
+	var removed []loadedConsumer
+	for _, instances := range existing {
+		removed = append(removed, instances...)
+	}
+
+	return reused, pending, removed, nil
+}
+
+// validateConsumers checks the configuration of the consumers to create, before creating any of them
+func validateConsumers(pending []pendingConsumer) error {
+	for _, consumer := range pending {
+		if consumer.cfg == nil {
+			continue
+		}
+		err := consumers.ValidateConsumer(consumer.cfg.Type, consumer.cfg.Config)
+		if err != nil && err != consumers.ErrUnknownConsumerType {
+			return err
+		}
+	}
+	return nil
+}
+
+// createConsumers creates the consumers that have no current instance; on error, consumers already created are closed
+func createConsumers(pending []pendingConsumer) ([]loadedConsumer, error) {
+	var created []loadedConsumer
+	for _, consumer := range pending {
+		if consumer.cfg == nil {
+			created = append(created, loadedConsumer{Consumer: gui.New(), key: consumer.key})
+			continue
+		}
+
+		consumerInstance, err := consumers.CreateConsumer(consumer.cfg.Type, consumer.cfg.Config)
+		if err != nil && err == consumers.ErrUnknownConsumerType {
+			log.Warnf("config: found an unknown consumer type %q", consumer.cfg.Type)
+			continue
+		} else if err != nil {
+			// new consumers are not used by anyone yet, they have to be cleaned
+			for _, instance := range created {
+				close(instance.ExitChannel())
+			}
+			return nil, err
 		}
+
+		created = append(created, loadedConsumer{Consumer: consumerInstance, key: consumer.key})
+		go ListenForConsumersError(consumerInstance)
 	}
 
-	return &y, nil
+	return created, nil
+}
+
+// configurationKey generates an unique identifier for a set of configuration values
+func configurationKey(values ...interface{}) (string, error) {
+	b, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
 }
 
 // Unload cleans all current operation/goroutine loaded by configuration and configuration childs
-func (y Jagozzi) Unload() {
+func (y *Jagozzi) Unload() {
+	y.mutex.Lock()
+	defer y.mutex.Unlock()
+
 	for _, consumer := range y.consumers {
 		close(consumer.ExitChannel())
 	}
+	y.consumers = nil
 }
 
 // SendConsumers will send a NSCA message to all consumers
-func (y Jagozzi) SendConsumers(result plugins.Result) {
-	for _, consumer := range y.consumers {
-		consumer.MessageChannel() <- consumers.ResultWithHostname{
-			Result:   result,
-			Hostname: y.cfg.Hostname,
+func (y *Jagozzi) SendConsumers(result plugins.Result, date time.Time, duration time.Duration) {
+	// sending without holding the lock, so that a slow consumer doesn't block configuration reloads
+	y.mutex.RLock()
+	loadedConsumers := make([]loadedConsumer, len(y.consumers))
+	copy(loadedConsumers, y.consumers)
+	hostname := y.cfg.Hostname
+	y.mutex.RUnlock()
+
+	message := consumers.ResultWithHostname{
+		Result:   result,
+		Hostname: hostname,
+		Date:     date,
+		Duration: duration,
+	}
+	for _, consumer := range loadedConsumers {
+		// consumer may have been stopped by a reload in the meantime
+		select {
+		case consumer.MessageChannel() <- message:
+		case <-consumer.ExitChannel():
 		}
 	}
 }
 
 // Checkers returns the list of checkers
-func (y Jagozzi) Checkers() []plugins.Checker {
-	return y.checkers
+func (y *Jagozzi) Checkers() []plugins.Checker {
+	y.mutex.RLock()
+	defer y.mutex.RUnlock()
+
+	checkers := make([]plugins.Checker, 0, len(y.checkers))
+	for _, checker := range y.checkers {
+		checkers = append(checkers, checker.Checker)
+	}
+	return checkers
+}
+
+// checkersKey generates an unique identifier for a list of checkers
+func checkersKey(checkers []loadedChecker) string {
+	keys := make([]string, 0, len(checkers))
+	for _, checker := range checkers {
+		keys = append(keys, checker.key)
+	}
+	return strings.Join(keys, "\n")
 }
 
 // ListenForConsumersError will log every consumers errors that fails to be reported to remote notification service
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rbeuque74/jagozzi/config"
+	"github.com/rbeuque74/jagozzi/consumers"
+	"github.com/rbeuque74/jagozzi/plugins"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	fakeConsumerType = "Fake"
+	fakeCheckerType  = "Fake"
+)
+
+func init() {
+	consumers.Register(fakeConsumerType, newFakeConsumer)
+	consumers.RegisterValidator(fakeConsumerType, func(conf interface{}) error {
+		if _, invalid := conf.(map[string]interface{})["invalid"]; invalid {
+			return errors.New("fake: invalid configuration")
+		}
+		return nil
+	})
+	plugins.Register(fakeCheckerType, newFakeChecker)
+}
+
+// fakeConsumer is a consumer failing on creation when its configuration has a fail key
+type fakeConsumer struct {
+	messages chan consumers.ResultWithHostname
+	exit     chan interface{}
+}
+
+func newFakeConsumer(conf interface{}) (consumers.Consumer, error) {
+	if _, fail := conf.(map[string]interface{})["fail"]; fail {
+		return nil, errors.New("fake: unable to start")
+	}
+	return fakeConsumer{
+		messages: make(chan consumers.ResultWithHostname, 10),
+		exit:     make(chan interface{}),
+	}, nil
+}
+
+func (c fakeConsumer) MessageChannel() chan<- consumers.ResultWithHostname {
+	return c.messages
+}
+
+func (c fakeConsumer) ExitChannel() chan interface{} {
+	return c.exit
+}
+
+func (c fakeConsumer) ErrorChannel() <-chan error {
+	return nil
+}
+
+// fakeChecker is a checker failing on creation when its configuration has a fail key
+type fakeChecker struct {
+	name string
+}
+
+func newFakeChecker(checkerCfg interface{}, pluginCfg interface{}) (plugins.Checker, error) {
+	cfg := checkerCfg.(map[string]interface{})
+	if _, fail := cfg["fail"]; fail {
+		return nil, errors.New("fake: invalid checker")
+	}
+	return &fakeChecker{name: cfg["name"].(string)}, nil
+}
+
+func (c *fakeChecker) Name() string {
+	return fakeCheckerType
+}
+
+func (c *fakeChecker) ServiceName() string {
+	return c.name
+}
+
+func (c *fakeChecker) Periodicity() *time.Duration {
+	return nil
+}
+
+func (c *fakeChecker) Run(ctx context.Context) plugins.Result {
+	return plugins.Result{Status: plugins.STATE_OK, Message: "OK", Checker: c}
+}
+
+func fakeConfiguration(consumerCfgs []map[string]interface{}, checks ...interface{}) config.Configuration {
+	cfg := config.Configuration{}
+	cfg.Hostname = "hostname-example-1"
+	for _, consumerCfg := range consumerCfgs {
+		cfg.Consumers = append(cfg.Consumers, config.ConsumerConfiguration{Type: fakeConsumerType, Config: consumerCfg})
+	}
+	cfg.Plugins = []config.PluginConfiguration{{Type: fakeCheckerType, Checks: checks}}
+	return cfg
+}
+
+// isClosed returns true if the exit channel of consumer is closed
+func isClosed(consumer consumers.Consumer) bool {
+	select {
+	case <-consumer.ExitChannel():
+		return true
+	default:
+		return false
+	}
+}
+
+func TestLoadCheckers(t *testing.T) {
+	y, err := Load(fakeConfiguration(nil, map[string]interface{}{"name": "check-1"}, map[string]interface{}{"name": "check-2"}))
+	assert.Nil(t, err)
+	defer y.Unload()
+	previous := y.Checkers()
+
+	checkers, err := y.loadCheckers(fakeConfiguration(nil, map[string]interface{}{"name": "check-2"}, map[string]interface{}{"name": "check-3"}))
+	assert.Nil(t, err)
+	if assert.Len(t, checkers, 2) {
+		assert.True(t, checkers[0].Checker == previous[1], "unchanged checker should be reused")
+		assert.Equal(t, "check-3", checkers[1].ServiceName())
+	}
+
+	_, err = y.loadCheckers(fakeConfiguration(nil, map[string]interface{}{"name": "check-2"}, map[string]interface{}{"fail": true}))
+	assert.NotNil(t, err)
+}
+
+func TestMatchConsumers(t *testing.T) {
+	y, err := Load(fakeConfiguration([]map[string]interface{}{{"id": 1}, {"id": 2}}))
+	assert.Nil(t, err)
+	defer y.Unload()
+	previous := y.consumers
+
+	reused, pending, removed, err := y.matchConsumers(fakeConfiguration([]map[string]interface{}{{"id": 2}, {"id": 3}}))
+	assert.Nil(t, err)
+	if assert.Len(t, reused, 1) {
+		assert.Equal(t, previous[1], reused[0])
+	}
+	if assert.Len(t, pending, 1) {
+		assert.Equal(t, map[string]interface{}{"id": 3}, pending[0].cfg.Config)
+	}
+	if assert.Len(t, removed, 1) {
+		assert.Equal(t, previous[0], removed[0])
+	}
+}
+
+func TestReload(t *testing.T) {
+	y, err := Load(fakeConfiguration([]map[string]interface{}{{"id": 1}, {"id": 2}}, map[string]interface{}{"name": "check-1"}))
+	assert.Nil(t, err)
+	defer y.Unload()
+	previous := y.consumers
+
+	err = y.Reload(fakeConfiguration([]map[string]interface{}{{"id": 2}, {"id": 3}}, map[string]interface{}{"name": "check-2"}))
+	assert.Nil(t, err)
+	if assert.Len(t, y.consumers, 2) {
+		assert.Equal(t, previous[1], y.consumers[0])
+		assert.False(t, isClosed(y.consumers[0]))
+		assert.False(t, isClosed(y.consumers[1]))
+	}
+	assert.True(t, isClosed(previous[0]), "removed consumer should be stopped")
+	if assert.Len(t, y.Checkers(), 1) {
+		assert.Equal(t, "check-2", y.Checkers()[0].ServiceName())
+	}
+}
+
+func TestReloadFailure(t *testing.T) {
+	cfg := fakeConfiguration([]map[string]interface{}{{"id": 1}, {"id": 2}}, map[string]interface{}{"name": "check-1"})
+	y, err := Load(cfg)
+	assert.Nil(t, err)
+	defer y.Unload()
+	previous := y.consumers
+
+	// invalid consumer configuration
+	err = y.Reload(fakeConfiguration([]map[string]interface{}{{"id": 2}, {"id": 3, "invalid": true}}))
+	assert.NotNil(t, err)
+
+	// consumer failing to start, after another new consumer was created
+	err = y.Reload(fakeConfiguration([]map[string]interface{}{{"id": 3}, {"id": 4, "fail": true}}))
+	assert.NotNil(t, err)
+
+	// invalid checker
+	err = y.Reload(fakeConfiguration([]map[string]interface{}{{"id": 3}}, map[string]interface{}{"fail": true}))
+	assert.NotNil(t, err)
+
+	assert.Equal(t, cfg, y.cfg)
+	assert.Equal(t, previous, y.consumers)
+	for _, consumer := range previous {
+		assert.False(t, isClosed(consumer), "current consumer should keep running")
+	}
+	if assert.Len(t, y.Checkers(), 1) {
+		assert.Equal(t, "check-1", y.Checkers()[0].ServiceName())
+	}
+
+	// results still reach current consumers
+	y.SendConsumers(plugins.Result{Status: plugins.STATE_OK, Message: "OK"}, time.Now(), time.Second)
+	for _, consumer := range previous {
+		assert.Len(t, consumer.Consumer.(fakeConsumer).messages, 1)
+	}
+}
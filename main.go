@@ -8,13 +8,20 @@ import (
 	"time"
 
 	"github.com/rbeuque74/jagozzi/config"
+	_ "github.com/rbeuque74/jagozzi/consumers/nsca"
+	_ "github.com/rbeuque74/jagozzi/consumers/prometheus"
 	"github.com/rbeuque74/jagozzi/plugins"
 	_ "github.com/rbeuque74/jagozzi/plugins/command"
+	_ "github.com/rbeuque74/jagozzi/plugins/disk"
+	_ "github.com/rbeuque74/jagozzi/plugins/dns"
 	_ "github.com/rbeuque74/jagozzi/plugins/http"
+	_ "github.com/rbeuque74/jagozzi/plugins/load"
 	_ "github.com/rbeuque74/jagozzi/plugins/marathon"
+	_ "github.com/rbeuque74/jagozzi/plugins/memory"
 	_ "github.com/rbeuque74/jagozzi/plugins/processes"
 	_ "github.com/rbeuque74/jagozzi/plugins/ssl"
 	_ "github.com/rbeuque74/jagozzi/plugins/supervisor"
+	_ "github.com/rbeuque74/jagozzi/plugins/tcp"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -34,6 +41,7 @@ func main() {
 
 	ctx, cancel := context.WithCancel(context.Background())
 	exiting := exitSignalHandling(cancel)
+	reloading := reloadSignalHandling()
 	go exitTimeout(ctx)
 
 	cfg, err := config.Load(*configFile)
@@ -56,7 +64,15 @@ func main() {
 
 	jag.runMainLoop(ctx, &wg)
 	if !*oneShot {
-		<-exiting
+	waitLoop:
+		for {
+			select {
+			case <-exiting:
+				break waitLoop
+			case <-reloading:
+				jag.reload(ctx, &wg)
+			}
+		}
 	}
 
 	log.Debug("jagozzi: waiting for all goroutines")
@@ -67,28 +83,69 @@ func main() {
 	log.Debug("jagozzi: unloading complete; exit successful")
 }
 
-func (jag Jagozzi) runMainLoop(ctx context.Context, wg *sync.WaitGroup) {
-	checkersPerPeridicity := map[time.Duration][]plugins.Checker{}
-	for _, checker := range jag.Checkers() {
+// reload parses configuration file again and applies it on running instance; current configuration is kept on error
+func (jag *Jagozzi) reload(ctx context.Context, wg *sync.WaitGroup) {
+	log.Infof("jagozzi: reloading configuration %q", *configFile)
+
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		log.Errorf("jagozzi: unable to reload configuration, keeping current one: %s", err)
+		return
+	}
+
+	if err := jag.Reload(*cfg); err != nil {
+		log.Errorf("jagozzi: unable to apply new configuration, keeping current one: %s", err)
+		return
+	}
+
+	jag.runMainLoop(ctx, wg)
+	log.Info("jagozzi: configuration reloaded")
+}
+
+// runMainLoop starts one loop per checkers periodicity; loops that are already running for the same checkers are kept
+func (jag *Jagozzi) runMainLoop(ctx context.Context, wg *sync.WaitGroup) {
+	jag.mutex.RLock()
+	checkersPerPeridicity := map[time.Duration][]loadedChecker{}
+	for _, checker := range jag.checkers {
 		periodicity := jag.cfg.Periodicity
 		if p := checker.Periodicity(); p != nil {
 			periodicity = *p
 		}
 
-		var currentArray []plugins.Checker
+		var currentArray []loadedChecker
 		if array, ok := checkersPerPeridicity[periodicity]; ok {
 			currentArray = array
 		}
 		currentArray = append(currentArray, checker)
 		checkersPerPeridicity[periodicity] = currentArray
 	}
+	jag.mutex.RUnlock()
+
+	for periodicity, loop := range jag.loops {
+		if checkers, ok := checkersPerPeridicity[periodicity]; ok && checkersKey(checkers) == loop.key {
+			continue
+		}
+
+		log.WithField("periodicity", periodicity.String()).Debug("loop: checkers changed, stopping")
+		loop.cancel()
+		delete(jag.loops, periodicity)
+	}
 
 	for loopPeriodicity, loopCheckers := range checkersPerPeridicity {
+		if _, running := jag.loops[loopPeriodicity]; running {
+			continue
+		}
+
 		periodicity := loopPeriodicity
 		checkers := loopCheckers
+		loopCtx, cancelLoop := context.WithCancel(ctx)
+		jag.loops[periodicity] = checkerLoop{
+			key:    checkersKey(checkers),
+			cancel: cancelLoop,
+		}
 
 		wg.Add(1)
-		go func() {
+		go func(ctx context.Context) {
 			defer wg.Done()
 			timeout := periodicity * time.Duration(2)
 			cancellationTimeout := timeout + time.Second
@@ -110,10 +167,10 @@ func (jag Jagozzi) runMainLoop(ctx context.Context, wg *sync.WaitGroup) {
 
 					for _, checker := range checkers {
 						wg.Add(1)
-						go jag.runChecker(loopCtx, checker, wg)
+						go jag.runChecker(loopCtx, checker.Checker, wg)
 					}
 				case <-ctx.Done():
-					log.Debug("loop: main context closed, exiting")
+					log.Debug("loop: context closed, exiting")
 					return
 				}
 				if *oneShot {
@@ -121,15 +178,17 @@ func (jag Jagozzi) runMainLoop(ctx context.Context, wg *sync.WaitGroup) {
 					return
 				}
 			}
-		}()
+		}(loopCtx)
 	}
 }
 
-func (jag Jagozzi) runChecker(ctx context.Context, checker plugins.Checker, wg *sync.WaitGroup) {
+func (jag *Jagozzi) runChecker(ctx context.Context, checker plugins.Checker, wg *sync.WaitGroup) {
 	defer wg.Done()
 	log := log.WithFields(log.Fields{"name": checker.Name(), "serviceName": checker.ServiceName()})
 	log.Debugf("perform check")
+	date := time.Now()
 	result := checker.Run(ctx)
+	duration := time.Since(date)
 
 	if ctx.Err() != nil && ctx.Err() == context.Canceled {
 		log.Debug("jagozzi: context cancelled while running checker")
@@ -139,5 +198,5 @@ func (jag Jagozzi) runChecker(ctx context.Context, checker plugins.Checker, wg *
 	}
 
 	log.Debugf("checker: result was %q", result.Message)
-	jag.SendConsumers(result)
+	jag.SendConsumers(result, date, duration)
 }
@@ -1,10 +1,12 @@
 package command
 
 import (
-	"bytes"
 	"context"
 	"fmt"
+	"os"
 	"os/exec"
+	"sort"
+	"strings"
 	"syscall"
 	"time"
 
@@ -57,55 +59,146 @@ func (res result) Error() error {
 
 // Run is performing the checker protocol
 func (c *CommandChecker) Run(ctx context.Context) plugins.Result {
-	cmd := exec.Command(c.command, c.args...)
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	cmd := c.newCommand()
+	stdout := newLimitedBuffer(int(c.cfg.MaxOutput))
+	stderr := newLimitedBuffer(int(c.cfg.MaxOutput))
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
 
 	model := result{
-		Cfg:    c.cfg,
-		Cmd:    *cmd,
+		Cfg:    c.cfg.redacted(),
+		Cmd:    c.scrubCommand(cmd),
 		Stdout: "",
 		Stderr: "",
 		Err:    nil,
 	}
 
+	startedAt := time.Now()
 	if err := cmd.Start(); err != nil {
-		return plugins.ResultFromError(c, err, "")
+		return c.execFailure(err)
 	}
-	done := make(chan error)
+	// command runs in its own process group, which has the same ID as the command
+	pgid := cmd.Process.Pid
+
+	done := make(chan error, 1)
 	go func() { done <- cmd.Wait() }()
 	select {
 	case <-ctx.Done():
-		model.Stderr = stderr.String()
-		model.Stdout = stdout.String()
+		cleanup, err := c.terminateProcessGroup(pgid)
+		if err != nil {
+			return plugins.ResultFromError(c, err, fmt.Sprintf("command: context expired, kill process group %d failed", pgid))
+		}
 
-		if err := cmd.Process.Kill(); err != nil {
-			return plugins.ResultFromError(c, err, fmt.Sprintf("command: context expired, kill pid %q failed", cmd.Process.Pid))
+		// output is complete once all processes holding it are gone, unless some of them left the process group
+		select {
+		case <-done:
+		case <-time.After(c.cfg.KillGrace):
 		}
+		model.Stderr = stderr.String()
+		model.Stdout = stdout.String()
 
 		model.Err = ctx.Err()
-		err := fmt.Errorf(plugins.RenderError(c.cfg.templates.ErrTimeout, model))
-		return plugins.ResultFromError(c, err, "")
+		err = fmt.Errorf(plugins.RenderError(c.cfg.templates.ErrTimeout, model))
+		result := plugins.ResultFromError(c, err, "")
+		result.Message = withNote(result.Message, cleanup)
+		return result
 	case err := <-done:
 		model.Stderr = stderr.String()
 		model.Stdout = stdout.String()
 
-		if typedErr, ok := err.(*exec.ExitError); ok {
-			model.ExitCode = typedErr.ProcessState.Sys().(syscall.WaitStatus).ExitStatus()
-			model.Err = fmt.Errorf("%s: %s", typedErr, model.Stderr)
-			err = fmt.Errorf(plugins.RenderError(c.cfg.templates.ErrExitCode, model))
-			return plugins.ResultFromError(c, err, "")
-		} else if err != nil {
-			return plugins.ResultFromError(c, fmt.Errorf("%s: %s", err, model.Stderr), "")
-		} else {
-			return plugins.Result{
-				Status:  plugins.STATE_OK,
-				Message: model.Stdout,
-				Checker: c,
+		result := c.exitResult(model, err, time.Since(startedAt))
+
+		// processes started in background by the command are still running
+		if len(processGroupMembers(pgid)) > 0 {
+			cleanup, err := c.terminateProcessGroup(pgid)
+			if err != nil {
+				log.Warnf("command: kill orphan processes of process group %d failed: %s", pgid, err)
 			}
+			result.Message = withNote(result.Message, cleanup)
+		}
+		return result
+	}
+}
+
+// exitResult creates the result of a command that exited
+func (c *CommandChecker) exitResult(model result, err error, elapsed time.Duration) plugins.Result {
+	perfdata := []plugins.PerfData{
+		plugins.NewPerfData("time", elapsed.Seconds(), "s").WithMin(0),
+	}
+
+	typedErr, isExitErr := err.(*exec.ExitError)
+	if isExitErr {
+		model.ExitCode = typedErr.ProcessState.Sys().(syscall.WaitStatus).ExitStatus()
+	} else if err != nil {
+		return c.execFailure(fmt.Errorf("%s: %s", err, model.Stderr))
+	}
+
+	if c.cfg.Type == nagiosType {
+		return c.nagiosResult(model)
+	}
+
+	if isExitErr {
+		model.Err = fmt.Errorf("%s: %s", typedErr, model.Stderr)
+		err = fmt.Errorf(plugins.RenderError(c.cfg.templates.ErrExitCode, model))
+		result := plugins.ResultFromError(c, err, "")
+		result.PerfData = perfdata
+		return result
+	}
+	return plugins.Result{
+		Status:   plugins.STATE_OK,
+		Message:  model.Stdout,
+		Checker:  c,
+		PerfData: perfdata,
+	}
+}
+
+// scrubCommand returns a copy of the command with configured environment values redacted, to prevent credentials
+// leak in templates
+func (c *CommandChecker) scrubCommand(cmd *exec.Cmd) exec.Cmd {
+	scrubbed := *cmd
+	if cmd.Env == nil {
+		return scrubbed
+	}
+
+	scrubbed.Env = make([]string, 0, len(cmd.Env))
+	for _, variable := range cmd.Env {
+		name := strings.SplitN(variable, "=", 2)[0]
+		if value, ok := c.cfg.Env[name]; ok {
+			variable = name + "=" + string(value.Redacted())
+		}
+		scrubbed.Env = append(scrubbed.Env, variable)
+	}
+	return scrubbed
+}
+
+// newCommand creates the command to run, with configured environment, working directory, user and input
+func (c *CommandChecker) newCommand() *exec.Cmd {
+	cmd := exec.Command(c.command, c.args...)
+	cmd.Dir = c.cfg.Cwd
+
+	if len(c.cfg.Env) > 0 {
+		names := make([]string, 0, len(c.cfg.Env))
+		for name := range c.cfg.Env {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		cmd.Env = os.Environ()
+		for _, name := range names {
+			cmd.Env = append(cmd.Env, name+"="+string(c.cfg.Env[name]))
 		}
 	}
+
+	if c.cfg.Stdin != "" {
+		cmd.Stdin = strings.NewReader(c.cfg.Stdin)
+	}
+
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		// running in its own process group allows to kill the processes started by the command
+		Setpgid:    true,
+		Credential: c.cfg.credential,
+	}
+	return cmd
 }
 
 // NewCommandChecker create a Command checker
@@ -121,11 +214,15 @@ func NewCommandChecker(conf interface{}, pluginConf interface{}) (plugins.Checke
 		return nil, err
 	}
 
-	p := shellwords.NewParser()
-	p.ParseEnv = true
-	args, err := p.Parse(cfg.Command)
-	if err != nil {
-		return nil, err
+	var args []string
+	if cfg.Shell {
+		args = []string{"/bin/sh", "-c", cfg.Command}
+	} else {
+		p := shellwords.NewParser()
+		p.ParseEnv = true
+		if args, err = p.Parse(cfg.Command); err != nil {
+			return nil, err
+		}
 	}
 
 	checker := &CommandChecker{
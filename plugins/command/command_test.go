@@ -2,6 +2,11 @@ package command
 
 import (
 	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -26,6 +31,10 @@ func TestCommand(t *testing.T) {
 	result := checker.Run(ctxRun)
 	assert.Equal(t, plugins.STATE_OK, result.Status)
 	assert.Containsf(t, result.Message, "HelloWorld\n", "command bad message: %q", result.Message)
+	if assert.Len(t, result.PerfData, 1) {
+		assert.Equal(t, "time", result.PerfData[0].Label)
+		assert.Equal(t, "s", result.PerfData[0].Unit)
+	}
 
 	// bad exit code
 	cfg["command"] = "/bin/false"
@@ -51,3 +60,260 @@ func TestCommand(t *testing.T) {
 	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
 	assert.Equal(t, "command /bin/sleep 2 took too long to execute", result.Message)
 }
+
+func TestCommandNagios(t *testing.T) {
+	cfg := map[string]interface{}{
+		"command": `/bin/sh -c "echo 'DISK OK - free space: / 3326 MB (56%) | /=2643MB;5948;5958;0;5968'"`,
+		"type":    "nagios",
+		"name":    "test-1",
+	}
+	checker, err := NewCommandChecker(cfg, nil)
+	assert.Nilf(t, err, "command checker instantiation failed: %q", err)
+
+	ctxRun, cancelFunc1 := context.WithTimeout(context.Background(), time.Second)
+	defer cancelFunc1()
+	result := checker.Run(ctxRun)
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+	assert.Equal(t, "DISK OK - free space: / 3326 MB (56%)", result.Message)
+	assert.Equal(t, "/=2643MB;5948;5958;0;5968", plugins.FormatPerfData(result.PerfData))
+
+	// exit codes
+	for exitCode, status := range map[int]plugins.StatusEnum{
+		1: plugins.STATE_WARNING,
+		2: plugins.STATE_CRITICAL,
+		3: plugins.STATE_UNKNOWN,
+		4: plugins.STATE_UNKNOWN,
+	} {
+		cfg["command"] = fmt.Sprintf(`/bin/sh -c "echo 'check returned %d'; exit %d"`, exitCode, exitCode)
+		checker, err = NewCommandChecker(cfg, nil)
+		assert.Nilf(t, err, "command checker instantiation failed: %q", err)
+
+		result = checker.Run(ctxRun)
+		assert.Equalf(t, status, result.Status, "bad status for exit code %d", exitCode)
+		assert.Equal(t, fmt.Sprintf("check returned %d", exitCode), result.Message)
+		assert.Len(t, result.PerfData, 0)
+	}
+
+	// long output, with performance data on several lines
+	script, err := ioutil.TempFile("", "jagozzi-check")
+	assert.Nil(t, err)
+	defer os.Remove(script.Name())
+	script.WriteString("#!/bin/sh\n")
+	script.WriteString("echo \"LOAD WARNING | load1=2.5;2;4;0\"\n")
+	script.WriteString("echo \"load is high\"\n")
+	script.WriteString("echo \"see top output | 'load 5'=1.5;2;4;0\"\n")
+	script.WriteString("echo \"load15=U load_max=4\"\n")
+	script.WriteString("exit 1\n")
+	script.Close()
+	assert.Nil(t, os.Chmod(script.Name(), 0700))
+
+	cfg["command"] = script.Name()
+	checker, err = NewCommandChecker(cfg, nil)
+	assert.Nilf(t, err, "command checker instantiation failed: %q", err)
+
+	result = checker.Run(ctxRun)
+	assert.Equal(t, plugins.STATE_WARNING, result.Status)
+	assert.Equal(t, "LOAD WARNING", result.Message)
+	assert.Equal(t, "load1=2.5;2;4;0 'load 5'=1.5;2;4;0 load_max=4", plugins.FormatPerfData(result.PerfData))
+
+	// no output
+	cfg["command"] = `/bin/sh -c "exit 2"`
+	checker, err = NewCommandChecker(cfg, nil)
+	assert.Nilf(t, err, "command checker instantiation failed: %q", err)
+
+	result = checker.Run(ctxRun)
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+	assert.Equal(t, `command /bin/sh -c "exit 2" exited with status code 2`, result.Message)
+
+	// plugin that can't be executed
+	for _, command := range []string{"/nonexistent/check_foo", os.TempDir()} {
+		cfg["command"] = command
+		checker, err = NewCommandChecker(cfg, nil)
+		assert.Nilf(t, err, "command checker instantiation failed: %q", err)
+
+		result = checker.Run(ctxRun)
+		assert.Equalf(t, plugins.STATE_UNKNOWN, result.Status, "bad status for command %s", command)
+	}
+
+	cfg["type"] = "icinga"
+	_, err = NewCommandChecker(cfg, nil)
+	assert.NotNil(t, err)
+}
+
+func TestCommandEnvironment(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jagozzi-command")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.Nil(t, os.Setenv("JAGOZZI_TEST_TOKEN", "s3cr3t"))
+	defer os.Unsetenv("JAGOZZI_TEST_TOKEN")
+
+	// shell, environment, working directory and standard input
+	cfg := map[string]interface{}{
+		"command": `echo "$GREETING $TOKEN from $(pwd)"; tr a-z A-Z | head -c 5`,
+		"shell":   true,
+		"env": map[string]interface{}{
+			"GREETING": "hello",
+			"TOKEN":    "env:JAGOZZI_TEST_TOKEN",
+		},
+		"cwd":   dir,
+		"stdin": "jagozzi\n",
+		"name":  "test-1",
+	}
+	checker, err := NewCommandChecker(cfg, nil)
+	assert.Nilf(t, err, "command checker instantiation failed: %q", err)
+
+	ctxRun, cancelFunc1 := context.WithTimeout(context.Background(), time.Second)
+	defer cancelFunc1()
+	result := checker.Run(ctxRun)
+	assert.Equalf(t, plugins.STATE_OK, result.Status, "command bad message: %q", result.Message)
+	realDir, err := filepath.EvalSymlinks(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, "hello s3cr3t from "+realDir+"\nJAGOZ", result.Message)
+
+	// environment secrets are not available in templates
+	cfg["command"] = "exit 1"
+	cfg["templates"] = map[string]string{
+		"ErrExitCode": "{{.Cfg.Env}} {{.Cmd.Env}}",
+	}
+	checker, err = NewCommandChecker(cfg, nil)
+	assert.Nilf(t, err, "command checker instantiation failed: %q", err)
+	// secret is read on configuration loading, removing it from jagozzi environment inherited by the command
+	os.Unsetenv("JAGOZZI_TEST_TOKEN")
+	result = checker.Run(ctxRun)
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+	assert.Contains(t, result.Message, "TOKEN=<redacted>")
+	assert.NotContains(t, result.Message, "s3cr3t")
+
+	// missing working directory
+	cfg = map[string]interface{}{
+		"command": "/bin/echo jagozzi",
+		"cwd":     filepath.Join(dir, "missing"),
+		"name":    "test-1",
+	}
+	checker, err = NewCommandChecker(cfg, nil)
+	assert.Nilf(t, err, "command checker instantiation failed: %q", err)
+	result = checker.Run(ctxRun)
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+
+	cfg = map[string]interface{}{
+		"command": "/usr/bin/id -u",
+		"user":    "jagozzi-missing-user",
+		"name":    "test-1",
+	}
+	_, err = NewCommandChecker(cfg, nil)
+	assert.NotNil(t, err)
+}
+
+func TestCommandUser(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("running commands as another user requires root privileges")
+	}
+
+	cfg := map[string]interface{}{
+		"command": `echo "$(id -u) $(id -g)"`,
+		"shell":   true,
+		"user":    "65534",
+		"group":   "65533",
+		"name":    "test-1",
+	}
+	checker, err := NewCommandChecker(cfg, nil)
+	assert.Nilf(t, err, "command checker instantiation failed: %q", err)
+
+	ctxRun, cancelFunc1 := context.WithTimeout(context.Background(), time.Second)
+	defer cancelFunc1()
+	result := checker.Run(ctxRun)
+	assert.Equalf(t, plugins.STATE_OK, result.Status, "command bad message: %q", result.Message)
+	assert.Equal(t, "65534 65533\n", result.Message)
+}
+
+// processRunning returns true if the process exists and is not a zombie
+func processRunning(t *testing.T, pidfile string) bool {
+	b, err := ioutil.ReadFile(pidfile)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	stat, err := ioutil.ReadFile(fmt.Sprintf("/proc/%s/stat", strings.TrimSpace(string(b))))
+	if os.IsNotExist(err) {
+		return false
+	}
+	assert.Nil(t, err)
+	fields := strings.Fields(string(stat[strings.LastIndex(string(stat), ")")+1:]))
+	return fields[0] != "Z"
+}
+
+func TestCommandProcessGroup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jagozzi-command")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	pidfile := filepath.Join(dir, "sleep.pid")
+
+	// output is truncated
+	cfg := map[string]interface{}{
+		"command":    "head -c 100 /dev/zero | tr '\\000' a",
+		"shell":      true,
+		"max_output": 16,
+		"name":       "test-1",
+	}
+	checker, err := NewCommandChecker(cfg, nil)
+	assert.Nilf(t, err, "command checker instantiation failed: %q", err)
+
+	ctxRun, cancelFunc1 := context.WithTimeout(context.Background(), time.Second)
+	defer cancelFunc1()
+	result := checker.Run(ctxRun)
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+	assert.Equal(t, strings.Repeat("a", 16)+"... (truncated)", result.Message)
+
+	// grandchildren are terminated on timeout
+	cfg = map[string]interface{}{
+		"command": "sleep 5 & echo $! > " + pidfile + "; sleep 5",
+		"shell":   true,
+		"name":    "test-1",
+	}
+	checker, err = NewCommandChecker(cfg, nil)
+	assert.Nilf(t, err, "command checker instantiation failed: %q", err)
+
+	ctxRun, cancelFunc1 = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancelFunc1()
+	start := time.Now()
+	result = checker.Run(ctxRun)
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+	assert.Equal(t, "command sleep 5 & echo $! > "+pidfile+"; sleep 5 took too long to execute (2 orphan processes terminated)", result.Message)
+	assert.True(t, time.Since(start) < time.Second)
+	assert.False(t, processRunning(t, pidfile))
+
+	// processes ignoring SIGTERM are killed after grace period
+	cfg = map[string]interface{}{
+		"command":    "trap '' TERM; sleep 5 & echo $! > " + pidfile + "; sleep 5",
+		"shell":      true,
+		"kill_grace": 200,
+		"name":       "test-1",
+	}
+	checker, err = NewCommandChecker(cfg, nil)
+	assert.Nilf(t, err, "command checker instantiation failed: %q", err)
+
+	ctxRun, cancelFunc1 = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancelFunc1()
+	result = checker.Run(ctxRun)
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+	assert.Contains(t, result.Message, "took too long to execute (process group killed after 200ms)")
+	assert.False(t, processRunning(t, pidfile))
+
+	// orphans left by the command are terminated
+	cfg = map[string]interface{}{
+		"command": "sleep 5 > /dev/null 2>&1 & echo $! > " + pidfile + "; echo started",
+		"shell":   true,
+		"name":    "test-1",
+	}
+	checker, err = NewCommandChecker(cfg, nil)
+	assert.Nilf(t, err, "command checker instantiation failed: %q", err)
+
+	ctxRun, cancelFunc1 = context.WithTimeout(context.Background(), time.Second)
+	defer cancelFunc1()
+	result = checker.Run(ctxRun)
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+	assert.Equal(t, "started (1 orphan process terminated)", result.Message)
+	assert.False(t, processRunning(t, pidfile))
+}
@@ -3,9 +3,14 @@ package command
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"os"
 	"os/exec"
+	"os/user"
+	"strconv"
+	"syscall"
 	"text/template"
+	"time"
 
 	"github.com/rbeuque74/jagozzi/config"
 	validator "gopkg.in/go-playground/validator.v9"
@@ -14,14 +19,32 @@ import (
 
 type rawCommandConfig struct {
 	config.GenericPluginConfiguration
-	Command      string       `json:"command" validate:"required"`
-	Type         string       `json:"type"`
+	Command string `json:"command" validate:"required"`
+	// Type is command (default), where any exit code but 0 is critical, or nagios for Nagios plugins
+	Type         string       `json:"type" validate:"omitempty,eq=command|eq=nagios"`
 	RawTemplates rawTemplates `json:"templates"`
+	// Env are environment variables added to jagozzi environment
+	Env map[string]config.Secret `json:"env"`
+	// Cwd is the working directory of the command
+	Cwd string `json:"cwd"`
+	// User and Group are the name or ID of the user and group running the command; group defaults to user group
+	User  string `json:"user"`
+	Group string `json:"group"`
+	// Shell runs the command using /bin/sh, allowing pipes and redirections
+	Shell bool `json:"shell"`
+	// Stdin is the content sent to the command standard input
+	Stdin string `json:"stdin"`
+	// MaxOutput is the maximum size of standard output and standard error kept, the remainder is discarded
+	MaxOutput config.Size `json:"max_output" default:"1048576"`
+	// RawKillGrace is the delay in milliseconds between SIGTERM and SIGKILL when the command is stopped
+	RawKillGrace int64 `json:"kill_grace" default:"1000" validate:"gte=0"`
 }
 
 type commandConfig struct {
 	rawCommandConfig
-	templates templates
+	templates  templates
+	credential *syscall.Credential
+	KillGrace  time.Duration `json:"-"`
 }
 
 type rawTemplates struct {
@@ -34,6 +57,12 @@ type templates struct {
 	ErrExitCode *template.Template `json:"-"`
 }
 
+// redacted returns a copy of the configuration with secrets redacted, to be used in templates
+func (cfg commandConfig) redacted() commandConfig {
+	cfg.Env = config.RedactedSecrets(cfg.Env)
+	return cfg
+}
+
 func (cfg *commandConfig) UnmarshalJSON(b []byte) error {
 	raw := &rawCommandConfig{}
 
@@ -49,6 +78,7 @@ func (cfg *commandConfig) UnmarshalJSON(b []byte) error {
 	defaults.SetDefaults(raw)
 
 	cfg.rawCommandConfig = *raw
+	cfg.KillGrace = time.Duration(raw.RawKillGrace) * time.Millisecond
 
 	var err error
 	var tmpl *template.Template
@@ -62,9 +92,76 @@ func (cfg *commandConfig) UnmarshalJSON(b []byte) error {
 	}
 	cfg.templates.ErrExitCode = tmpl
 
+	if raw.User != "" || raw.Group != "" {
+		if cfg.credential, err = newCredential(raw.User, raw.Group); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// newCredential resolves the user and group running the command; supplementary groups of the user are kept
+func newCredential(userName, groupName string) (*syscall.Credential, error) {
+	credential := &syscall.Credential{
+		Uid: uint32(os.Getuid()),
+		Gid: uint32(os.Getgid()),
+	}
+
+	if userName != "" {
+		u, err := lookupUser(userName)
+		if err != nil {
+			return nil, err
+		}
+		uid, err := strconv.ParseUint(u.Uid, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid uid %q of user %q", u.Uid, userName)
+		}
+		gid, err := strconv.ParseUint(u.Gid, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gid %q of user %q", u.Gid, userName)
+		}
+		credential.Uid, credential.Gid = uint32(uid), uint32(gid)
+
+		if groupIds, err := u.GroupIds(); err == nil {
+			for _, groupID := range groupIds {
+				if gid, err := strconv.ParseUint(groupID, 10, 32); err == nil {
+					credential.Groups = append(credential.Groups, uint32(gid))
+				}
+			}
+		}
+	}
+
+	if groupName != "" {
+		gid, err := strconv.ParseUint(groupName, 10, 32)
+		if err != nil {
+			g, err := user.LookupGroup(groupName)
+			if err != nil {
+				return nil, err
+			}
+			if gid, err = strconv.ParseUint(g.Gid, 10, 32); err != nil {
+				return nil, fmt.Errorf("invalid gid %q of group %q", g.Gid, groupName)
+			}
+		}
+		credential.Gid = uint32(gid)
+	}
+
+	return credential, nil
+}
+
+// lookupUser finds a user by name or by ID; an unknown ID is accepted as is
+func lookupUser(name string) (*user.User, error) {
+	if _, err := strconv.ParseUint(name, 10, 32); err != nil {
+		return user.Lookup(name)
+	}
+
+	u, err := user.LookupId(name)
+	if _, unknown := err.(user.UnknownUserIdError); unknown {
+		return &user.User{Uid: name, Gid: name}, nil
+	}
+	return u, err
+}
+
 func testTemplate(templateName, stringTemplate string) (*template.Template, error) {
 	// testing that we can parse template
 	tmpl, err := template.New(templateName).Parse(stringTemplate)
@@ -0,0 +1,77 @@
+package command
+
+import (
+	"strings"
+
+	"github.com/rbeuque74/jagozzi/plugins"
+	log "github.com/sirupsen/logrus"
+)
+
+// nagiosType is the command type following Nagios plugins guidelines for exit codes and output
+const nagiosType = "nagios"
+
+// nagiosStatuses maps Nagios plugins exit codes to statuses; any other exit code is unknown
+var nagiosStatuses = map[int]plugins.StatusEnum{
+	0: plugins.STATE_OK,
+	1: plugins.STATE_WARNING,
+	2: plugins.STATE_CRITICAL,
+	3: plugins.STATE_UNKNOWN,
+}
+
+// nagiosResult creates the result of a Nagios plugin from its exit code and output
+func (c *CommandChecker) nagiosResult(model result) plugins.Result {
+	status, ok := nagiosStatuses[model.ExitCode]
+	if !ok {
+		status = plugins.STATE_UNKNOWN
+	}
+
+	message, perfdata := parseNagiosOutput(model.Stdout)
+	if message == "" {
+		message = plugins.RenderError(c.cfg.templates.ErrExitCode, model)
+	}
+
+	return plugins.Result{
+		Status:   status,
+		Message:  message,
+		Checker:  c,
+		PerfData: perfdata,
+	}
+}
+
+// execFailure creates the result of a command that couldn't be executed; Nagios plugins report it as unknown, leaving
+// critical to the plugin exit code
+func (c *CommandChecker) execFailure(err error) plugins.Result {
+	result := plugins.ResultFromError(c, err, "")
+	if c.cfg.Type == nagiosType {
+		result.Status = plugins.STATE_UNKNOWN
+	}
+	return result
+}
+
+// parseNagiosOutput splits the output of a Nagios plugin: the first line is the message, optionally followed by
+// performance data after |; next lines are long output, where performance data can continue after a |
+func parseNagiosOutput(output string) (string, []plugins.PerfData) {
+	lines := strings.SplitN(output, "\n", 2)
+	message := lines[0]
+
+	var rawPerfData []string
+	if i := strings.IndexByte(message, '|'); i != -1 {
+		rawPerfData = append(rawPerfData, message[i+1:])
+		message = message[:i]
+	}
+	if len(lines) == 2 {
+		if i := strings.IndexByte(lines[1], '|'); i != -1 {
+			rawPerfData = append(rawPerfData, lines[1][i+1:])
+		}
+	}
+
+	var perfdata []plugins.PerfData
+	for _, raw := range rawPerfData {
+		parsed, err := plugins.ParsePerfData(raw)
+		if err != nil {
+			log.Warnf("command: invalid performance data %q: %s", raw, err)
+		}
+		perfdata = append(perfdata, parsed...)
+	}
+	return strings.TrimSpace(message), perfdata
+}
@@ -0,0 +1,128 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// truncatedMarker is appended to an output that exceeded the maximum size
+const truncatedMarker = "... (truncated)"
+
+// limitedBuffer keeps the first bytes written to it, up to a maximum size, and discards the following ones
+type limitedBuffer struct {
+	mutex     sync.Mutex
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func newLimitedBuffer(max int) *limitedBuffer {
+	return &limitedBuffer{max: max}
+}
+
+// Write never fails, so that the command isn't disturbed when its output is truncated
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if remaining := b.max - b.buf.Len(); len(p) > remaining {
+		b.buf.Write(p[:remaining])
+		b.truncated = true
+	} else {
+		b.buf.Write(p)
+	}
+	return len(p), nil
+}
+
+// String returns the output kept, followed by a marker if it was truncated
+func (b *limitedBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.truncated {
+		return b.buf.String() + truncatedMarker
+	}
+	return b.buf.String()
+}
+
+// processGroupMembers returns the processes of the group that are running; zombie processes are ignored as
+// they may not be reaped, if nobody waits for orphans in a container
+func processGroupMembers(pgid int) []int {
+	if syscall.Kill(-pgid, 0) != nil {
+		return nil
+	}
+
+	stats, err := filepath.Glob("/proc/[0-9]*/stat")
+	if err != nil {
+		return nil
+	}
+
+	var pids []int
+	for _, stat := range stats {
+		b, err := ioutil.ReadFile(stat)
+		if err != nil {
+			continue
+		}
+		// pid (executable name) state ppid pgrp
+		fields := strings.Fields(string(b[bytes.LastIndexByte(b, ')')+1:]))
+		if len(fields) < 3 || fields[0] == "Z" || fields[2] != strconv.Itoa(pgid) {
+			continue
+		}
+		if pid, err := strconv.Atoi(strings.Fields(string(b))[0]); err == nil {
+			pids = append(pids, pid)
+		}
+	}
+	return pids
+}
+
+// terminateProcessGroup sends SIGTERM to the processes of the group, then SIGKILL to the ones still running after
+// the grace period; it returns a note about the processes that weren't the command itself, if any
+func (c *CommandChecker) terminateProcessGroup(pgid int) (string, error) {
+	var orphans int
+	for _, pid := range processGroupMembers(pgid) {
+		if pid != pgid {
+			orphans++
+		}
+	}
+
+	if err := syscall.Kill(-pgid, syscall.SIGTERM); err == syscall.ESRCH {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	deadline := time.Now().Add(c.cfg.KillGrace)
+	for time.Now().Before(deadline) {
+		if len(processGroupMembers(pgid)) == 0 {
+			switch orphans {
+			case 0:
+				return "", nil
+			case 1:
+				return "1 orphan process terminated", nil
+			default:
+				return fmt.Sprintf("%d orphan processes terminated", orphans), nil
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := syscall.Kill(-pgid, syscall.SIGKILL); err != nil && err != syscall.ESRCH {
+		return "", err
+	}
+	return fmt.Sprintf("process group killed after %s", c.cfg.KillGrace), nil
+}
+
+// withNote appends a note between parenthesis to a message
+func withNote(message, note string) string {
+	if note == "" {
+		return message
+	}
+	return fmt.Sprintf("%s (%s)", strings.TrimRight(message, "\n"), note)
+}
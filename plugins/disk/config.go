@@ -0,0 +1,54 @@
+package disk
+
+import (
+	"fmt"
+
+	"github.com/rbeuque74/jagozzi/config"
+	validator "gopkg.in/go-playground/validator.v9"
+)
+
+const (
+	typeUsedPercent = "used_percent"
+	typeUsedInodes  = "used_inodes"
+	typeFreeInodes  = "free_inodes"
+)
+
+type rawDiskConfig struct {
+	config.GenericPluginConfiguration
+	Type       string         `json:"type" validate:"required,eq=used_percent|eq=used_inodes|eq=free_inodes"`
+	MountPoint string         `json:"mountpoint"`
+	ExcludeFS  []string       `json:"exclude_fs"`
+	Warning    config.Percent `json:"warn" validate:"required"`
+	Critical   config.Percent `json:"crit" validate:"required"`
+}
+
+type diskConfig struct {
+	rawDiskConfig
+}
+
+func (cfg *diskConfig) UnmarshalJSON(b []byte) error {
+	raw := &rawDiskConfig{}
+
+	if err := config.UnmarshalConfig(b, raw); err != nil {
+		return err
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(raw); err != nil {
+		return err
+	}
+
+	if raw.MountPoint != "" && len(raw.ExcludeFS) != 0 {
+		return fmt.Errorf("mountpoint and exclude_fs keys are incompatible")
+	}
+
+	// free inodes thresholds are reached when value goes below them
+	if raw.Type == typeFreeInodes && raw.Warning < raw.Critical {
+		return fmt.Errorf("warn threshold must be greater than or equal to crit threshold for type %q", raw.Type)
+	} else if raw.Type != typeFreeInodes && raw.Warning > raw.Critical {
+		return fmt.Errorf("warn threshold must be lower than or equal to crit threshold for type %q", raw.Type)
+	}
+
+	cfg.rawDiskConfig = *raw
+	return nil
+}
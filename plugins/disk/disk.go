@@ -0,0 +1,269 @@
+package disk
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/rbeuque74/jagozzi/plugins"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	pluginName        = "Disk"
+	defaultMountsFile = "/proc/mounts"
+)
+
+// mountsUnescaper decodes characters escaped by the kernel in mounts file
+var mountsUnescaper = strings.NewReplacer(`\040`, " ", `\011`, "\t", `\012`, "\n", `\134`, `\`)
+
+func init() {
+	plugins.Register(pluginName, NewDiskChecker)
+}
+
+// DiskChecker is a plugin to check disk usage of mount points
+type DiskChecker struct {
+	cfg        diskConfig
+	mountsFile string
+}
+
+type mount struct {
+	device     string
+	mountPoint string
+	fsType     string
+}
+
+// Name returns the name of the checker
+func (c DiskChecker) Name() string {
+	return pluginName
+}
+
+// ServiceName returns the name of the NSCA service associated to the checker
+func (c DiskChecker) ServiceName() string {
+	return c.cfg.Name
+}
+
+// Periodicity returns the delay between two checks
+func (c DiskChecker) Periodicity() *time.Duration {
+	return c.cfg.Periodicity()
+}
+
+// Run is performing the checker protocol
+func (c *DiskChecker) Run(ctx context.Context) plugins.Result {
+	mounts, err := c.mounts()
+	if err != nil {
+		return plugins.ResultFromError(c, err, "unable to list mount points")
+	}
+
+	if c.cfg.MountPoint != "" && len(mounts) == 0 {
+		return plugins.Result{
+			Status:  plugins.STATE_CRITICAL,
+			Message: fmt.Sprintf("mount point %q not found", c.cfg.MountPoint),
+			Checker: c,
+		}
+	}
+
+	status := plugins.STATE_OK
+	var messages []string
+	var perfdata []plugins.PerfData
+	var lastDescription string
+
+	for _, m := range mounts {
+		value, ok, err := c.usage(m.mountPoint)
+		if err != nil && c.cfg.MountPoint != "" {
+			return plugins.ResultFromError(c, err, fmt.Sprintf("unable to stat mount point %q", m.mountPoint))
+		} else if err != nil {
+			log.Warnf("disk: unable to stat mount point %q: %s", m.mountPoint, err)
+			continue
+		} else if !ok {
+			log.Debugf("disk: mount point %q (%s) doesn't report usage", m.mountPoint, m.fsType)
+			continue
+		}
+
+		perfdata = append(perfdata, c.perfData(m, value))
+		lastDescription = fmt.Sprintf("%s %s", m.mountPoint, c.describe(value))
+
+		mountStatus := c.status(value)
+		if mountStatus == plugins.STATE_OK {
+			continue
+		}
+		if mountStatus > status {
+			status = mountStatus
+		}
+		messages = append(messages, lastDescription)
+	}
+
+	if len(perfdata) == 0 {
+		return plugins.Result{
+			Status:  plugins.STATE_UNKNOWN,
+			Message: "no mount point reporting usage found",
+			Checker: c,
+		}
+	}
+
+	if status != plugins.STATE_OK {
+		return plugins.Result{
+			Status:   status,
+			Message:  strings.Join(messages, ", "),
+			Checker:  c,
+			PerfData: perfdata,
+		}
+	}
+
+	message := lastDescription
+	if len(perfdata) > 1 {
+		message = fmt.Sprintf("%d mount points below thresholds", len(perfdata))
+	}
+	return plugins.Result{
+		Status:   plugins.STATE_OK,
+		Message:  message,
+		Checker:  c,
+		PerfData: perfdata,
+	}
+}
+
+// mounts returns mount points that need to be checked
+func (c DiskChecker) mounts() ([]mount, error) {
+	file, err := os.Open(c.mountsFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	excluded := make(map[string]struct{}, len(c.cfg.ExcludeFS))
+	for _, fsType := range c.cfg.ExcludeFS {
+		excluded[fsType] = struct{}{}
+	}
+
+	var mounts []mount
+	seen := make(map[string]int)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 {
+			continue
+		}
+
+		m := mount{
+			device:     mountsUnescaper.Replace(fields[0]),
+			mountPoint: mountsUnescaper.Replace(fields[1]),
+			fsType:     fields[2],
+		}
+
+		if c.cfg.MountPoint != "" && filepath.Clean(c.cfg.MountPoint) != m.mountPoint {
+			continue
+		}
+		if _, ok := excluded[m.fsType]; ok {
+			continue
+		}
+
+		// a mount point mounted multiple times only exposes its last mount
+		if index, ok := seen[m.mountPoint]; ok {
+			mounts[index] = m
+			continue
+		}
+		seen[m.mountPoint] = len(mounts)
+		mounts = append(mounts, m)
+	}
+
+	return mounts, scanner.Err()
+}
+
+// usage returns the percentage measured by the check on a mount point; false is returned if filesystem doesn't report it
+func (c DiskChecker) usage(mountPoint string) (float64, bool, error) {
+	stat := syscall.Statfs_t{}
+	if err := syscall.Statfs(mountPoint, &stat); err != nil {
+		return 0, false, err
+	}
+
+	switch c.cfg.Type {
+	case typeUsedInodes, typeFreeInodes:
+		if stat.Files == 0 {
+			return 0, false, nil
+		}
+		free := float64(stat.Ffree) / float64(stat.Files) * 100
+		if c.cfg.Type == typeFreeInodes {
+			return plugins.Round(free), true, nil
+		}
+		return plugins.Round(100 - free), true, nil
+	default:
+		// same computation as df: reserved blocks are not available to users
+		used := stat.Blocks - stat.Bfree
+		total := used + stat.Bavail
+		if total == 0 {
+			return 0, false, nil
+		}
+		return plugins.Round(float64(used) / float64(total) * 100), true, nil
+	}
+}
+
+func (c DiskChecker) status(value float64) plugins.StatusEnum {
+	critical, warning := float64(c.cfg.Critical), float64(c.cfg.Warning)
+
+	if c.cfg.Type == typeFreeInodes {
+		if value <= critical {
+			return plugins.STATE_CRITICAL
+		} else if value <= warning {
+			return plugins.STATE_WARNING
+		}
+		return plugins.STATE_OK
+	}
+
+	if value >= critical {
+		return plugins.STATE_CRITICAL
+	} else if value >= warning {
+		return plugins.STATE_WARNING
+	}
+	return plugins.STATE_OK
+}
+
+func (c DiskChecker) describe(value float64) string {
+	switch c.cfg.Type {
+	case typeUsedInodes:
+		return fmt.Sprintf("%g%% inodes used", value)
+	case typeFreeInodes:
+		return fmt.Sprintf("%g%% inodes free", value)
+	default:
+		return fmt.Sprintf("%g%% used", value)
+	}
+}
+
+func (c DiskChecker) perfData(m mount, value float64) plugins.PerfData {
+	perfdata := plugins.NewPerfData(m.mountPoint, value, "%").WithMin(0).WithMax(100)
+	if c.cfg.Type == typeFreeInodes {
+		return perfdata.WithLowerThresholds(float64(c.cfg.Warning), float64(c.cfg.Critical))
+	}
+	return perfdata.WithThresholds(float64(c.cfg.Warning), float64(c.cfg.Critical))
+}
+
+// NewDiskChecker create a Disk checker
+func NewDiskChecker(conf interface{}, pluginConf interface{}) (plugins.Checker, error) {
+	out, err := yaml.Marshal(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := diskConfig{}
+	err = yaml.Unmarshal(out, &cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	checker := &DiskChecker{
+		cfg:        cfg,
+		mountsFile: defaultMountsFile,
+	}
+
+	if cfg.MountPoint != "" {
+		log.Infof("disk: Checker %q activated for mount point %q", cfg.Type, cfg.MountPoint)
+	} else {
+		log.Infof("disk: Checker %q activated for all mount points", cfg.Type)
+	}
+	return checker, nil
+}
@@ -0,0 +1,206 @@
+package disk
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/rbeuque74/jagozzi/plugins"
+	"github.com/stretchr/testify/assert"
+)
+
+func fixtureMounts(t *testing.T) (string, string, func()) {
+	mountPoint, err := ioutil.TempDir("", "jagozzi-disk-mount")
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	mountsFile, err := ioutil.TempFile("", "jagozzi-disk-mounts")
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	content := fmt.Sprintf("proc /proc proc rw,relatime 0 0\ntmpfs %s tmpfs rw,relatime 0 0\n", mountPoint)
+	if _, err := mountsFile.WriteString(content); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if err := mountsFile.Close(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	return mountPoint, mountsFile.Name(), func() {
+		os.Remove(mountPoint)
+		os.Remove(mountsFile.Name())
+	}
+}
+
+func newChecker(t *testing.T, cfg map[string]interface{}, mountsFile string) *DiskChecker {
+	checker, err := NewDiskChecker(cfg, nil)
+	assert.Nilf(t, err, "disk checker instantiation failed: %q", err)
+
+	diskChecker := checker.(*DiskChecker)
+	diskChecker.mountsFile = mountsFile
+	return diskChecker
+}
+
+func TestDisk(t *testing.T) {
+	mountPoint, mountsFile, teardown := fixtureMounts(t)
+	defer teardown()
+
+	cfg := map[string]interface{}{
+		"type":       "used_percent",
+		"mountpoint": mountPoint,
+		"warn":       "100%",
+		"crit":       100,
+		"name":       "test-1",
+	}
+	checker := newChecker(t, cfg, mountsFile)
+
+	assert.Equal(t, "Disk", checker.Name())
+	assert.Equal(t, "test-1", checker.ServiceName())
+
+	ctxRun, cancelFunc1 := context.WithTimeout(context.Background(), time.Second)
+	defer cancelFunc1()
+	result := checker.Run(ctxRun)
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+	assert.Contains(t, result.Message, mountPoint+" ")
+	assert.Contains(t, result.Message, "% used")
+	if assert.Len(t, result.PerfData, 1) {
+		assert.Equal(t, mountPoint, result.PerfData[0].Label)
+		assert.Equal(t, "%", result.PerfData[0].Unit)
+	}
+
+	// warning
+	cfg["warn"] = "0.01%"
+	checker = newChecker(t, cfg, mountsFile)
+
+	ctxRun, cancelFunc1 = context.WithTimeout(context.Background(), time.Second)
+	defer cancelFunc1()
+	result = checker.Run(ctxRun)
+	assert.Equal(t, plugins.STATE_WARNING, result.Status)
+	assert.Contains(t, result.Message, "% used")
+
+	// critical
+	cfg["crit"] = "0.01"
+	checker = newChecker(t, cfg, mountsFile)
+
+	ctxRun, cancelFunc1 = context.WithTimeout(context.Background(), time.Second)
+	defer cancelFunc1()
+	result = checker.Run(ctxRun)
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+
+	// mount point not found
+	cfg["mountpoint"] = "/not/found"
+	checker = newChecker(t, cfg, mountsFile)
+
+	ctxRun, cancelFunc1 = context.WithTimeout(context.Background(), time.Second)
+	defer cancelFunc1()
+	result = checker.Run(ctxRun)
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+	assert.Equal(t, `mount point "/not/found" not found`, result.Message)
+}
+
+func TestDiskAllMounts(t *testing.T) {
+	mountPoint, mountsFile, teardown := fixtureMounts(t)
+	defer teardown()
+
+	cfg := map[string]interface{}{
+		"type": "used_percent",
+		"warn": 100,
+		"crit": 100,
+		"name": "test-1",
+	}
+	checker := newChecker(t, cfg, mountsFile)
+
+	ctxRun, cancelFunc1 := context.WithTimeout(context.Background(), time.Second)
+	defer cancelFunc1()
+	result := checker.Run(ctxRun)
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+	// proc filesystem has no blocks and is ignored
+	if assert.Len(t, result.PerfData, 1) {
+		assert.Equal(t, mountPoint, result.PerfData[0].Label)
+	}
+
+	// filesystem type exclusion
+	cfg["exclude_fs"] = []string{"tmpfs"}
+	checker = newChecker(t, cfg, mountsFile)
+
+	ctxRun, cancelFunc1 = context.WithTimeout(context.Background(), time.Second)
+	defer cancelFunc1()
+	result = checker.Run(ctxRun)
+	assert.Equal(t, plugins.STATE_UNKNOWN, result.Status)
+	assert.Equal(t, "no mount point reporting usage found", result.Message)
+
+	// incompatible configuration
+	cfg["mountpoint"] = mountPoint
+	_, err := NewDiskChecker(cfg, nil)
+	assert.NotNil(t, err)
+
+	// invalid percentage
+	delete(cfg, "mountpoint")
+	delete(cfg, "exclude_fs")
+	cfg["warn"] = "120%"
+	_, err = NewDiskChecker(cfg, nil)
+	assert.NotNil(t, err)
+
+	// missing threshold
+	delete(cfg, "warn")
+	_, err = NewDiskChecker(cfg, nil)
+	assert.NotNil(t, err)
+
+	// thresholds in wrong order
+	cfg["warn"] = 90
+	cfg["crit"] = 80
+	_, err = NewDiskChecker(cfg, nil)
+	assert.NotNil(t, err)
+	cfg["type"] = "free_inodes"
+	_, err = NewDiskChecker(cfg, nil)
+	assert.Nil(t, err)
+}
+
+func TestDiskInodes(t *testing.T) {
+	mountPoint, mountsFile, teardown := fixtureMounts(t)
+	defer teardown()
+
+	stat := syscall.Statfs_t{}
+	if err := syscall.Statfs(mountPoint, &stat); err != nil || stat.Files == 0 {
+		t.Skip("filesystem doesn't report inodes")
+	}
+
+	cfg := map[string]interface{}{
+		"type":       "free_inodes",
+		"mountpoint": mountPoint,
+		"warn":       0.01,
+		"crit":       0.01,
+		"name":       "test-1",
+	}
+	checker := newChecker(t, cfg, mountsFile)
+
+	ctxRun, cancelFunc1 := context.WithTimeout(context.Background(), time.Second)
+	defer cancelFunc1()
+	result := checker.Run(ctxRun)
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+	assert.Contains(t, result.Message, "% inodes free")
+	if assert.Len(t, result.PerfData, 1) {
+		assert.True(t, strings.HasSuffix(result.PerfData[0].String(), ";0.01:;0.01:;0;100"), result.PerfData[0].String())
+	}
+
+	// used inodes
+	cfg["type"] = "used_inodes"
+	checker = newChecker(t, cfg, mountsFile)
+
+	ctxRun, cancelFunc1 = context.WithTimeout(context.Background(), time.Second)
+	defer cancelFunc1()
+	result = checker.Run(ctxRun)
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+	assert.Contains(t, result.Message, "% inodes used")
+}
@@ -0,0 +1,66 @@
+package dns
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"github.com/rbeuque74/jagozzi/config"
+	validator "gopkg.in/go-playground/validator.v9"
+	defaults "gopkg.in/mcuadros/go-defaults.v1"
+)
+
+type rawDNSConfig struct {
+	config.GenericPluginConfiguration
+	Query      string   `json:"query" validate:"required"`
+	RecordType string   `json:"record_type" default:"A" validate:"eq=A|eq=AAAA|eq=CNAME|eq=MX|eq=TXT|eq=SRV"`
+	Server     string   `json:"server"`
+	Expect     []string `json:"expect"`
+	// RawMinAnswers is a pointer so that an explicit 0 is not replaced by the default value
+	RawMinAnswers *int  `json:"min_answers" validate:"omitempty,min=0"`
+	RawTimeout    int64 `json:"timeout"`
+	RawWarning    int64 `json:"warn"`
+	RawCritical   int64 `json:"crit"`
+}
+
+type dnsConfig struct {
+	rawDNSConfig
+	Timeout    time.Duration `json:"-"`
+	Warning    time.Duration `json:"-"`
+	Critical   time.Duration `json:"-"`
+	MinAnswers int           `json:"-"`
+}
+
+func (cfg *dnsConfig) UnmarshalJSON(b []byte) error {
+	raw := &rawDNSConfig{}
+
+	if err := config.UnmarshalConfig(b, raw); err != nil {
+		return err
+	}
+
+	raw.RecordType = strings.ToUpper(raw.RecordType)
+	defaults.SetDefaults(raw)
+
+	validate := validator.New()
+	if err := validate.Struct(raw); err != nil {
+		return err
+	}
+
+	cfg.rawDNSConfig = *raw
+	cfg.Timeout = time.Duration(raw.RawTimeout) * time.Millisecond
+	cfg.Warning = time.Duration(raw.RawWarning) * time.Millisecond
+	cfg.Critical = time.Duration(raw.RawCritical) * time.Millisecond
+	cfg.MinAnswers = 1
+	if raw.RawMinAnswers != nil {
+		cfg.MinAnswers = *raw.RawMinAnswers
+	}
+
+	if cfg.Server != "" {
+		if _, _, err := net.SplitHostPort(cfg.Server); err != nil {
+			// adding default DNS port
+			cfg.Server = net.JoinHostPort(cfg.Server, "53")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,212 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/rbeuque74/jagozzi/plugins"
+	log "github.com/sirupsen/logrus"
+)
+
+const pluginName = "DNS"
+
+func init() {
+	plugins.Register(pluginName, NewDNSChecker)
+}
+
+// DNSChecker is a plugin to check DNS resolution
+type DNSChecker struct {
+	cfg dnsConfig
+	// resolver is the system resolver, used when no server is configured
+	resolver *net.Resolver
+}
+
+// Name returns the name of the checker
+func (c DNSChecker) Name() string {
+	return pluginName
+}
+
+// ServiceName returns the name of the NSCA service associated to the checker
+func (c DNSChecker) ServiceName() string {
+	return c.cfg.Name
+}
+
+// Periodicity returns the delay between two checks
+func (c DNSChecker) Periodicity() *time.Duration {
+	return c.cfg.Periodicity()
+}
+
+// Run is performing the checker protocol
+func (c *DNSChecker) Run(ctx context.Context) plugins.Result {
+	if c.cfg.Timeout > 0 {
+		var cancel func()
+		ctx, cancel = context.WithTimeout(ctx, c.cfg.Timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	answers, err := c.lookup(ctx)
+	if err != nil {
+		return plugins.ResultFromError(c, err, fmt.Sprintf("unable to resolve %s (%s)", c.cfg.Query, c.cfg.RecordType))
+	}
+	elapsedTime := time.Since(start).Round(time.Millisecond)
+
+	perfdata := []plugins.PerfData{
+		plugins.NewPerfData("time", elapsedTime.Seconds(), "s").WithThresholds(c.cfg.Warning.Seconds(), c.cfg.Critical.Seconds()).WithMin(0),
+		plugins.NewPerfData("answers", float64(len(answers)), "").WithMin(0),
+	}
+	description := fmt.Sprintf("%s %s: %s", c.cfg.Query, c.cfg.RecordType, strings.Join(answers, ", "))
+
+	if len(answers) < c.cfg.MinAnswers {
+		return plugins.Result{
+			Status:   plugins.STATE_CRITICAL,
+			Message:  fmt.Sprintf("%d answers instead of at least %d (%s)", len(answers), c.cfg.MinAnswers, description),
+			Checker:  c,
+			PerfData: perfdata,
+		}
+	}
+
+	if missing := missingAnswers(c.cfg.Expect, answers); len(missing) != 0 {
+		return plugins.Result{
+			Status:   plugins.STATE_CRITICAL,
+			Message:  fmt.Sprintf("expected answers not found: %s (%s)", strings.Join(missing, ", "), description),
+			Checker:  c,
+			PerfData: perfdata,
+		}
+	}
+
+	if c.cfg.Critical > 0 && elapsedTime > c.cfg.Critical {
+		return plugins.Result{
+			Status:   plugins.STATE_CRITICAL,
+			Message:  fmt.Sprintf("critical timeout: resolution took %s instead of %s", elapsedTime, c.cfg.Critical),
+			Checker:  c,
+			PerfData: perfdata,
+		}
+	} else if c.cfg.Warning > 0 && elapsedTime > c.cfg.Warning {
+		return plugins.Result{
+			Status:   plugins.STATE_WARNING,
+			Message:  fmt.Sprintf("timeout: resolution took %s instead of %s", elapsedTime, c.cfg.Warning),
+			Checker:  c,
+			PerfData: perfdata,
+		}
+	}
+
+	return plugins.Result{
+		Status:   plugins.STATE_OK,
+		Message:  fmt.Sprintf("%s - %s elapsed", description, elapsedTime),
+		Checker:  c,
+		PerfData: perfdata,
+	}
+}
+
+// lookup resolves the query and returns answers formatted as strings
+func (c DNSChecker) lookup(ctx context.Context) ([]string, error) {
+	// query is made absolute so that search domains of the host don't change the result
+	query := c.cfg.Query
+	if !strings.HasSuffix(query, ".") {
+		query = query + "."
+	}
+
+	// system resolver reads hosts file first, which would hide the answers of the configured server
+	if c.cfg.Server != "" {
+		return exchange(ctx, c.cfg.Server, query, c.cfg.RecordType)
+	}
+
+	var answers []string
+	switch c.cfg.RecordType {
+	case "AAAA", "A":
+		addrs, err := c.resolver.LookupIPAddr(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addrs {
+			isIPv4 := addr.IP.To4() != nil
+			if isIPv4 == (c.cfg.RecordType == "A") {
+				answers = append(answers, addr.IP.String())
+			}
+		}
+	case "CNAME":
+		cname, err := c.resolver.LookupCNAME(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		// resolver returns the queried name itself when it has no CNAME record
+		if !strings.EqualFold(normalize(cname), normalize(query)) {
+			answers = append(answers, normalize(cname))
+		}
+	case "MX":
+		mxs, err := c.resolver.LookupMX(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		for _, mx := range mxs {
+			answers = append(answers, normalize(mx.Host))
+		}
+	case "TXT":
+		txts, err := c.resolver.LookupTXT(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		answers = append(answers, txts...)
+	case "SRV":
+		_, srvs, err := c.resolver.LookupSRV(ctx, "", "", query)
+		if err != nil {
+			return nil, err
+		}
+		for _, srv := range srvs {
+			answers = append(answers, net.JoinHostPort(normalize(srv.Target), strconv.Itoa(int(srv.Port))))
+		}
+	}
+	return answers, nil
+}
+
+// missingAnswers returns the expected answers that are not part of the answers
+func missingAnswers(expected, answers []string) []string {
+	found := make(map[string]struct{}, len(answers))
+	for _, answer := range answers {
+		found[normalize(answer)] = struct{}{}
+	}
+
+	var missing []string
+	for _, expect := range expected {
+		if _, ok := found[normalize(expect)]; !ok {
+			missing = append(missing, expect)
+		}
+	}
+	return missing
+}
+
+// normalize removes the root label of domain names
+func normalize(answer string) string {
+	return strings.TrimSuffix(answer, ".")
+}
+
+// NewDNSChecker create a DNS checker
+func NewDNSChecker(conf interface{}, pluginConf interface{}) (plugins.Checker, error) {
+	out, err := yaml.Marshal(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := dnsConfig{}
+	err = yaml.Unmarshal(out, &cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Server != "" {
+		log.Infof("dns: Checker %s activated for %q using resolver %s", cfg.RecordType, cfg.Query, cfg.Server)
+	} else {
+		log.Infof("dns: Checker %s activated for %q", cfg.RecordType, cfg.Query)
+	}
+
+	return &DNSChecker{
+		cfg:      cfg,
+		resolver: net.DefaultResolver,
+	}, nil
+}
@@ -0,0 +1,253 @@
+package dns
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rbeuque74/jagozzi/plugins"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeRecord struct {
+	rrtype uint16
+	rdata  []byte
+}
+
+// fakeZone are the records served by the fake DNS server, by lowercase absolute name
+var fakeZone = map[string][]fakeRecord{
+	"jagozzi.test.": {
+		{typeA, net.ParseIP("192.0.2.1").To4()},
+		{typeA, net.ParseIP("192.0.2.2").To4()},
+		{typeAAAA, net.ParseIP("2001:db8::1")},
+		{typeMX, append([]byte{0, 10}, encodeName("mx.jagozzi.test.")...)},
+		{typeTXT, append([]byte{byte(len("v=spf1 -all"))}, "v=spf1 -all"...)},
+	},
+	"www.jagozzi.test.": {
+		{typeCNAME, encodeName("jagozzi.test.")},
+	},
+	"_http._tcp.jagozzi.test.": {
+		{typeSRV, append([]byte{0, 10, 0, 5, 0x1f, 0x90}, encodeName("jagozzi.test.")...)},
+	},
+}
+
+func encodeName(name string) []byte {
+	var b []byte
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+	return append(b, 0)
+}
+
+// newDNSServer starts a tiny UDP DNS server answering from fakeZone
+func newDNSServer(t *testing.T) (string, func()) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if response := answer(buf[:n]); response != nil {
+				conn.WriteTo(response, addr)
+			}
+		}
+	}()
+
+	return conn.LocalAddr().String(), func() {
+		conn.Close()
+	}
+}
+
+func answer(query []byte) []byte {
+	if len(query) < 12 {
+		return nil
+	}
+
+	// reading question name
+	var labels []string
+	offset := 12
+	for offset < len(query) && query[offset] != 0 {
+		length := int(query[offset])
+		if offset+1+length > len(query) {
+			return nil
+		}
+		labels = append(labels, string(query[offset+1:offset+1+length]))
+		offset += 1 + length
+	}
+	offset++
+	if offset+4 > len(query) {
+		return nil
+	}
+	name := strings.ToLower(strings.Join(labels, ".")) + "."
+	qtype := binary.BigEndian.Uint16(query[offset : offset+2])
+	question := query[12 : offset+4]
+
+	records, ok := fakeZone[name]
+	var answers []fakeRecord
+	for _, record := range records {
+		if record.rrtype == qtype || record.rrtype == typeCNAME {
+			answers = append(answers, record)
+		}
+	}
+
+	response := make([]byte, 12, 512)
+	copy(response[0:2], query[0:2])
+	// response, recursion desired and available, NXDOMAIN for unknown names
+	flags := uint16(0x8180)
+	if !ok {
+		flags |= 3
+	}
+	binary.BigEndian.PutUint16(response[2:4], flags)
+	binary.BigEndian.PutUint16(response[4:6], 1)
+	binary.BigEndian.PutUint16(response[6:8], uint16(len(answers)))
+	response = append(response, question...)
+
+	for _, record := range answers {
+		rr := make([]byte, 12)
+		// pointer to question name
+		binary.BigEndian.PutUint16(rr[0:2], 0xc00c)
+		binary.BigEndian.PutUint16(rr[2:4], record.rrtype)
+		binary.BigEndian.PutUint16(rr[4:6], 1)
+		binary.BigEndian.PutUint32(rr[6:10], 60)
+		binary.BigEndian.PutUint16(rr[10:12], uint16(len(record.rdata)))
+		response = append(response, rr...)
+		response = append(response, record.rdata...)
+	}
+	return response
+}
+
+func runChecker(t *testing.T, cfg map[string]interface{}) plugins.Result {
+	checker, err := NewDNSChecker(cfg, nil)
+	assert.Nilf(t, err, "dns checker instantiation failed: %q", err)
+	if err != nil {
+		t.FailNow()
+	}
+
+	ctxRun, cancelFunc := context.WithTimeout(context.Background(), time.Second)
+	defer cancelFunc()
+	return checker.Run(ctxRun)
+}
+
+func TestDNS(t *testing.T) {
+	server, shutdown := newDNSServer(t)
+	defer shutdown()
+
+	cfg := map[string]interface{}{
+		"query":  "jagozzi.test",
+		"server": server,
+		"warn":   200,
+		"crit":   400,
+		"name":   "test-1",
+	}
+	checker, err := NewDNSChecker(cfg, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "DNS", checker.Name())
+	assert.Equal(t, "test-1", checker.ServiceName())
+
+	result := runChecker(t, cfg)
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+	assert.Containsf(t, result.Message, "jagozzi.test A: 192.0.2.1, 192.0.2.2", "dns bad message: %q", result.Message)
+	if assert.Len(t, result.PerfData, 2) {
+		assert.Equal(t, "time", result.PerfData[0].Label)
+		assert.Equal(t, "0.2", result.PerfData[0].Warning)
+		assert.Equal(t, "answers=2;;;0", result.PerfData[1].String())
+	}
+
+	cases := []struct {
+		recordType string
+		query      string
+		expect     []string
+	}{
+		{"aaaa", "jagozzi.test", []string{"2001:db8::1"}},
+		{"CNAME", "www.jagozzi.test", []string{"jagozzi.test."}},
+		{"MX", "jagozzi.test", []string{"mx.jagozzi.test"}},
+		{"TXT", "jagozzi.test", []string{"v=spf1 -all"}},
+		{"SRV", "_http._tcp.jagozzi.test", []string{"jagozzi.test:8080"}},
+	}
+	for _, tc := range cases {
+		cfg["record_type"] = tc.recordType
+		cfg["query"] = tc.query
+		cfg["expect"] = tc.expect
+		result = runChecker(t, cfg)
+		assert.Equalf(t, plugins.STATE_OK, result.Status, "%s record: %s", tc.recordType, result.Message)
+	}
+}
+
+func TestDNSFails(t *testing.T) {
+	server, shutdown := newDNSServer(t)
+	defer shutdown()
+
+	cfg := map[string]interface{}{
+		"query":  "jagozzi.test",
+		"server": server,
+		"expect": []string{"192.0.2.1", "192.0.2.3"},
+		"name":   "test-1",
+	}
+	result := runChecker(t, cfg)
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+	assert.Containsf(t, result.Message, "expected answers not found: 192.0.2.3", "dns bad message: %q", result.Message)
+
+	// minimum answers
+	delete(cfg, "expect")
+	cfg["min_answers"] = 3
+	result = runChecker(t, cfg)
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+	assert.Containsf(t, result.Message, "2 answers instead of at least 3", "dns bad message: %q", result.Message)
+
+	// no CNAME record
+	cfg["record_type"] = "CNAME"
+	delete(cfg, "min_answers")
+	result = runChecker(t, cfg)
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+	assert.Containsf(t, result.Message, "0 answers instead of at least 1", "dns bad message: %q", result.Message)
+
+	// no answer expected
+	cfg["min_answers"] = 0
+	result = runChecker(t, cfg)
+	assert.Equalf(t, plugins.STATE_OK, result.Status, "dns bad message: %q", result.Message)
+	delete(cfg, "min_answers")
+	delete(cfg, "record_type")
+
+	// hosts file is not read when a server is configured
+	cfg["query"] = "localhost"
+	result = runChecker(t, cfg)
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+	assert.Containsf(t, result.Message, "unable to resolve localhost (A)", "dns bad message: %q", result.Message)
+
+	// unknown domain
+	cfg["query"] = "unknown.jagozzi.test"
+	result = runChecker(t, cfg)
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+	assert.Containsf(t, result.Message, "unable to resolve unknown.jagozzi.test (A)", "dns bad message: %q", result.Message)
+
+	// invalid record type
+	cfg["record_type"] = "PTR"
+	_, err := NewDNSChecker(cfg, nil)
+	assert.NotNil(t, err)
+}
+
+func TestReadNameMalformed(t *testing.T) {
+	// pointer to itself
+	_, _, err := readName([]byte{0xc0, 0x00}, 0)
+	assert.Equal(t, errMalformed, err)
+
+	// label longer than message
+	_, _, err = readName([]byte{0x05, 'a', 'b'}, 0)
+	assert.Equal(t, errMalformed, err)
+
+	name, next, err := readName(append(encodeName("jagozzi.test."), 0xc0, 0x00), 14)
+	assert.Nil(t, err)
+	assert.Equal(t, "jagozzi.test.", name)
+	assert.Equal(t, 16, next)
+}
@@ -0,0 +1,269 @@
+package dns
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// DNS record types, RFC 1035 and RFC 3596
+const (
+	typeA     uint16 = 1
+	typeCNAME uint16 = 5
+	typeMX    uint16 = 15
+	typeTXT   uint16 = 16
+	typeAAAA  uint16 = 28
+	typeSRV   uint16 = 33
+)
+
+// recordTypes are the DNS types of the record types of configuration
+var recordTypes = map[string]uint16{
+	"A":     typeA,
+	"AAAA":  typeAAAA,
+	"CNAME": typeCNAME,
+	"MX":    typeMX,
+	"TXT":   typeTXT,
+	"SRV":   typeSRV,
+}
+
+// response codes of DNS header
+const (
+	rcodeSuccess  = 0
+	rcodeNXDomain = 3
+)
+
+// maxUDPSize is the maximum size of a DNS message sent over UDP without EDNS
+const maxUDPSize = 512
+
+// errMalformed is returned when a DNS response can't be parsed
+var errMalformed = errors.New("malformed DNS response")
+
+// exchange sends the query directly to server, without reading hosts file as system resolver does, and returns the
+// answers of the queried type; truncated UDP responses are queried again using TCP
+func exchange(ctx context.Context, server, name, recordType string) ([]string, error) {
+	qtype := recordTypes[recordType]
+	query := newQuery(name, qtype)
+
+	response, err := exchangeUDP(ctx, server, query)
+	if err != nil {
+		return nil, err
+	}
+	// truncated flag
+	if response[2]&0x02 != 0 {
+		if response, err = exchangeTCP(ctx, server, query); err != nil {
+			return nil, err
+		}
+	}
+
+	return parseResponse(response, query, qtype)
+}
+
+// newQuery builds a DNS query message with recursion desired for a single question
+func newQuery(name string, qtype uint16) []byte {
+	query := make([]byte, 12, maxUDPSize)
+	binary.BigEndian.PutUint16(query[0:2], uint16(rand.Intn(1<<16)))
+	// recursion desired
+	binary.BigEndian.PutUint16(query[2:4], 0x0100)
+	binary.BigEndian.PutUint16(query[4:6], 1)
+
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		query = append(query, byte(len(label)))
+		query = append(query, label...)
+	}
+	query = append(query, 0)
+	// question type and internet class
+	query = append(query, byte(qtype>>8), byte(qtype), 0, 1)
+	return query
+}
+
+func exchangeUDP(ctx context.Context, server string, query []byte) ([]byte, error) {
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "udp", server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, maxUDPSize)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		// ignoring responses to other queries
+		if n >= 12 && buf[0] == query[0] && buf[1] == query[1] {
+			return buf[:n], nil
+		}
+	}
+}
+
+func exchangeTCP(ctx context.Context, server string, query []byte) ([]byte, error) {
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	// messages are prefixed by their length over TCP
+	message := append([]byte{byte(len(query) >> 8), byte(len(query))}, query...)
+	if _, err := conn.Write(message); err != nil {
+		return nil, err
+	}
+
+	length := make([]byte, 2)
+	if _, err := io.ReadFull(conn, length); err != nil {
+		return nil, err
+	}
+	response := make([]byte, binary.BigEndian.Uint16(length))
+	if _, err := io.ReadFull(conn, response); err != nil {
+		return nil, err
+	}
+	if len(response) < 12 || response[0] != query[0] || response[1] != query[1] {
+		return nil, errMalformed
+	}
+	return response, nil
+}
+
+// parseResponse returns the answers of the queried type, formatted as strings
+func parseResponse(response, query []byte, qtype uint16) ([]string, error) {
+	switch rcode := response[3] & 0x0f; rcode {
+	case rcodeSuccess:
+	case rcodeNXDomain:
+		return nil, errors.New("no such host")
+	default:
+		return nil, fmt.Errorf("server answered with error code %d", rcode)
+	}
+
+	questions := int(binary.BigEndian.Uint16(response[4:6]))
+	records := int(binary.BigEndian.Uint16(response[6:8]))
+
+	offset := 12
+	for i := 0; i < questions; i++ {
+		var err error
+		if _, offset, err = readName(response, offset); err != nil {
+			return nil, err
+		}
+		offset += 4
+	}
+
+	var answers []string
+	for i := 0; i < records; i++ {
+		_, next, err := readName(response, offset)
+		if err != nil {
+			return nil, err
+		}
+		if next+10 > len(response) {
+			return nil, errMalformed
+		}
+		rrtype := binary.BigEndian.Uint16(response[next : next+2])
+		length := int(binary.BigEndian.Uint16(response[next+8 : next+10]))
+		start, end := next+10, next+10+length
+		if end > len(response) {
+			return nil, errMalformed
+		}
+		offset = end
+
+		// records of other types are part of a CNAME chain
+		if rrtype != qtype {
+			continue
+		}
+		answer, err := parseRecord(response, start, end, rrtype)
+		if err != nil {
+			return nil, err
+		}
+		answers = append(answers, answer)
+	}
+	return answers, nil
+}
+
+// parseRecord formats the data of a record found between start and end of message
+func parseRecord(message []byte, start, end int, rrtype uint16) (string, error) {
+	rdata := message[start:end]
+	switch rrtype {
+	case typeA, typeAAAA:
+		if len(rdata) != net.IPv4len && len(rdata) != net.IPv6len {
+			return "", errMalformed
+		}
+		return net.IP(rdata).String(), nil
+	case typeCNAME:
+		name, _, err := readName(message, start)
+		return normalize(name), err
+	case typeMX:
+		if len(rdata) < 3 {
+			return "", errMalformed
+		}
+		name, _, err := readName(message, start+2)
+		return normalize(name), err
+	case typeSRV:
+		if len(rdata) < 7 {
+			return "", errMalformed
+		}
+		port := binary.BigEndian.Uint16(rdata[4:6])
+		name, _, err := readName(message, start+6)
+		return net.JoinHostPort(normalize(name), strconv.Itoa(int(port))), err
+	default:
+		// character strings of a TXT record are concatenated, as system resolver does
+		var txt []byte
+		for i := 0; i < len(rdata); {
+			length := int(rdata[i])
+			if i+1+length > len(rdata) {
+				return "", errMalformed
+			}
+			txt = append(txt, rdata[i+1:i+1+length]...)
+			i += 1 + length
+		}
+		return string(txt), nil
+	}
+}
+
+// readName reads a possibly compressed domain name at offset, returning the name and the offset following it
+func readName(message []byte, offset int) (string, int, error) {
+	var labels []string
+	next := -1
+	// bounding pointers followed, to prevent loops
+	for jumps := 0; jumps < 64; jumps++ {
+		if offset >= len(message) {
+			return "", 0, errMalformed
+		}
+		length := int(message[offset])
+		switch {
+		case length == 0:
+			if next < 0 {
+				next = offset + 1
+			}
+			return strings.Join(labels, ".") + ".", next, nil
+		case length&0xc0 == 0xc0:
+			if offset+2 > len(message) {
+				return "", 0, errMalformed
+			}
+			if next < 0 {
+				next = offset + 2
+			}
+			offset = int(binary.BigEndian.Uint16(message[offset:offset+2]) & 0x3fff)
+		default:
+			if offset+1+length > len(message) {
+				return "", 0, errMalformed
+			}
+			labels = append(labels, string(message[offset+1:offset+1+length]))
+			offset += 1 + length
+		}
+	}
+	return "", 0, errMalformed
+}
@@ -0,0 +1,349 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/rbeuque74/jagozzi/config"
+	"github.com/rbeuque74/jagozzi/plugins"
+)
+
+// jsonPathOperators are the comparison operators available in JSONPath assertions; longest operators first
+var jsonPathOperators = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+type rawAssertion struct {
+	// Contains is a substring that the response body must contain
+	Contains string `json:"contains"`
+	// Regexp is a regular expression that the response body must match
+	Regexp string `json:"regexp"`
+	// JSONPath is an expression such as `$.status == "ok"` evaluated against the JSON response body;
+	// without comparison, the path must exist
+	JSONPath string `json:"jsonpath"`
+	// Negate inverts the assertion
+	Negate bool `json:"negate"`
+	// Severity is the status reported when assertion fails: warning or critical (default)
+	Severity string `json:"severity"`
+}
+
+type assertion struct {
+	rawAssertion
+	regexp   *regexp.Regexp
+	jsonPath *jsonPath
+}
+
+func (a *assertion) UnmarshalJSON(b []byte) error {
+	raw := rawAssertion{}
+	if err := config.UnmarshalConfig(b, &raw); err != nil {
+		return err
+	}
+
+	a.rawAssertion = raw
+	return a.compile()
+}
+
+// compile parses the assertion expression
+func (a *assertion) compile() error {
+	switch a.Severity {
+	case "":
+		a.Severity = "critical"
+	case "warning", "critical":
+	default:
+		return fmt.Errorf("assertion severity must be warning or critical, not %q", a.Severity)
+	}
+
+	defined := 0
+	for _, expr := range []string{a.Contains, a.Regexp, a.JSONPath} {
+		if expr != "" {
+			defined++
+		}
+	}
+	if defined != 1 {
+		return fmt.Errorf("assertion must define exactly one of contains, regexp or jsonpath keys")
+	}
+
+	var err error
+	if a.Regexp != "" {
+		if a.regexp, err = regexp.Compile(a.Regexp); err != nil {
+			return fmt.Errorf("assertion regexp: %s", err)
+		}
+	} else if a.JSONPath != "" {
+		if a.jsonPath, err = parseJSONPath(a.JSONPath); err != nil {
+			return fmt.Errorf("assertion jsonpath: %s", err)
+		}
+	}
+	return nil
+}
+
+// Expression returns the expression of the assertion, as written in configuration file
+func (a assertion) Expression() string {
+	var expr string
+	switch {
+	case a.regexp != nil:
+		expr = fmt.Sprintf("regexp %q", a.Regexp)
+	case a.jsonPath != nil:
+		expr = a.JSONPath
+	default:
+		expr = fmt.Sprintf("contains %q", a.Contains)
+	}
+
+	if a.Negate {
+		return "not " + expr
+	}
+	return expr
+}
+
+// status returns the status reported when assertion fails
+func (a assertion) status() plugins.StatusEnum {
+	if a.Severity == "warning" {
+		return plugins.STATE_WARNING
+	}
+	return plugins.STATE_CRITICAL
+}
+
+// assertionResult is the result of an assertion evaluated on a response body, available in templates
+type assertionResult struct {
+	// Expression is the assertion expression
+	Expression string
+	// Value is the value matched in the response body, if any
+	Value string
+	// Found is true if the value has been matched in the response body
+	Found bool
+	// Success is true if the assertion is respected
+	Success bool
+	// Err explains why the assertion failed
+	Err error
+}
+
+// evaluate checks the assertion on a response body; jsonBody is the decoded body when isJSON is true
+func (a assertion) evaluate(body []byte, jsonBody interface{}, isJSON bool) assertionResult {
+	res := assertionResult{
+		Expression: a.Expression(),
+	}
+
+	var success bool
+	switch {
+	case a.regexp != nil:
+		match := a.regexp.Find(body)
+		res.Found = match != nil
+		res.Value = string(match)
+		success = res.Found
+	case a.jsonPath != nil:
+		if !isJSON {
+			res.Err = fmt.Errorf("%s: response body is not valid JSON", res.Expression)
+			return res
+		}
+		value, found := a.jsonPath.lookup(jsonBody)
+		res.Found = found
+		if found {
+			res.Value = formatJSONValue(value)
+		}
+		var err error
+		if success, err = a.jsonPath.compare(value, found); err != nil {
+			res.Err = fmt.Errorf("%s: %s", res.Expression, err)
+			return res
+		}
+	default:
+		res.Found = strings.Contains(string(body), a.Contains)
+		if res.Found {
+			res.Value = a.Contains
+		}
+		success = res.Found
+	}
+
+	res.Success = success != a.Negate
+	if !res.Success {
+		switch {
+		case a.jsonPath != nil && res.Found:
+			res.Err = fmt.Errorf("%s failed: value is %s", res.Expression, res.Value)
+		case a.Negate && res.Value != "":
+			res.Err = fmt.Errorf("%s failed: %q found in response body", res.Expression, res.Value)
+		default:
+			res.Err = fmt.Errorf("%s failed: not found in response body", res.Expression)
+		}
+	}
+	return res
+}
+
+type pathStep struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+// jsonPath is a subset of JSONPath: dotted keys, bracket keys and array indexes, followed by an optional comparison
+type jsonPath struct {
+	steps    []pathStep
+	operator string
+	operand  interface{}
+}
+
+func parseJSONPath(expr string) (*jsonPath, error) {
+	s := strings.TrimSpace(expr)
+	path := &jsonPath{}
+
+	i := 0
+	if strings.HasPrefix(s, "$") {
+		i++
+	} else if s != "" && s[0] != '.' && s[0] != '[' {
+		// gjson style path, without root
+		s = "." + s
+	}
+
+	for i < len(s) {
+		switch s[i] {
+		case '.':
+			end := i + 1
+			for end < len(s) && !strings.ContainsRune(".[ \t=!<>", rune(s[end])) {
+				end++
+			}
+			if end == i+1 {
+				return nil, fmt.Errorf("empty key at position %d in %q", i, expr)
+			}
+			path.steps = append(path.steps, pathStep{key: s[i+1 : end]})
+			i = end
+		case '[':
+			end := strings.IndexByte(s[i:], ']')
+			if end == -1 {
+				return nil, fmt.Errorf("missing ] in %q", expr)
+			}
+			content := strings.TrimSpace(s[i+1 : i+end])
+			if len(content) >= 2 && (content[0] == '\'' || content[0] == '"') && content[len(content)-1] == content[0] {
+				path.steps = append(path.steps, pathStep{key: content[1 : len(content)-1]})
+			} else {
+				index, err := strconv.Atoi(content)
+				if err != nil {
+					return nil, fmt.Errorf("invalid index %q in %q", content, expr)
+				}
+				path.steps = append(path.steps, pathStep{index: index, isIndex: true})
+			}
+			i += end + 1
+		default:
+			return path, path.parseComparison(expr, strings.TrimSpace(s[i:]))
+		}
+	}
+	return path, nil
+}
+
+// parseComparison parses the comparison following the path, such as `== "ok"` or `< 100`
+func (path *jsonPath) parseComparison(expr, comparison string) error {
+	for _, operator := range jsonPathOperators {
+		if !strings.HasPrefix(comparison, operator) {
+			continue
+		}
+
+		operand := strings.TrimSpace(strings.TrimPrefix(comparison, operator))
+		if strings.HasPrefix(operand, "'") && strings.HasSuffix(operand, "'") && len(operand) >= 2 {
+			path.operand = operand[1 : len(operand)-1]
+		} else if err := json.Unmarshal([]byte(operand), &path.operand); err != nil {
+			return fmt.Errorf("invalid value %q in %q: strings must be quoted", operand, expr)
+		}
+		path.operator = operator
+
+		if _, isNumber := path.operand.(float64); !isNumber && operator != "==" && operator != "!=" {
+			if _, isString := path.operand.(string); !isString {
+				return fmt.Errorf("operator %s needs a number or a string in %q", operator, expr)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("invalid comparison %q in %q", comparison, expr)
+}
+
+// lookup returns the value pointed by the path in a decoded JSON document
+func (path jsonPath) lookup(document interface{}) (interface{}, bool) {
+	current := document
+	for _, step := range path.steps {
+		if step.isIndex {
+			array, ok := current.([]interface{})
+			if !ok {
+				return nil, false
+			}
+			index := step.index
+			if index < 0 {
+				index = len(array) + index
+			}
+			if index < 0 || index >= len(array) {
+				return nil, false
+			}
+			current = array[index]
+			continue
+		}
+
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = object[step.key]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// compare applies the comparison on the value found
+func (path jsonPath) compare(value interface{}, found bool) (bool, error) {
+	if path.operator == "" || !found {
+		return found, nil
+	}
+
+	switch path.operator {
+	case "==":
+		return jsonEqual(value, path.operand), nil
+	case "!=":
+		return !jsonEqual(value, path.operand), nil
+	}
+
+	var cmp int
+	switch operand := path.operand.(type) {
+	case float64:
+		number, ok := value.(float64)
+		if !ok {
+			return false, fmt.Errorf("value %s is not a number", formatJSONValue(value))
+		}
+		switch {
+		case number < operand:
+			cmp = -1
+		case number > operand:
+			cmp = 1
+		}
+	case string:
+		str, ok := value.(string)
+		if !ok {
+			return false, fmt.Errorf("value %s is not a string", formatJSONValue(value))
+		}
+		cmp = strings.Compare(str, operand)
+	}
+
+	switch path.operator {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	default:
+		return cmp >= 0, nil
+	}
+}
+
+func jsonEqual(a, b interface{}) bool {
+	aJSON, errA := json.Marshal(a)
+	bJSON, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(aJSON, bJSON)
+}
+
+// formatJSONValue renders a decoded JSON value: strings are rendered as is, other values as JSON
+func formatJSONValue(value interface{}) string {
+	if str, ok := value.(string); ok {
+		return str
+	}
+	out, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(out)
+}
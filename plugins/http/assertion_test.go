@@ -0,0 +1,60 @@
+package http
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONPathAssertion(t *testing.T) {
+	body := []byte(`{"status":"ok","queue":{"depth":42},"nodes":[{"name":"a"},{"name":"b"}],"dotted.key":true,"empty":null}`)
+	var document interface{}
+	assert.Nil(t, json.Unmarshal(body, &document))
+
+	cases := []struct {
+		expr    string
+		negate  bool
+		success bool
+		value   string
+	}{
+		{`$.status == "ok"`, false, true, "ok"},
+		{`$.status != "ok"`, false, false, "ok"},
+		{`status == 'ok'`, false, true, "ok"},
+		{`$.queue.depth < 100`, false, true, "42"},
+		{`$.queue.depth >= 42`, false, true, "42"},
+		{`$.queue.depth > 42`, false, false, "42"},
+		{`$.queue`, false, true, `{"depth":42}`},
+		{`$.nodes[1].name == "b"`, false, true, "b"},
+		{`$.nodes[-1]['name'] == "b"`, false, true, "b"},
+		{`$["dotted.key"] == true`, false, true, "true"},
+		{`$.empty == null`, false, true, "null"},
+		{`$.missing`, false, false, ""},
+		{`$.missing`, true, true, ""},
+		{`$.status == "ok"`, true, false, "ok"},
+		{`$.status < 10`, false, false, "ok"},
+	}
+
+	for _, tc := range cases {
+		a := assertion{rawAssertion: rawAssertion{JSONPath: tc.expr, Negate: tc.negate}}
+		if !assert.Nilf(t, a.compile(), "expression %q", tc.expr) {
+			continue
+		}
+
+		res := a.evaluate(body, document, true)
+		assert.Equalf(t, tc.success, res.Success, "expression %q: %v", tc.expr, res.Err)
+		assert.Equalf(t, tc.value, res.Value, "expression %q", tc.expr)
+	}
+
+	for _, expr := range []string{`$.status == ok`, `$.nodes[a]`, `$.status ~ "ok"`, `$..status`, `$.queue.depth < true`} {
+		a := assertion{rawAssertion: rawAssertion{JSONPath: expr}}
+		assert.NotNilf(t, a.compile(), "expression %q", expr)
+	}
+
+	// body is not JSON
+	a := assertion{rawAssertion: rawAssertion{JSONPath: "$.status"}}
+	assert.Nil(t, a.compile())
+	res := a.evaluate([]byte("OK"), nil, false)
+	assert.False(t, res.Success)
+	assert.NotNil(t, res.Err)
+}
@@ -2,7 +2,11 @@ package http
 
 import (
 	"bytes"
+	"crypto/tls"
 	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"text/template"
 	"time"
@@ -19,20 +23,44 @@ type httpConfig struct {
 	Warning   time.Duration `json:"-"`
 	Critical  time.Duration `json:"-"`
 	templates templates
+	// body is the payload sent with the request, from body or body_file keys
+	body []byte
+	// assertions are the checks performed on response body, including content key
+	assertions []assertion
+	tlsConfig  *tls.Config
 }
 
 type rawHTTPConfig struct {
 	config.GenericPluginConfiguration
-	Type         string       `json:"type"`
-	URL          string       `json:"url" validate:"required"`
-	VerifyCACRT  bool         `json:"verify_ca_crt"`
-	Method       string       `json:"method" validate:"required,eq=GET|eq=POST|eq=PUT|eq=DELETE"`
-	Code         int64        `json:"code" default:"200"`
-	Content      string       `json:"content"`
-	RawTimeout   int64        `json:"timeout"`
-	RawWarning   int64        `json:"warn"`
-	RawCritical  int64        `json:"crit"`
-	RawTemplates rawTemplates `json:"templates"`
+	Type            string            `json:"type"`
+	URL             string            `json:"url" validate:"required"`
+	VerifyCACRT     caVerification    `json:"verify_ca_crt"`
+	TLS             rawTLSConfig      `json:"tls"`
+	FollowRedirects *redirectPolicy   `json:"follow_redirects"`
+	Proxy           string            `json:"proxy"`
+	Resolve         map[string]string `json:"resolve"`
+	IPVersion       int               `json:"ip_version" validate:"omitempty,eq=4|eq=6"`
+	Method          string            `json:"method" validate:"required,eq=GET|eq=POST|eq=PUT|eq=DELETE"`
+	Code            int64             `json:"code" default:"200"`
+	Content         string            `json:"content"`
+	Assertions      []assertion       `json:"assertions"`
+	Headers         headers           `json:"headers"`
+	Body            string            `json:"body"`
+	BodyFile        string            `json:"body_file"`
+	BasicAuth       *basicAuth        `json:"basic_auth"`
+	BearerToken     config.Secret     `json:"bearer_token"`
+	RawTimeout      int64             `json:"timeout"`
+	RawWarning      int64             `json:"warn"`
+	RawCritical     int64             `json:"crit"`
+	RawTemplates    rawTemplates      `json:"templates"`
+}
+
+// headers are the headers sent with the request; values can be read from environment variables
+type headers map[string]config.Secret
+
+type basicAuth struct {
+	User     string        `json:"user" validate:"required"`
+	Password config.Secret `json:"password"`
 }
 
 type rawTemplates struct {
@@ -41,6 +69,7 @@ type rawTemplates struct {
 	ErrStatusCode      string `default:"invalid status code: {{.Response.StatusCode}} instead of {{.Cfg.Code}}"`
 	ErrTimeoutCritical string `default:"critical timeout: request took {{.ElapsedTime}} instead of {{.Cfg.Critical}}"`
 	ErrTimeoutWarning  string `default:"timeout: request took {{.ElapsedTime}} instead of {{.Cfg.Warning}}"`
+	ErrAssertion       string `default:"{{.Err}}"`
 }
 
 type templates struct {
@@ -49,6 +78,19 @@ type templates struct {
 	ErrStatusCode      *template.Template `json:"-"`
 	ErrTimeoutCritical *template.Template `json:"-"`
 	ErrTimeoutWarning  *template.Template `json:"-"`
+	ErrAssertion       *template.Template `json:"-"`
+}
+
+// redacted returns a copy of the configuration with secrets redacted, to be used in templates
+func (cfg httpConfig) redacted() httpConfig {
+	if cfg.BasicAuth != nil {
+		auth := *cfg.BasicAuth
+		auth.Password = auth.Password.Redacted()
+		cfg.BasicAuth = &auth
+	}
+	cfg.BearerToken = cfg.BearerToken.Redacted()
+	cfg.Headers = config.RedactedSecrets(cfg.Headers)
+	return cfg
 }
 
 func (cfg *httpConfig) UnmarshalJSON(b []byte) error {
@@ -60,12 +102,46 @@ func (cfg *httpConfig) UnmarshalJSON(b []byte) error {
 
 	defaults.SetDefaults(raw)
 
+	if raw.Body != "" && raw.BodyFile != "" {
+		return errors.New("body and body_file keys are incompatible")
+	}
+	if raw.BasicAuth != nil && raw.BearerToken != "" {
+		return errors.New("basic_auth and bearer_token keys are incompatible")
+	}
+
 	cfg.rawHTTPConfig = *raw
 	cfg.Timeout = time.Duration(raw.RawTimeout) * time.Millisecond
 	cfg.Warning = time.Duration(raw.RawWarning) * time.Millisecond
 	cfg.Critical = time.Duration(raw.RawCritical) * time.Millisecond
 
 	var err error
+	if raw.BodyFile != "" {
+		if cfg.body, err = ioutil.ReadFile(raw.BodyFile); err != nil {
+			return fmt.Errorf("body_file: %s", err)
+		}
+	} else if raw.Body != "" {
+		cfg.body = []byte(raw.Body)
+	}
+
+	if cfg.tlsConfig, err = newTLSConfig(raw.TLS, raw.VerifyCACRT); err != nil {
+		return err
+	}
+
+	for host, ip := range raw.Resolve {
+		if net.ParseIP(ip) == nil {
+			return fmt.Errorf("resolve: invalid IP address %q for host %q", ip, host)
+		}
+	}
+
+	if raw.Content != "" {
+		content := assertion{rawAssertion: rawAssertion{Contains: raw.Content}}
+		if err = content.compile(); err != nil {
+			return err
+		}
+		cfg.assertions = append(cfg.assertions, content)
+	}
+	cfg.assertions = append(cfg.assertions, raw.Assertions...)
+
 	var tmpl *template.Template
 	if tmpl, err = testTemplate("HttpErrNewHTTPRequest", raw.RawTemplates.ErrNewHTTPRequest, true, false, false); err != nil {
 		return err
@@ -92,6 +168,11 @@ func (cfg *httpConfig) UnmarshalJSON(b []byte) error {
 	}
 	cfg.templates.ErrTimeoutWarning = tmpl
 
+	if tmpl, err = testTemplate("HttpErrAssertion", raw.RawTemplates.ErrAssertion, true, true, true); err != nil {
+		return err
+	}
+	cfg.templates.ErrAssertion = tmpl
+
 	validate := validator.New()
 	return validate.Struct(cfg)
 }
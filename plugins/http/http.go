@@ -1,9 +1,11 @@
 package http
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
@@ -49,7 +51,13 @@ type result struct {
 	Request      http.Request
 	ElapsedTime  time.Duration
 	Err          error
-	ResponseBody map[string]string
+	ResponseBody map[string]interface{}
+	// Assertion is the failed assertion
+	Assertion assertionResult
+	// Assertions are the results of all assertions performed on response body
+	Assertions []assertionResult
+	// FinalURL is the URL of the response, after redirects
+	FinalURL string
 }
 
 func (res result) Error() error {
@@ -59,12 +67,17 @@ func (res result) Error() error {
 // Run is performing the checker protocol
 func (c *HTTPChecker) Run(ctx context.Context) plugins.Result {
 	model := result{
-		Cfg:    c.cfg,
+		Cfg:    c.cfg.redacted(),
 		Result: plugins.STATE_CRITICAL,
 		Err:    nil,
 	}
 
-	req, err := http.NewRequest(c.cfg.Method, c.cfg.URL, nil)
+	var body io.Reader
+	if c.cfg.body != nil {
+		body = bytes.NewReader(c.cfg.body)
+	}
+
+	req, err := http.NewRequest(c.cfg.Method, c.cfg.URL, body)
 	if err != nil {
 		model.Err = err
 		err = fmt.Errorf(plugins.RenderError(c.cfg.templates.ErrNewHTTPRequest, model))
@@ -72,15 +85,23 @@ func (c *HTTPChecker) Run(ctx context.Context) plugins.Result {
 	}
 	req = req.WithContext(ctx)
 
-	model.Request = *req
+	for key, value := range c.cfg.Headers {
+		if http.CanonicalHeaderKey(key) == "Host" {
+			req.Host = string(value)
+			continue
+		}
+		req.Header.Set(key, string(value))
+	}
+	if c.cfg.BasicAuth != nil {
+		req.SetBasicAuth(c.cfg.BasicAuth.User, string(c.cfg.BasicAuth.Password))
+	} else if c.cfg.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+string(c.cfg.BearerToken))
+	}
+
+	model.Request = c.scrubRequest(req)
 
 	duration := time.Now()
-	client := &http.Client{}
-	if c.client != nil {
-		client = c.client
-	}
-	client.Timeout = c.cfg.Timeout
-	resp, err := client.Do(req)
+	resp, err := c.client.Do(req)
 	if err != nil {
 		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
 			model.Err = err
@@ -97,15 +118,29 @@ func (c *HTTPChecker) Run(ctx context.Context) plugins.Result {
 	elapsedTime := time.Since(duration).Round(time.Millisecond)
 
 	model.Response = *resp
+	if resp.Request != nil {
+		scrubbed := c.scrubRequest(resp.Request)
+		model.Response.Request = &scrubbed
+	}
+	model.Response.Request = &model.Request
+	model.FinalURL = resp.Request.URL.String()
 	model.ElapsedTime = elapsedTime
-	// remove Authorisation header to prevent credentials leak
-	model.Request.Header.Del("Authorization")
-
-	// try to unmarshal body to map[string] to provide more context for error templating
-	if bodyStr, err := ioutil.ReadAll(resp.Body); err == nil {
-		responseBody := make(map[string]string)
-		if err := json.Unmarshal(bodyStr, &responseBody); err == nil {
-			model.ResponseBody = responseBody
+
+	perfdata := []plugins.PerfData{
+		plugins.NewPerfData("time", elapsedTime.Seconds(), "s").WithThresholds(c.cfg.Warning.Seconds(), c.cfg.Critical.Seconds()).WithMin(0),
+	}
+
+	// try to unmarshal body to provide more context for error templating and assertions
+	var jsonBody interface{}
+	var isJSON bool
+	bodyStr, err := ioutil.ReadAll(resp.Body)
+	if err == nil {
+		perfdata = append(perfdata, plugins.NewPerfData("size", float64(len(bodyStr)), "B").WithMin(0))
+		if err := json.Unmarshal(bodyStr, &jsonBody); err == nil {
+			isJSON = true
+			if responseBody, ok := jsonBody.(map[string]interface{}); ok {
+				model.ResponseBody = responseBody
+			}
 		}
 	}
 
@@ -113,9 +148,19 @@ func (c *HTTPChecker) Run(ctx context.Context) plugins.Result {
 		model.Err = fmt.Errorf("invalid status code: %d instead of %d", resp.StatusCode, c.cfg.Code)
 
 		return plugins.Result{
-			Checker: c,
-			Message: plugins.RenderError(c.cfg.templates.ErrStatusCode, model),
-			Status:  plugins.STATE_CRITICAL,
+			Checker:  c,
+			Message:  plugins.RenderError(c.cfg.templates.ErrStatusCode, model),
+			Status:   plugins.STATE_CRITICAL,
+			PerfData: perfdata,
+		}
+	}
+
+	if status, failed := c.assert(&model, bodyStr, jsonBody, isJSON); failed {
+		return plugins.Result{
+			Checker:  c,
+			Message:  plugins.RenderError(c.cfg.templates.ErrAssertion, model),
+			Status:   status,
+			PerfData: perfdata,
 		}
 	}
 
@@ -123,26 +168,67 @@ func (c *HTTPChecker) Run(ctx context.Context) plugins.Result {
 		model.Err = fmt.Errorf("critical timeout: request took %s instead of %s (%s)", elapsedTime, c.cfg.Critical.Round(time.Millisecond), resp.Status)
 
 		return plugins.Result{
-			Checker: c,
-			Message: plugins.RenderError(c.cfg.templates.ErrTimeoutCritical, model),
-			Status:  plugins.STATE_CRITICAL,
+			Checker:  c,
+			Message:  plugins.RenderError(c.cfg.templates.ErrTimeoutCritical, model),
+			Status:   plugins.STATE_CRITICAL,
+			PerfData: perfdata,
 		}
 	} else if elapsedTime > c.cfg.Warning {
 		model.Err = fmt.Errorf("timeout: request took %s instead of %s (%s)", elapsedTime, c.cfg.Warning.Round(time.Millisecond), resp.Status)
 
 		return plugins.Result{
-			Checker: c,
-			Message: plugins.RenderError(c.cfg.templates.ErrTimeoutWarning, model),
-			Status:  plugins.STATE_WARNING,
+			Checker:  c,
+			Message:  plugins.RenderError(c.cfg.templates.ErrTimeoutWarning, model),
+			Status:   plugins.STATE_WARNING,
+			PerfData: perfdata,
 		}
 	}
 	return plugins.Result{
-		Checker: c,
-		Message: fmt.Sprintf("%s - %s elapsed", resp.Status, elapsedTime),
-		Status:  plugins.STATE_OK,
+		Checker:  c,
+		Message:  fmt.Sprintf("%s - %s elapsed", resp.Status, elapsedTime),
+		Status:   plugins.STATE_OK,
+		PerfData: perfdata,
 	}
 }
 
+// assert evaluates all assertions on response body; the worst failing assertion is reported in the model
+func (c HTTPChecker) assert(model *result, body []byte, jsonBody interface{}, isJSON bool) (plugins.StatusEnum, bool) {
+	status := plugins.STATE_OK
+	failed := false
+	for _, a := range c.cfg.assertions {
+		res := a.evaluate(body, jsonBody, isJSON)
+		model.Assertions = append(model.Assertions, res)
+		if res.Err == nil {
+			continue
+		}
+
+		if !failed || a.status() > status {
+			status = a.status()
+			model.Assertion = res
+			model.Err = res.Err
+		}
+		failed = true
+	}
+	return status, failed
+}
+
+// scrubRequest returns a copy of the request without Authorization header and with configured headers values
+// redacted, to prevent credentials leak in templates
+func (c *HTTPChecker) scrubRequest(req *http.Request) http.Request {
+	scrubbed := *req
+	scrubbed.Header = make(http.Header, len(req.Header))
+	for key, values := range req.Header {
+		scrubbed.Header[key] = values
+	}
+	scrubbed.Header.Del("Authorization")
+	for key, value := range c.cfg.Headers {
+		if scrubbed.Header.Get(key) != "" {
+			scrubbed.Header.Set(key, string(value.Redacted()))
+		}
+	}
+	return scrubbed
+}
+
 // NewHTTPChecker create a HTTP checker
 func NewHTTPChecker(conf interface{}, pluginConf interface{}) (plugins.Checker, error) {
 	out, err := yaml.Marshal(conf)
@@ -156,8 +242,14 @@ func NewHTTPChecker(conf interface{}, pluginConf interface{}) (plugins.Checker,
 		return nil, err
 	}
 
+	client, err := newClient(checks)
+	if err != nil {
+		return nil, err
+	}
+
 	log.Infof("http: Checker activated for %s %q", checks.Method, checks.URL)
 	return &HTTPChecker{
-		cfg: checks,
+		cfg:    checks,
+		client: client,
 	}, nil
 }
@@ -2,6 +2,13 @@ package http
 
 import (
 	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -33,7 +40,7 @@ func TestHTTPServer(t *testing.T) {
 	assert.Nilf(t, err, "http checker instantiation failed: %q", err)
 
 	checker := genChecker.(*HTTPChecker)
-	checker.client = &httpclient
+	checker.client.Transport = httpclient.Transport
 
 	assert.Equal(t, "HTTP", checker.Name())
 	assert.Equal(t, "test-1", checker.ServiceName())
@@ -44,6 +51,12 @@ func TestHTTPServer(t *testing.T) {
 	result := checker.Run(ctxRun)
 	assert.Equal(t, plugins.STATE_OK, result.Status)
 	assert.Containsf(t, result.Message, "200 OK", "http bad message: %q", result.Message)
+	if assert.Len(t, result.PerfData, 2) {
+		assert.Equal(t, "time", result.PerfData[0].Label)
+		assert.Equal(t, "0.2", result.PerfData[0].Warning)
+		assert.Equal(t, "0.4", result.PerfData[0].Critical)
+		assert.Equal(t, "size=3B;;;0", result.PerfData[1].String())
+	}
 }
 
 func TestHTTPServerFails(t *testing.T) {
@@ -71,7 +84,7 @@ func TestHTTPServerFails(t *testing.T) {
 	assert.Nilf(t, err, "http checker instantiation failed: %q", err)
 
 	checker := genChecker.(*HTTPChecker)
-	checker.client = &httpclient
+	checker.client.Transport = httpclient.Transport
 
 	ctxRun, cancelFunc1 := context.WithTimeout(context.Background(), time.Second)
 	defer cancelFunc1()
@@ -87,7 +100,7 @@ func TestHTTPServerFails(t *testing.T) {
 	assert.Nilf(t, err, "http checker instantiation failed: %q", err)
 
 	checker = genChecker.(*HTTPChecker)
-	checker.client = &httpclient
+	checker.client.Transport = httpclient.Transport
 
 	ctxRun, cancelFunc1 = context.WithTimeout(context.Background(), time.Second)
 	defer cancelFunc1()
@@ -103,7 +116,7 @@ func TestHTTPServerFails(t *testing.T) {
 	assert.Nilf(t, err, "http checker instantiation failed: %q", err)
 
 	checker = genChecker.(*HTTPChecker)
-	checker.client = &httpclient
+	checker.client.Transport = httpclient.Transport
 
 	ctxRun, cancelFunc1 = context.WithTimeout(context.Background(), time.Second)
 	defer cancelFunc1()
@@ -119,7 +132,7 @@ func TestHTTPServerFails(t *testing.T) {
 	assert.Nilf(t, err, "http checker instantiation failed: %q", err)
 
 	checker = genChecker.(*HTTPChecker)
-	checker.client = &httpclient
+	checker.client.Transport = httpclient.Transport
 
 	ctxRun, cancelFunc1 = context.WithTimeout(context.Background(), time.Second)
 	defer cancelFunc1()
@@ -133,7 +146,7 @@ func TestHTTPServerFails(t *testing.T) {
 	assert.Nilf(t, err, "http checker instantiation failed: %q", err)
 
 	checker = genChecker.(*HTTPChecker)
-	checker.client = &httpclient
+	checker.client.Transport = httpclient.Transport
 	checker.cfg.Method = "http not valid method"
 
 	ctxRun, cancelFunc1 = context.WithTimeout(context.Background(), time.Second)
@@ -148,7 +161,7 @@ func TestHTTPServerFails(t *testing.T) {
 	assert.Nilf(t, err, "http checker instantiation failed: %q", err)
 
 	checker = genChecker.(*HTTPChecker)
-	checker.client = &httpclient
+	checker.client.Transport = httpclient.Transport
 
 	ctxRun, cancelFunc1 = context.WithTimeout(context.Background(), time.Second)
 	defer cancelFunc1()
@@ -188,7 +201,7 @@ func TestHTTPServerFailsTemplating(t *testing.T) {
 	assert.Nilf(t, err, "http checker instantiation failed: %q", err)
 
 	checker := genChecker.(*HTTPChecker)
-	checker.client = &httpclient
+	checker.client.Transport = httpclient.Transport
 
 	ctxRun, cancelFunc1 := context.WithTimeout(context.Background(), time.Second)
 	defer cancelFunc1()
@@ -204,7 +217,7 @@ func TestHTTPServerFailsTemplating(t *testing.T) {
 	assert.Nilf(t, err, "http checker instantiation failed: %q", err)
 
 	checker = genChecker.(*HTTPChecker)
-	checker.client = &httpclient
+	checker.client.Transport = httpclient.Transport
 
 	ctxRun, cancelFunc1 = context.WithTimeout(context.Background(), time.Second)
 	defer cancelFunc1()
@@ -242,7 +255,7 @@ func TestHTTPServerFailsTemplatingJSON(t *testing.T) {
 	assert.Nilf(t, err, "http checker instantiation failed: %q", err)
 
 	checker := genChecker.(*HTTPChecker)
-	checker.client = &httpclient
+	checker.client.Transport = httpclient.Transport
 
 	ctxRun, cancelFunc1 := context.WithTimeout(context.Background(), time.Second)
 	defer cancelFunc1()
@@ -251,3 +264,473 @@ func TestHTTPServerFailsTemplatingJSON(t *testing.T) {
 	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
 	assert.Equal(t, "error while fetching: json message field", result.Message)
 }
+
+func TestHTTPServerRequest(t *testing.T) {
+	// creating HTTP server
+	var receivedReq *http.Request
+	var receivedBody []byte
+	srvcfg := FakeTestHTTPServer{
+		StatusCode: 200,
+		OnRequest: func(req *http.Request, body []byte) {
+			receivedReq = req
+			receivedBody = body
+		},
+	}
+	url, httpclient, shutdown := NewHTTPServer(t, srvcfg)
+	defer shutdown()
+
+	time.Sleep(20 * time.Millisecond)
+
+	os.Setenv("JAGOZZI_TEST_PASSWORD", "s3cr3t")
+	defer os.Unsetenv("JAGOZZI_TEST_PASSWORD")
+
+	// creating HTTP checker
+	cfg := map[string]interface{}{
+		"type":    "request",
+		"url":     url,
+		"method":  "POST",
+		"warn":    200,
+		"crit":    400,
+		"timeout": 450,
+		"name":    "test-1",
+		"headers": map[string]string{
+			"Content-Type": "application/json",
+			"X-Api-Key":    "env:JAGOZZI_TEST_PASSWORD",
+		},
+		"body": `{"ping":true}`,
+		"basic_auth": map[string]string{
+			"user":     "jagozzi",
+			"password": "env:JAGOZZI_TEST_PASSWORD",
+		},
+		"templates": map[string]string{
+			"ErrStatusCode": "{{.Request.Header}} {{.Response.Request.Header}} {{.Cfg.Headers}} {{.Cfg.BasicAuth}} {{.Cfg.BearerToken}}",
+		},
+	}
+	genChecker, err := NewHTTPChecker(cfg, nil)
+	assert.Nilf(t, err, "http checker instantiation failed: %q", err)
+
+	checker := genChecker.(*HTTPChecker)
+	checker.client.Transport = httpclient.Transport
+
+	ctxRun, cancelFunc1 := context.WithTimeout(context.Background(), time.Second)
+	defer cancelFunc1()
+
+	result := checker.Run(ctxRun)
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+	if assert.NotNil(t, receivedReq) {
+		assert.Equal(t, "POST", receivedReq.Method)
+		assert.Equal(t, "application/json", receivedReq.Header.Get("Content-Type"))
+		assert.Equal(t, "s3cr3t", receivedReq.Header.Get("X-Api-Key"))
+		user, password, ok := receivedReq.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "jagozzi", user)
+		assert.Equal(t, "s3cr3t", password)
+		assert.Equal(t, `{"ping":true}`, string(receivedBody))
+	}
+
+	// Authorization header and secrets are not available in templates
+	cfg["code"] = 400
+	genChecker, err = NewHTTPChecker(cfg, nil)
+	assert.Nilf(t, err, "http checker instantiation failed: %q", err)
+
+	checker = genChecker.(*HTTPChecker)
+	checker.client.Transport = httpclient.Transport
+
+	result = checker.Run(ctxRun)
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+	assert.Contains(t, result.Message, "X-Api-Key")
+	assert.NotContains(t, result.Message, "Authorization")
+	assert.NotContains(t, result.Message, "s3cr3t")
+	assert.Contains(t, result.Message, "<redacted>")
+
+	// bearer token and body file
+	bodyFile, err := ioutil.TempFile("", "jagozzi-http-body")
+	assert.Nil(t, err)
+	defer os.Remove(bodyFile.Name())
+	_, err = bodyFile.WriteString("payload from file")
+	assert.Nil(t, err)
+	bodyFile.Close()
+
+	delete(cfg, "basic_auth")
+	delete(cfg, "body")
+	cfg["code"] = 200
+	cfg["bearer_token"] = "env:JAGOZZI_TEST_PASSWORD"
+	cfg["body_file"] = bodyFile.Name()
+	genChecker, err = NewHTTPChecker(cfg, nil)
+	assert.Nilf(t, err, "http checker instantiation failed: %q", err)
+
+	checker = genChecker.(*HTTPChecker)
+	checker.client.Transport = httpclient.Transport
+
+	result = checker.Run(ctxRun)
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+	if assert.NotNil(t, receivedReq) {
+		assert.Equal(t, "Bearer s3cr3t", receivedReq.Header.Get("Authorization"))
+		assert.Equal(t, "payload from file", string(receivedBody))
+	}
+
+	// missing environment variable
+	cfg["bearer_token"] = "env:JAGOZZI_TEST_UNKNOWN"
+	_, err = NewHTTPChecker(cfg, nil)
+	assert.NotNil(t, err)
+}
+
+func TestHTTPServerAssertions(t *testing.T) {
+	// creating HTTP server
+	srvcfg := FakeTestHTTPServer{
+		StatusCode: 200,
+		Body:       `{"status":"degraded","queue":{"depth":150},"nodes":[{"name":"node-1"}]}`,
+	}
+	url, httpclient, shutdown := NewHTTPServer(t, srvcfg)
+	defer shutdown()
+
+	time.Sleep(20 * time.Millisecond)
+
+	// creating HTTP checker
+	cfg := map[string]interface{}{
+		"type":    "request",
+		"url":     url,
+		"method":  "GET",
+		"warn":    200,
+		"crit":    400,
+		"timeout": 450,
+		"name":    "test-1",
+		"content": "degraded",
+		"assertions": []map[string]interface{}{
+			{"regexp": `"name":"node-\d+"`},
+			{"jsonpath": "$.nodes[0].name == 'node-1'"},
+			{"contains": "error", "negate": true},
+		},
+	}
+	runChecker := func() plugins.Result {
+		genChecker, err := NewHTTPChecker(cfg, nil)
+		assert.Nilf(t, err, "http checker instantiation failed: %q", err)
+
+		checker := genChecker.(*HTTPChecker)
+		checker.client.Transport = httpclient.Transport
+
+		ctxRun, cancelFunc1 := context.WithTimeout(context.Background(), time.Second)
+		defer cancelFunc1()
+		return checker.Run(ctxRun)
+	}
+
+	result := runChecker()
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+
+	// content key is enforced
+	cfg["content"] = "healthy"
+	result = runChecker()
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+	assert.Equal(t, `contains "healthy" failed: not found in response body`, result.Message)
+
+	// warning assertion
+	delete(cfg, "content")
+	cfg["assertions"] = []map[string]interface{}{
+		{"jsonpath": "$.queue.depth < 100", "severity": "warning"},
+	}
+	result = runChecker()
+	assert.Equal(t, plugins.STATE_WARNING, result.Status)
+	assert.Equal(t, "$.queue.depth < 100 failed: value is 150", result.Message)
+
+	// critical assertion wins, matched values are available in templates
+	cfg["assertions"] = []map[string]interface{}{
+		{"jsonpath": "$.queue.depth < 100", "severity": "warning"},
+		{"jsonpath": `$.status == "ok"`},
+	}
+	cfg["templates"] = map[string]string{
+		"ErrAssertion": "status is {{.Assertion.Value}}, values:{{range .Assertions}} {{.Value}}{{end}}",
+	}
+	result = runChecker()
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+	assert.Equal(t, "status is degraded, values: 150 degraded", result.Message)
+
+	// invalid assertion
+	cfg["assertions"] = []map[string]interface{}{
+		{"jsonpath": "$.status == ok"},
+	}
+	_, err := NewHTTPChecker(cfg, nil)
+	assert.NotNil(t, err)
+}
+
+func TestHTTPServerTLS(t *testing.T) {
+	// creating HTTPS server
+	srvcfg := FakeTestHTTPServer{
+		StatusCode: 200,
+	}
+	url, serverCert, shutdown := NewHTTPSServer(t, srvcfg, nil)
+	defer shutdown()
+
+	caFile := writeCertificate(t, serverCert)
+	defer os.Remove(caFile)
+
+	// creating HTTP checker
+	cfg := map[string]interface{}{
+		"type":    "request",
+		"url":     url,
+		"method":  "GET",
+		"warn":    200,
+		"crit":    400,
+		"timeout": 450,
+		"name":    "test-1",
+	}
+	runChecker := func() plugins.Result {
+		checker, err := NewHTTPChecker(cfg, nil)
+		assert.Nilf(t, err, "http checker instantiation failed: %q", err)
+		if err != nil {
+			t.FailNow()
+		}
+
+		ctxRun, cancelFunc1 := context.WithTimeout(context.Background(), time.Second)
+		defer cancelFunc1()
+		return checker.Run(ctxRun)
+	}
+
+	// server certificate is verified by default
+	result := runChecker()
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+	assert.Containsf(t, result.Message, "certificate", "http bad message: %q", result.Message)
+
+	cfg["verify_ca_crt"] = false
+	result = runChecker()
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+
+	// sauna allows a CA bundle path in verify_ca_crt
+	cfg["verify_ca_crt"] = caFile
+	result = runChecker()
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+
+	delete(cfg, "verify_ca_crt")
+	cfg["tls"] = map[string]interface{}{
+		"ca_file":     caFile,
+		"server_name": "example.com",
+		"min_version": "1.2",
+	}
+	result = runChecker()
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+
+	cfg["tls"] = map[string]interface{}{
+		"ca_file":     caFile,
+		"server_name": "example.com",
+		"min_version": "1.3",
+	}
+	result = runChecker()
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+
+	cfg["tls"] = map[string]interface{}{
+		"ca_file":     caFile,
+		"server_name": "jagozzi.test",
+	}
+	result = runChecker()
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+
+	// invalid configurations
+	cfg["tls"] = map[string]interface{}{
+		"min_version": "0.9",
+	}
+	_, err := NewHTTPChecker(cfg, nil)
+	assert.NotNil(t, err)
+
+	cfg["tls"] = map[string]interface{}{
+		"ca_file": "/not/found",
+	}
+	_, err = NewHTTPChecker(cfg, nil)
+	assert.NotNil(t, err)
+}
+
+func TestHTTPServerMutualTLS(t *testing.T) {
+	certFile, keyFile, clientCert := generateClientCertificate(t)
+	defer os.Remove(certFile)
+	defer os.Remove(keyFile)
+
+	// creating HTTPS server requiring client certificate
+	srvcfg := FakeTestHTTPServer{
+		StatusCode: 200,
+	}
+	url, serverCert, shutdown := NewHTTPSServer(t, srvcfg, clientCert)
+	defer shutdown()
+
+	caFile := writeCertificate(t, serverCert)
+	defer os.Remove(caFile)
+
+	// creating HTTP checker
+	cfg := map[string]interface{}{
+		"type":    "request",
+		"url":     url,
+		"method":  "GET",
+		"warn":    200,
+		"crit":    400,
+		"timeout": 450,
+		"name":    "test-1",
+		"tls": map[string]interface{}{
+			"ca_file": caFile,
+		},
+	}
+	runChecker := func() plugins.Result {
+		checker, err := NewHTTPChecker(cfg, nil)
+		assert.Nilf(t, err, "http checker instantiation failed: %q", err)
+		if err != nil {
+			t.FailNow()
+		}
+
+		ctxRun, cancelFunc1 := context.WithTimeout(context.Background(), time.Second)
+		defer cancelFunc1()
+		return checker.Run(ctxRun)
+	}
+
+	result := runChecker()
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+
+	cfg["tls"] = map[string]interface{}{
+		"ca_file":   caFile,
+		"cert_file": certFile,
+		"key_file":  keyFile,
+	}
+	result = runChecker()
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+}
+
+func TestHTTPServerRedirects(t *testing.T) {
+	// creating HTTP server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/first", func(w http.ResponseWriter, req *http.Request) {
+		http.Redirect(w, req, "/second", http.StatusFound)
+	})
+	mux.HandleFunc("/second", func(w http.ResponseWriter, req *http.Request) {
+		http.Redirect(w, req, "/final", http.StatusFound)
+	})
+	mux.HandleFunc("/final", func(w http.ResponseWriter, req *http.Request) {
+		io.WriteString(w, "OK\n")
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	// creating HTTP checker
+	cfg := map[string]interface{}{
+		"type":    "request",
+		"url":     ts.URL + "/first",
+		"method":  "GET",
+		"code":    201,
+		"warn":    200,
+		"crit":    400,
+		"timeout": 450,
+		"name":    "test-1",
+		"templates": map[string]string{
+			"ErrStatusCode": "{{.Response.StatusCode}} on {{.FinalURL}}",
+		},
+	}
+	runChecker := func() plugins.Result {
+		checker, err := NewHTTPChecker(cfg, nil)
+		assert.Nilf(t, err, "http checker instantiation failed: %q", err)
+		if err != nil {
+			t.FailNow()
+		}
+
+		ctxRun, cancelFunc1 := context.WithTimeout(context.Background(), time.Second)
+		defer cancelFunc1()
+		return checker.Run(ctxRun)
+	}
+
+	// Go default policy
+	result := runChecker()
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+	assert.Equal(t, "200 on "+ts.URL+"/final", result.Message)
+
+	cfg["follow_redirects"] = false
+	result = runChecker()
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+	assert.Equal(t, "302 on "+ts.URL+"/first", result.Message)
+
+	cfg["follow_redirects"] = 1
+	result = runChecker()
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+	assert.Containsf(t, result.Message, "stopped after 1 redirects", "http bad message: %q", result.Message)
+
+	cfg["follow_redirects"] = 2
+	cfg["code"] = 200
+	result = runChecker()
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+
+	cfg["follow_redirects"] = "always"
+	_, err := NewHTTPChecker(cfg, nil)
+	assert.NotNil(t, err)
+}
+
+func TestHTTPServerResolveAndProxy(t *testing.T) {
+	// creating HTTP server
+	var receivedReq *http.Request
+	srvcfg := FakeTestHTTPServer{
+		StatusCode: 200,
+		OnRequest: func(req *http.Request, body []byte) {
+			receivedReq = req
+		},
+	}
+	url, _, shutdown := NewHTTPServer(t, srvcfg)
+	defer shutdown()
+
+	_, port, err := net.SplitHostPort(strings.TrimPrefix(url, "http://"))
+	assert.Nil(t, err)
+
+	// creating HTTP checker
+	cfg := map[string]interface{}{
+		"type":    "request",
+		"url":     "http://backend.jagozzi.test:" + port + "/",
+		"method":  "GET",
+		"warn":    200,
+		"crit":    400,
+		"timeout": 450,
+		"name":    "test-1",
+		"proxy":   "direct",
+		"resolve": map[string]string{
+			"backend.jagozzi.test": "127.0.0.1",
+		},
+	}
+	runChecker := func() plugins.Result {
+		checker, err := NewHTTPChecker(cfg, nil)
+		assert.Nilf(t, err, "http checker instantiation failed: %q", err)
+		if err != nil {
+			t.FailNow()
+		}
+
+		ctxRun, cancelFunc1 := context.WithTimeout(context.Background(), time.Second)
+		defer cancelFunc1()
+		return checker.Run(ctxRun)
+	}
+
+	// host is pinned to local server, Host header is kept
+	result := runChecker()
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+	if assert.NotNil(t, receivedReq) {
+		assert.Equal(t, "backend.jagozzi.test:"+port, receivedReq.Host)
+	}
+
+	cfg["ip_version"] = 4
+	result = runChecker()
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+
+	cfg["ip_version"] = 6
+	result = runChecker()
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+
+	// local server acts as a proxy
+	receivedReq = nil
+	delete(cfg, "resolve")
+	delete(cfg, "ip_version")
+	cfg["proxy"] = url
+	result = runChecker()
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+	if assert.NotNil(t, receivedReq) {
+		assert.Equal(t, "backend.jagozzi.test:"+port, receivedReq.URL.Host)
+	}
+
+	// invalid configurations
+	cfg["ip_version"] = 5
+	_, err = NewHTTPChecker(cfg, nil)
+	assert.NotNil(t, err)
+
+	delete(cfg, "ip_version")
+	cfg["resolve"] = map[string]string{
+		"backend.jagozzi.test": "localhost",
+	}
+	_, err = NewHTTPChecker(cfg, nil)
+	assert.NotNil(t, err)
+}
@@ -1,7 +1,16 @@
 package http
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"io"
+	"io/ioutil"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -12,9 +21,17 @@ type FakeTestHTTPServer struct {
 	Sleep      time.Duration
 	StatusCode int
 	JSONBody   bool
+	Body       string
+	// OnRequest is called with each request received and its body
+	OnRequest func(req *http.Request, body []byte)
 }
 
 func (s FakeTestHTTPServer) ServeHTTP(respW http.ResponseWriter, req *http.Request) {
+	if s.OnRequest != nil {
+		body, _ := ioutil.ReadAll(req.Body)
+		s.OnRequest(req, body)
+	}
+
 	if s.Sleep != 0 {
 		time.Sleep(s.Sleep)
 	}
@@ -23,7 +40,9 @@ func (s FakeTestHTTPServer) ServeHTTP(respW http.ResponseWriter, req *http.Reque
 		respW.WriteHeader(s.StatusCode)
 	}
 
-	if s.JSONBody {
+	if s.Body != "" {
+		io.WriteString(respW, s.Body)
+	} else if s.JSONBody {
 		io.WriteString(respW, "{\"message\":\"json message field\"}\n")
 	} else {
 		io.WriteString(respW, "OK\n")
@@ -36,3 +55,84 @@ func NewHTTPServer(t *testing.T, serverHandler FakeTestHTTPServer) (string, http
 		ts.Close()
 	}
 }
+
+// writeCertificate writes a PEM encoded certificate to a temporary file
+func writeCertificate(t *testing.T, cert *x509.Certificate) string {
+	file, err := ioutil.TempFile("", "jagozzi-http-ca")
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer file.Close()
+
+	if err := pem.Encode(file, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	return file.Name()
+}
+
+// generateClientCertificate creates a self-signed client certificate and returns its PEM files and its parsed form
+func generateClientCertificate(t *testing.T) (string, string, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "jagozzi"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	keyFile, err := ioutil.TempFile("", "jagozzi-http-key")
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	defer keyFile.Close()
+	if err := pem.Encode(keyFile, &pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	return writeCertificate(t, cert), keyFile.Name(), cert
+}
+
+// NewHTTPSServer starts a TLS server; if clientCA is set, clients must present a certificate signed by it
+func NewHTTPSServer(t *testing.T, serverHandler FakeTestHTTPServer, clientCA *x509.Certificate) (string, *x509.Certificate, func()) {
+	ts := httptest.NewUnstartedServer(serverHandler)
+	if clientCA != nil {
+		pool := x509.NewCertPool()
+		pool.AddCert(clientCA)
+		ts.TLS = &tls.Config{
+			ClientAuth: tls.RequireAndVerifyClientCert,
+			ClientCAs:  pool,
+		}
+	}
+	ts.StartTLS()
+	return ts.URL, ts.Certificate(), func() {
+		ts.Close()
+	}
+}
@@ -0,0 +1,100 @@
+package http
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+// tlsVersions are the minimum TLS versions that can be configured
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	// tls.VersionTLS13, not defined before Go 1.12
+	"1.3": 0x0304,
+}
+
+// caVerification is the sauna verify_ca_crt option: either a boolean enabling server certificate verification,
+// or the path of a CA bundle used to verify server certificate
+type caVerification struct {
+	Disabled bool
+	CAFile   string
+}
+
+func (v *caVerification) UnmarshalJSON(b []byte) error {
+	var verify bool
+	if err := json.Unmarshal(b, &verify); err == nil {
+		v.Disabled = !verify
+		return nil
+	}
+
+	var caFile string
+	if err := json.Unmarshal(b, &caFile); err != nil {
+		return fmt.Errorf("verify_ca_crt must be a boolean or a CA bundle path")
+	}
+	v.CAFile = caFile
+	return nil
+}
+
+type rawTLSConfig struct {
+	// InsecureSkipVerify disables server certificate verification
+	InsecureSkipVerify bool `json:"insecure_skip_verify"`
+	// CAFile is the path of the CA bundle used to verify server certificate, instead of system CAs
+	CAFile string `json:"ca_file"`
+	// CertFile and KeyFile are the paths of the client certificate and key, used for mutual TLS authentication
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+	// ServerName overrides the name used for SNI and server certificate verification
+	ServerName string `json:"server_name"`
+	// MinVersion is the minimum TLS version accepted: 1.0, 1.1, 1.2 or 1.3
+	MinVersion string `json:"min_version" validate:"omitempty,eq=1.0|eq=1.1|eq=1.2|eq=1.3"`
+}
+
+// newTLSConfig creates the TLS configuration of the HTTP client
+func newTLSConfig(raw rawTLSConfig, verify caVerification) (*tls.Config, error) {
+	if raw.CAFile != "" && verify.CAFile != "" {
+		return nil, errors.New("verify_ca_crt and tls.ca_file keys are incompatible")
+	}
+	if (raw.CertFile == "") != (raw.KeyFile == "") {
+		return nil, errors.New("tls.cert_file and tls.key_file keys must be set together")
+	}
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: raw.InsecureSkipVerify || verify.Disabled,
+		ServerName:         raw.ServerName,
+	}
+
+	if version, ok := tlsVersions[raw.MinVersion]; ok {
+		tlsConfig.MinVersion = version
+	}
+
+	caFile := raw.CAFile
+	if verify.CAFile != "" {
+		caFile = verify.CAFile
+	}
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls: %s", err)
+		}
+		pool := x509.NewCertPool()
+		if ok := pool.AppendCertsFromPEM(pem); !ok {
+			return nil, fmt.Errorf("tls: no certificate found in %q", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if raw.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(raw.CertFile, raw.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls: %s", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
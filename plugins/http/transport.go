@@ -0,0 +1,108 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// directProxy is the proxy value that disables proxies defined in environment
+const directProxy = "direct"
+
+// redirectPolicy is the follow_redirects option: a boolean, or the maximum number of redirects followed
+type redirectPolicy struct {
+	Max int
+}
+
+func (p *redirectPolicy) UnmarshalJSON(b []byte) error {
+	var follow bool
+	if err := json.Unmarshal(b, &follow); err == nil {
+		p.Max = 0
+		if follow {
+			// same limit as Go default policy
+			p.Max = 10
+		}
+		return nil
+	}
+
+	if err := json.Unmarshal(b, &p.Max); err != nil || p.Max < 0 {
+		return fmt.Errorf("follow_redirects must be a boolean or a positive number of redirects")
+	}
+	return nil
+}
+
+// checkRedirect stops following redirects once the maximum is reached; the last response is returned if redirects are disabled
+func (p redirectPolicy) checkRedirect(req *http.Request, via []*http.Request) error {
+	if p.Max == 0 {
+		return http.ErrUseLastResponse
+	}
+	if len(via) > p.Max {
+		return fmt.Errorf("stopped after %d redirects", p.Max)
+	}
+	return nil
+}
+
+// newClient creates the client used by a checker
+func newClient(cfg httpConfig) (*http.Client, error) {
+	transport, err := newTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   cfg.Timeout,
+	}
+	if cfg.FollowRedirects != nil {
+		client.CheckRedirect = cfg.FollowRedirects.checkRedirect
+	}
+	return client, nil
+}
+
+// newTransport creates the transport used by a checker, reused between runs to keep connections alive
+func newTransport(cfg httpConfig) (*http.Transport, error) {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+
+	proxy := http.ProxyFromEnvironment
+	switch cfg.Proxy {
+	case "":
+	case directProxy:
+		proxy = nil
+	default:
+		proxyURL, err := url.Parse(cfg.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("proxy: %s", err)
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+
+	network := "tcp"
+	if cfg.IPVersion != 0 {
+		network = fmt.Sprintf("tcp%d", cfg.IPVersion)
+	}
+
+	return &http.Transport{
+		Proxy: proxy,
+		DialContext: func(ctx context.Context, _, address string) (net.Conn, error) {
+			// resolve option pins the address of a host, Host header and TLS server name are kept
+			if host, port, err := net.SplitHostPort(address); err == nil {
+				if ip, ok := cfg.Resolve[host]; ok {
+					address = net.JoinHostPort(ip, port)
+				}
+			}
+			return dialer.DialContext(ctx, network, address)
+		},
+		TLSClientConfig:       cfg.tlsConfig,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}, nil
+}
@@ -0,0 +1,74 @@
+package load
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/rbeuque74/jagozzi/config"
+	validator "gopkg.in/go-playground/validator.v9"
+)
+
+const (
+	typeLoad1    = "load1"
+	typeLoad5    = "load5"
+	typeLoad15   = "load15"
+	typeCPUUsage = "cpu_usage"
+)
+
+type rawLoadConfig struct {
+	config.GenericPluginConfiguration
+	Type string `json:"type" validate:"required,eq=load1|eq=load5|eq=load15|eq=cpu_usage"`
+	// Normalize divides load average by the number of CPUs
+	Normalize bool            `json:"normalize"`
+	Warning   json.RawMessage `json:"warn" validate:"required"`
+	Critical  json.RawMessage `json:"crit" validate:"required"`
+}
+
+type loadConfig struct {
+	rawLoadConfig
+	// warning and critical are the thresholds, either in load average or in percent depending on check type
+	warning  float64
+	critical float64
+}
+
+func (cfg *loadConfig) UnmarshalJSON(b []byte) error {
+	raw := &rawLoadConfig{}
+
+	if err := config.UnmarshalConfig(b, raw); err != nil {
+		return err
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(raw); err != nil {
+		return err
+	}
+
+	if raw.Normalize && raw.Type == typeCPUUsage {
+		return fmt.Errorf("normalize is not available for %s check", typeCPUUsage)
+	}
+
+	cfg.rawLoadConfig = *raw
+
+	var err error
+	if cfg.warning, err = cfg.threshold(raw.Warning); err != nil {
+		return fmt.Errorf("warn: %s", err)
+	}
+	if cfg.critical, err = cfg.threshold(raw.Critical); err != nil {
+		return fmt.Errorf("crit: %s", err)
+	}
+
+	return nil
+}
+
+// threshold parses a threshold as a percentage or as a load average, depending on check type
+func (cfg loadConfig) threshold(b json.RawMessage) (float64, error) {
+	if cfg.Type == typeCPUUsage {
+		var percent config.Percent
+		err := json.Unmarshal(b, &percent)
+		return float64(percent), err
+	}
+
+	var load float64
+	err := json.Unmarshal(b, &load)
+	return load, err
+}
@@ -0,0 +1,230 @@
+package load
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/rbeuque74/jagozzi/plugins"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	pluginName         = "Load"
+	defaultLoadavgFile = "/proc/loadavg"
+	defaultStatFile    = "/proc/stat"
+)
+
+func init() {
+	plugins.Register(pluginName, NewLoadChecker)
+}
+
+// LoadChecker is a plugin to check load average and CPU usage
+type LoadChecker struct {
+	cfg         loadConfig
+	loadavgFile string
+	statFile    string
+	// lastSample is the CPU times read during previous run, used to compute CPU usage across the check interval
+	lastSample      *cpuSample
+	lastSampleMutex sync.Mutex
+}
+
+// cpuSample contains aggregated CPU times of all CPUs, in USER_HZ
+type cpuSample struct {
+	total uint64
+	idle  uint64
+	cpus  int
+}
+
+// Name returns the name of the checker
+func (c *LoadChecker) Name() string {
+	return pluginName
+}
+
+// ServiceName returns the name of the NSCA service associated to the checker
+func (c *LoadChecker) ServiceName() string {
+	return c.cfg.Name
+}
+
+// Periodicity returns the delay between two checks
+func (c *LoadChecker) Periodicity() *time.Duration {
+	return c.cfg.Periodicity()
+}
+
+// Run is performing the checker protocol
+func (c *LoadChecker) Run(ctx context.Context) plugins.Result {
+	if c.cfg.Type == typeCPUUsage {
+		return c.runCPUUsage()
+	}
+	return c.runLoad()
+}
+
+func (c *LoadChecker) runLoad() plugins.Result {
+	content, err := ioutil.ReadFile(c.loadavgFile)
+	if err != nil {
+		return plugins.ResultFromError(c, err, "unable to read load average")
+	}
+
+	fields := strings.Fields(string(content))
+	if len(fields) < 3 {
+		return plugins.ResultFromError(c, fmt.Errorf("unexpected content %q", content), "unable to read load average")
+	}
+
+	var index int
+	var period string
+	switch c.cfg.Type {
+	case typeLoad5:
+		index, period = 1, "5 min"
+	case typeLoad15:
+		index, period = 2, "15 min"
+	default:
+		index, period = 0, "1 min"
+	}
+
+	load, err := strconv.ParseFloat(fields[index], 64)
+	if err != nil {
+		return plugins.ResultFromError(c, err, "unable to read load average")
+	}
+
+	message := fmt.Sprintf("Load average (%s): %g", period, load)
+	if c.cfg.Normalize {
+		sample, err := c.sample()
+		if err != nil {
+			return plugins.ResultFromError(c, err, "unable to read CPU count")
+		}
+		load = plugins.Round(load / float64(sample.cpus))
+		message = fmt.Sprintf("Load average per CPU (%s): %g", period, load)
+	}
+
+	return plugins.Result{
+		Status:   c.status(load),
+		Message:  message,
+		Checker:  c,
+		PerfData: []plugins.PerfData{plugins.NewPerfData(c.cfg.Type, load, "").WithThresholds(c.cfg.warning, c.cfg.critical).WithMin(0)},
+	}
+}
+
+func (c *LoadChecker) runCPUUsage() plugins.Result {
+	sample, err := c.sample()
+	if err != nil {
+		return plugins.ResultFromError(c, err, "unable to read CPU times")
+	}
+
+	c.lastSampleMutex.Lock()
+	previous := c.lastSample
+	c.lastSample = sample
+	c.lastSampleMutex.Unlock()
+
+	// on first run or after a counters reset, usage is computed since boot time
+	if previous == nil || previous.total > sample.total || previous.idle > sample.idle {
+		previous = &cpuSample{}
+	}
+
+	total := sample.total - previous.total
+	if total == 0 {
+		return plugins.Result{
+			Status:  plugins.STATE_UNKNOWN,
+			Message: "no CPU time elapsed since last check",
+			Checker: c,
+		}
+	}
+
+	used := plugins.Round(float64(total-(sample.idle-previous.idle)) / float64(total) * 100)
+	return plugins.Result{
+		Status:   c.status(used),
+		Message:  fmt.Sprintf("CPU used: %g%%", used),
+		Checker:  c,
+		PerfData: []plugins.PerfData{plugins.NewPerfData("cpu", used, "%").WithThresholds(c.cfg.warning, c.cfg.critical).WithMin(0).WithMax(100)},
+	}
+}
+
+func (c *LoadChecker) status(value float64) plugins.StatusEnum {
+	if value >= c.cfg.critical {
+		return plugins.STATE_CRITICAL
+	} else if value >= c.cfg.warning {
+		return plugins.STATE_WARNING
+	}
+	return plugins.STATE_OK
+}
+
+// sample reads aggregated CPU times and CPU count from stat file
+func (c *LoadChecker) sample() (*cpuSample, error) {
+	file, err := os.Open(c.statFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var sample *cpuSample
+	cpus := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || !strings.HasPrefix(fields[0], "cpu") {
+			continue
+		}
+		if fields[0] != "cpu" {
+			cpus++
+			continue
+		}
+
+		// user nice system idle iowait irq softirq steal; guest times are already accounted in user and nice
+		if len(fields) < 5 {
+			return nil, fmt.Errorf("unexpected cpu line %q", scanner.Text())
+		}
+		sample = &cpuSample{}
+		for i, field := range fields[1:] {
+			if i >= 8 {
+				break
+			}
+			value, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid cpu time %q: %s", field, err)
+			}
+			sample.total += value
+			if i == 3 || i == 4 {
+				sample.idle += value
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if sample == nil || cpus == 0 {
+		return nil, fmt.Errorf("cpu lines not found in %s", c.statFile)
+	}
+
+	sample.cpus = cpus
+	return sample, nil
+}
+
+// NewLoadChecker create a Load checker
+func NewLoadChecker(conf interface{}, pluginConf interface{}) (plugins.Checker, error) {
+	out, err := yaml.Marshal(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := loadConfig{}
+	err = yaml.Unmarshal(out, &cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	checker := &LoadChecker{
+		cfg:         cfg,
+		loadavgFile: defaultLoadavgFile,
+		statFile:    defaultStatFile,
+	}
+
+	log.Infof("load: Checker %q activated (warn: %g, crit: %g)", cfg.Type, cfg.warning, cfg.critical)
+	return checker, nil
+}
@@ -0,0 +1,142 @@
+package load
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rbeuque74/jagozzi/plugins"
+	"github.com/stretchr/testify/assert"
+)
+
+const fixtureLoadavg = "2.40 1.20 0.60 3/512 12345\n"
+
+// 2 CPUs: 1000 jiffies spent, 250 of them idle or waiting for IO
+const fixtureStat = `cpu  400 100 200 200 50 25 25 0 80 0
+cpu0 200 50 100 100 25 12 13 0 40 0
+cpu1 200 50 100 100 25 13 12 0 40 0
+intr 123456 0 0
+ctxt 654321
+`
+
+// 500 more jiffies spent, 400 of them idle
+const fixtureStatNext = `cpu  450 100 250 550 100 25 25 0 80 0
+cpu0 225 50 125 275 50 12 13 0 40 0
+cpu1 225 50 125 275 50 13 12 0 40 0
+`
+
+func fixtureFile(t *testing.T, content string) string {
+	file, err := ioutil.TempFile("", "jagozzi-load")
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if _, err := file.WriteString(content); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if err := file.Close(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	return file.Name()
+}
+
+func newChecker(t *testing.T, cfg map[string]interface{}, loadavgFile, statFile string) *LoadChecker {
+	checker, err := NewLoadChecker(cfg, nil)
+	assert.Nilf(t, err, "load checker instantiation failed: %q", err)
+	if err != nil {
+		t.FailNow()
+	}
+
+	loadChecker := checker.(*LoadChecker)
+	loadChecker.loadavgFile = loadavgFile
+	loadChecker.statFile = statFile
+	return loadChecker
+}
+
+func TestLoad(t *testing.T) {
+	loadavgFile := fixtureFile(t, fixtureLoadavg)
+	defer os.Remove(loadavgFile)
+	statFile := fixtureFile(t, fixtureStat)
+	defer os.Remove(statFile)
+
+	cfg := map[string]interface{}{
+		"type": "load1",
+		"warn": 2,
+		"crit": 4,
+		"name": "test-1",
+	}
+	checker := newChecker(t, cfg, loadavgFile, statFile)
+
+	assert.Equal(t, "Load", checker.Name())
+	assert.Equal(t, "test-1", checker.ServiceName())
+
+	ctxRun, cancelFunc1 := context.WithTimeout(context.Background(), time.Second)
+	defer cancelFunc1()
+	result := checker.Run(ctxRun)
+	assert.Equal(t, plugins.STATE_WARNING, result.Status)
+	assert.Equal(t, "Load average (1 min): 2.4", result.Message)
+	assert.Equal(t, "load1=2.4;2;4;0", plugins.FormatPerfData(result.PerfData))
+
+	// load15
+	cfg["type"] = "load15"
+	checker = newChecker(t, cfg, loadavgFile, statFile)
+	result = checker.Run(ctxRun)
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+	assert.Equal(t, "Load average (15 min): 0.6", result.Message)
+
+	// normalized by CPU count
+	cfg["type"] = "load1"
+	cfg["normalize"] = true
+	cfg["warn"] = 1
+	cfg["crit"] = 1.2
+	checker = newChecker(t, cfg, loadavgFile, statFile)
+	result = checker.Run(ctxRun)
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+	assert.Equal(t, "Load average per CPU (1 min): 1.2", result.Message)
+
+	// missing file
+	checker = newChecker(t, cfg, "/not/found", statFile)
+	result = checker.Run(ctxRun)
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+}
+
+func TestCPUUsage(t *testing.T) {
+	statFile := fixtureFile(t, fixtureStat)
+	defer os.Remove(statFile)
+
+	cfg := map[string]interface{}{
+		"type": "cpu_usage",
+		"warn": "70%",
+		"crit": "90%",
+		"name": "test-1",
+	}
+	checker := newChecker(t, cfg, "", statFile)
+
+	// first run computes usage since boot time
+	ctxRun, cancelFunc1 := context.WithTimeout(context.Background(), time.Second)
+	defer cancelFunc1()
+	result := checker.Run(ctxRun)
+	assert.Equal(t, plugins.STATE_WARNING, result.Status)
+	assert.Equal(t, "CPU used: 75%", result.Message)
+	assert.Equal(t, "cpu=75%;70;90;0;100", plugins.FormatPerfData(result.PerfData))
+
+	// next run uses previous sample
+	err := ioutil.WriteFile(statFile, []byte(fixtureStatNext), 0644)
+	assert.Nil(t, err)
+	result = checker.Run(ctxRun)
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+	assert.Equal(t, "CPU used: 20%", result.Message)
+
+	// no time elapsed
+	result = checker.Run(ctxRun)
+	assert.Equal(t, plugins.STATE_UNKNOWN, result.Status)
+
+	// normalize is not supported
+	cfg["normalize"] = true
+	_, err = NewLoadChecker(cfg, nil)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,182 @@
+package marathon
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	marathonlib "github.com/gambol99/go-marathon"
+	"github.com/rbeuque74/jagozzi/plugins"
+	log "github.com/sirupsen/logrus"
+)
+
+// thresholdStatus returns the status of a value compared to warn and crit thresholds, reached when value goes above
+// them; a zero threshold is disabled
+func (c *MarathonChecker) thresholdStatus(value float64) (plugins.StatusEnum, int64) {
+	if c.cfg.Critical > 0 && value > float64(c.cfg.Critical) {
+		return plugins.STATE_CRITICAL, c.cfg.Critical
+	} else if c.cfg.Warning > 0 && value > float64(c.cfg.Warning) {
+		return plugins.STATE_WARNING, c.cfg.Warning
+	}
+	return plugins.STATE_OK, 0
+}
+
+// thresholdPerfData returns a performance data with warn and crit thresholds, disabled thresholds are omitted
+func (c *MarathonChecker) thresholdPerfData(label string, value float64, unit string) plugins.PerfData {
+	p := plugins.NewPerfData(label, value, unit).WithThresholds(float64(c.cfg.Warning), float64(c.cfg.Critical)).WithMin(0)
+	if c.cfg.Warning == 0 {
+		p.Warning = ""
+	}
+	if c.cfg.Critical == 0 {
+		p.Critical = ""
+	}
+	return p
+}
+
+// runDeploymentStuck checks the duration of the oldest deployment in progress on the application
+func (c *MarathonChecker) runDeploymentStuck(ctx context.Context, client marathonlib.Marathon, app marathonlib.Application) plugins.Result {
+	resultOK := plugins.Result{
+		Status:   plugins.STATE_OK,
+		Message:  "OK: no deployment in progress",
+		Checker:  c,
+		PerfData: []plugins.PerfData{c.thresholdPerfData("deployment", 0, "s")},
+	}
+	if len(app.Deployments) == 0 {
+		return resultOK
+	}
+
+	deployments, err := client.Deployments()
+	if err != nil {
+		return c.resultFromError(ctx, err, "unable to list deployments")
+	}
+
+	var oldest *marathonlib.Deployment
+	var startedAt time.Time
+	for _, appDeployment := range app.Deployments {
+		for _, deployment := range deployments {
+			if deployment == nil || deployment.ID != appDeployment["id"] {
+				continue
+			}
+			date, err := parseMarathonDateTime(deployment.Version)
+			if err != nil {
+				log.Error(err)
+				continue
+			}
+			if oldest == nil || date.Before(startedAt) {
+				oldest, startedAt = deployment, date
+			}
+		}
+	}
+
+	// deployment finished between the two calls
+	if oldest == nil {
+		return resultOK
+	}
+
+	since := time.Since(startedAt).Truncate(time.Second)
+	status, threshold := c.thresholdStatus(since.Seconds())
+	message := fmt.Sprintf("deployment %s in progress since %s (step %d/%d)", oldest.ID, since, oldest.CurrentStep, oldest.TotalSteps)
+	if status == plugins.STATE_OK {
+		message = "OK: " + message
+	} else {
+		message = fmt.Sprintf("%s, threshold: %s", message, time.Duration(threshold)*time.Second)
+	}
+
+	return plugins.Result{
+		Status:   status,
+		Message:  message,
+		Checker:  c,
+		PerfData: []plugins.PerfData{c.thresholdPerfData("deployment", since.Seconds(), "s")},
+	}
+}
+
+// runVersionDrift checks tasks that are still running a version older than the last configuration change of the
+// application, and for how long
+func (c *MarathonChecker) runVersionDrift(ctx context.Context, app marathonlib.Application) plugins.Result {
+	// scaling changes application version without restarting tasks: only configuration changes matter
+	version := app.Version
+	if app.VersionInfo != nil && app.VersionInfo.LastConfigChangeAt != "" {
+		version = app.VersionInfo.LastConfigChangeAt
+	}
+	configuredAt, err := parseMarathonDateTime(version)
+	if err != nil {
+		return plugins.ResultFromError(c, err, "invalid application version")
+	}
+
+	var tasks, outdated int
+	for _, task := range app.Tasks {
+		if task == nil {
+			continue
+		}
+		tasks++
+
+		taskVersion, err := parseMarathonDateTime(task.Version)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		if taskVersion.Before(configuredAt) {
+			outdated++
+		}
+	}
+
+	perfdata := []plugins.PerfData{
+		plugins.NewPerfData("outdated", float64(outdated), "").WithMin(0).WithMax(float64(tasks)),
+	}
+	if outdated == 0 {
+		return plugins.Result{
+			Status:   plugins.STATE_OK,
+			Message:  fmt.Sprintf("OK: %d tasks running version %s", tasks, version),
+			Checker:  c,
+			PerfData: perfdata,
+		}
+	}
+
+	since := time.Since(configuredAt).Truncate(time.Second)
+	status, threshold := c.thresholdStatus(since.Seconds())
+	message := fmt.Sprintf("%d/%d tasks running a version older than %s since %s", outdated, tasks, version, since)
+	if status == plugins.STATE_OK {
+		message = "OK: " + message
+	} else {
+		message = fmt.Sprintf("%s, threshold: %s", message, time.Duration(threshold)*time.Second)
+	}
+
+	return plugins.Result{
+		Status:   status,
+		Message:  message,
+		Checker:  c,
+		PerfData: perfdata,
+	}
+}
+
+// runHealthRatio checks the percentage of running tasks failing their health checks
+func (c *MarathonChecker) runHealthRatio(ctx context.Context, app marathonlib.Application) plugins.Result {
+	if app.HealthChecks == nil || len(*app.HealthChecks) == 0 {
+		return plugins.Result{
+			Status:  plugins.STATE_OK,
+			Message: "OK: no health checks defined",
+			Checker: c,
+		}
+	}
+
+	var ratio float64
+	if app.TasksRunning > 0 {
+		ratio = math.Round(float64(app.TasksUnhealthy)/float64(app.TasksRunning)*10000) / 100
+	}
+
+	status, threshold := c.thresholdStatus(ratio)
+	message := fmt.Sprintf("%d/%d running tasks unhealthy", app.TasksUnhealthy, app.TasksRunning)
+	if status == plugins.STATE_OK {
+		message = "OK: " + message
+	} else {
+		message = fmt.Sprintf("%s, threshold: %d%%", message, threshold)
+	}
+
+	return plugins.Result{
+		Status:   status,
+		Message:  message,
+		Checker:  c,
+		PerfData: []plugins.PerfData{c.thresholdPerfData("unhealthy", ratio, "%").WithMax(100)},
+	}
+}
@@ -1,11 +1,29 @@
 package marathon
 
 import (
+	"crypto/rsa"
 	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"time"
 
 	"github.com/ghodss/yaml"
 	"github.com/rbeuque74/jagozzi/config"
 	validator "gopkg.in/go-playground/validator.v9"
+	defaults "gopkg.in/mcuadros/go-defaults.v1"
+)
+
+const (
+	// minimumHealthyInstancesType checks the number of running instances, staged tasks and task failures
+	minimumHealthyInstancesType = "minimum_healthy_instances"
+	// deploymentStuckType checks the duration of deployments in progress, thresholds are in seconds
+	deploymentStuckType = "deployment_stuck"
+	// versionDriftType checks tasks running an old version of the application, thresholds are in seconds
+	// since the configuration change
+	versionDriftType = "version_drift"
+	// healthRatioType checks the percentage of running tasks failing their health checks
+	healthRatioType = "health_ratio"
 )
 
 type checkerConfig struct {
@@ -14,26 +32,60 @@ type checkerConfig struct {
 
 type rawCheckerConfig struct {
 	config.GenericPluginConfiguration
-	Type     string `json:"type" validate:"required"`
-	ID       string `json:"id" validate:"required"`
-	Warning  int64  `json:"warn"`
-	Critical int64  `json:"crit"`
+	Type string `json:"type" validate:"required,eq=minimum_healthy_instances|eq=deployment_stuck|eq=version_drift|eq=health_ratio"`
+	// ID is the ID of the checked application
+	ID string `json:"id"`
+	// Group is the ID of a Marathon group, to check every application of the group and its subgroups
+	Group    string `json:"group"`
+	Warning  int64  `json:"warn" validate:"gte=0"`
+	Critical int64  `json:"crit" validate:"gte=0"`
+	// StaggerWindow is the duration in seconds after which a staged task that is not started is a warning
+	StaggerWindow int64 `json:"stagger_window" default:"900" validate:"gt=0"`
+	// FailureWindow is the duration in seconds during which task failures are counted
+	FailureWindow int64 `json:"failure_window" default:"900" validate:"gt=0"`
+	// FailureThreshold is the number of task failures during failure window from which the check is a warning
+	FailureThreshold int `json:"failure_threshold" default:"5" validate:"gt=0"`
 }
 
 type pluginConfig struct {
 	rawPluginConfig
+	// dcosPrivateKey is the private key of the DC/OS service account
+	dcosPrivateKey *rsa.PrivateKey
+	// dcosLoginURL is the URL used to log in DC/OS as the service account
+	dcosLoginURL string
 }
 
 type rawPluginConfig struct {
 	User     string `json:"user"`
 	Password string `json:"password"`
 	Host     string `json:"host" validate:"required"`
+	// DCOSToken is a DC/OS authentication token, sent instead of basic authentication
+	DCOSToken config.Secret `json:"dcos_token"`
+	// DCOSServiceAccount is a DC/OS service account used to obtain authentication tokens, renewed when they expire
+	DCOSServiceAccount *rawDCOSServiceAccount `json:"dcos_service_account"`
+}
+
+type rawDCOSServiceAccount struct {
+	UID string `json:"uid" validate:"required"`
+	// PrivateKey is the RSA private key of the service account, in PEM format
+	PrivateKey     config.Secret `json:"private_key"`
+	PrivateKeyFile string        `json:"private_key_file"`
+	// LoginURL is the DC/OS login endpoint, on Marathon host by default
+	LoginURL string `json:"login_url"`
 }
 
 func (cfg checkerConfig) ServiceName() string {
 	return cfg.Name
 }
 
+func (cfg checkerConfig) staggerWindow() time.Duration {
+	return time.Duration(cfg.StaggerWindow) * time.Second
+}
+
+func (cfg checkerConfig) failureWindow() time.Duration {
+	return time.Duration(cfg.FailureWindow) * time.Second
+}
+
 func loadPluginConfiguration(conf interface{}) (pluginConfig, error) {
 	cfg := pluginConfig{}
 
@@ -56,6 +108,41 @@ func loadPluginConfiguration(conf interface{}) (pluginConfig, error) {
 		return cfg, errors.New("host is empty")
 	}
 
+	authentications := 0
+	for _, enabled := range []bool{cfg.User != "" && cfg.Password != "", cfg.DCOSToken != "", cfg.DCOSServiceAccount != nil} {
+		if enabled {
+			authentications++
+		}
+	}
+	if authentications > 1 {
+		return cfg, errors.New("user/password, dcos_token and dcos_service_account keys are incompatible")
+	}
+
+	if account := cfg.DCOSServiceAccount; account != nil {
+		if (account.PrivateKey == "") == (account.PrivateKeyFile == "") {
+			return cfg, errors.New("dcos_service_account: exactly one of private_key or private_key_file keys is required")
+		}
+
+		key := []byte(account.PrivateKey)
+		if account.PrivateKeyFile != "" {
+			if key, err = ioutil.ReadFile(account.PrivateKeyFile); err != nil {
+				return cfg, fmt.Errorf("dcos_service_account: %s", err)
+			}
+		}
+		if cfg.dcosPrivateKey, err = parsePrivateKey(key); err != nil {
+			return cfg, fmt.Errorf("dcos_service_account: invalid private key: %s", err)
+		}
+
+		cfg.dcosLoginURL = account.LoginURL
+		if cfg.dcosLoginURL == "" {
+			host, err := url.Parse(cfg.Host)
+			if err != nil {
+				return cfg, err
+			}
+			cfg.dcosLoginURL = (&url.URL{Scheme: host.Scheme, Host: host.Host, Path: "/acs/api/v1/auth/login"}).String()
+		}
+	}
+
 	return cfg, nil
 }
 
@@ -72,11 +159,20 @@ func loadConfiguration(conf interface{}) (checkerConfig, error) {
 		return cfg, err
 	}
 
+	defaults.SetDefaults(&cfg.rawCheckerConfig)
+
 	validate := validator.New()
 	if err := validate.Struct(cfg); err != nil {
 		return cfg, err
 	}
 
+	if (cfg.ID == "") == (cfg.Group == "") {
+		return cfg, errors.New("exactly one of id or group keys is required")
+	}
+	if cfg.Type != minimumHealthyInstancesType && cfg.Warning == 0 && cfg.Critical == 0 {
+		return cfg, fmt.Errorf("warn or crit key is required for type %q", cfg.Type)
+	}
+
 	return cfg, nil
 }
 
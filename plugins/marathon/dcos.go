@@ -0,0 +1,147 @@
+package marathon
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// dcosLoginTokenValidity is the validity of the JWT sent to DC/OS to log in as a service account
+const dcosLoginTokenValidity = 5 * time.Minute
+
+// dcosAuthenticator holds the DC/OS authentication token shared by all runs of a checker;
+// with a service account, it logs in again when the token expires
+type dcosAuthenticator struct {
+	// uid and privateKey are the service account credentials, nil privateKey for a static token
+	uid        string
+	privateKey *rsa.PrivateKey
+	loginURL   string
+
+	mutex sync.Mutex
+	token string
+}
+
+// renewable returns true if a new token can be obtained when the current one expires
+func (a *dcosAuthenticator) renewable() bool {
+	return a.privateKey != nil
+}
+
+// currentToken returns the authentication token, logging in if no token was obtained yet
+func (a *dcosAuthenticator) currentToken(ctx context.Context, rt http.RoundTripper) (string, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.token == "" && a.renewable() {
+		return a.login(ctx, rt)
+	}
+	return a.token, nil
+}
+
+// renew logs in again after expired token has been rejected; token is renewed only once when
+// concurrent requests are rejected
+func (a *dcosAuthenticator) renew(ctx context.Context, rt http.RoundTripper, expired string) (string, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.token != expired {
+		return a.token, nil
+	}
+	return a.login(ctx, rt)
+}
+
+// login obtains a token from DC/OS using a JWT signed with the service account private key; mutex must be held
+func (a *dcosAuthenticator) login(ctx context.Context, rt http.RoundTripper) (string, error) {
+	loginToken, err := signJWT(a.privateKey, map[string]interface{}{
+		"uid": a.uid,
+		"exp": time.Now().Add(dcosLoginTokenValidity).Unix(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("dcos login: %s", err)
+	}
+
+	body, err := json.Marshal(map[string]string{"uid": a.uid, "token": loginToken})
+	if err != nil {
+		return "", fmt.Errorf("dcos login: %s", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, a.loginURL, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("dcos login: %s", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := rt.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		return "", fmt.Errorf("dcos login: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("dcos login: unexpected status %s", resp.Status)
+	}
+
+	var login struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&login); err != nil {
+		return "", fmt.Errorf("dcos login: %s", err)
+	}
+	if login.Token == "" {
+		return "", errors.New("dcos login: no token received")
+	}
+
+	a.token = login.Token
+	return a.token, nil
+}
+
+// signJWT returns a JSON Web Token with claims, signed using RS256 algorithm
+func signJWT(key *rsa.PrivateKey, claims map[string]interface{}) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// parsePrivateKey parses a RSA private key written in PEM format, using PKCS #1 or PKCS #8 encoding
+func parsePrivateKey(b []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T, RSA is expected", key)
+	}
+	return rsaKey, nil
+}
@@ -0,0 +1,94 @@
+package marathon
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	marathonlib "github.com/gambol99/go-marathon"
+	"github.com/rbeuque74/jagozzi/plugins"
+)
+
+// runGroup performs the check configured on each application of a group and its subgroups
+func (c *MarathonChecker) runGroup(ctx context.Context, client marathonlib.Marathon) plugins.Result {
+	group, err := client.Group(c.cfg.Group)
+	if err != nil {
+		return c.resultFromError(ctx, err, "")
+	}
+
+	appIDs := groupApplications(group)
+	if len(appIDs) == 0 {
+		return plugins.Result{
+			Status:  plugins.STATE_CRITICAL,
+			Message: fmt.Sprintf("no application found in group %q", c.cfg.Group),
+			Checker: c,
+		}
+	}
+
+	var failures []plugins.Result
+	for _, appID := range appIDs {
+		if ctx.Err() != nil {
+			return plugins.ResultFromError(c, ctx.Err(), "")
+		}
+
+		// group listing doesn't embed tasks of applications
+		app, err := client.Application(appID)
+		if err != nil {
+			failures = append(failures, c.resultFromError(ctx, err, appID))
+			continue
+		}
+
+		if result := c.runApplication(ctx, client, *app); result.Status != plugins.STATE_OK {
+			result.Message = appID + ": " + result.Message
+			failures = append(failures, result)
+		}
+	}
+
+	perfdata := []plugins.PerfData{
+		plugins.NewPerfData("applications", float64(len(appIDs)), "").WithMin(0),
+		plugins.NewPerfData("failing", float64(len(failures)), "").WithMin(0).WithMax(float64(len(appIDs))),
+	}
+	if len(failures) == 0 {
+		return plugins.Result{
+			Status:   plugins.STATE_OK,
+			Message:  fmt.Sprintf("OK: %d applications", len(appIDs)),
+			Checker:  c,
+			PerfData: perfdata,
+		}
+	}
+
+	// reporting worst failures first
+	sort.SliceStable(failures, func(i, j int) bool {
+		return failures[i].Status.Severity() > failures[j].Status.Severity()
+	})
+	messages := make([]string, 0, len(failures))
+	for _, failure := range failures {
+		messages = append(messages, failure.Message)
+	}
+
+	return plugins.Result{
+		Status:   failures[0].Status,
+		Message:  fmt.Sprintf("%d/%d applications failing: %s", len(failures), len(appIDs), strings.Join(messages, "; ")),
+		Checker:  c,
+		PerfData: perfdata,
+	}
+}
+
+// groupApplications returns the IDs of applications of a group and its subgroups
+func groupApplications(group *marathonlib.Group) []string {
+	if group == nil {
+		return nil
+	}
+
+	var appIDs []string
+	for _, app := range group.Apps {
+		if app != nil {
+			appIDs = append(appIDs, app.ID)
+		}
+	}
+	for _, subgroup := range group.Groups {
+		appIDs = append(appIDs, groupApplications(subgroup)...)
+	}
+	return appIDs
+}
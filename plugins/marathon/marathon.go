@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
 
@@ -13,24 +14,21 @@ import (
 )
 
 const (
-	pluginName           = "Marathon"
-	timeFormat           = "2006-01-02T15:04:05.999Z07:00"
-	fifteenMinute        = 15 * time.Minute
-	taskFailureThreshold = 5
+	pluginName = "Marathon"
+	timeFormat = "2006-01-02T15:04:05.999Z07:00"
 )
 
 // MarathonChecker is a plugin to check Marathon infrastructure
 type MarathonChecker struct {
-	cfg          checkerConfig
-	pluginCfg    pluginConfig
-	client       marathonlib.Marathon
-	roundtripper *httproundtripper
-	staggedtasks map[string]time.Time
-	exitedtasks  []time.Time
-	// defaultRoundTripper is the RoundTripper that will be used by MarathonClient to perform calls to Marathon API
-	defaultRoundTripper *http.RoundTripper
-	failedTasks         []failedTask
-	failedTasksMutex    sync.Mutex
+	cfg       checkerConfig
+	pluginCfg pluginConfig
+	// transport is the RoundTripper used to perform calls to Marathon API
+	transport http.RoundTripper
+	// dcos holds the DC/OS authentication token, shared by all runs
+	dcos *dcosAuthenticator
+	// failedTasks are the task failures seen during failure window, indexed by application ID
+	failedTasks      map[string][]failedTask
+	failedTasksMutex sync.Mutex
 }
 
 type failedTask struct {
@@ -54,102 +52,217 @@ func NewMarathonChecker(checkerCfg interface{}, pluginCfg interface{}) (plugins.
 		return nil, fmt.Errorf("marathon/pluginCfg: %s", err)
 	}
 
-	marathonCfg := marathonlib.NewDefaultConfig()
-	marathonCfg.URL = pCfg.Host
-	if pCfg.User != "" && pCfg.Password != "" {
-		marathonCfg.HTTPBasicAuthUser = pCfg.User
-		marathonCfg.HTTPBasicPassword = pCfg.Password
-	}
-	roundtripper := &httproundtripper{
-		defaultRoundTripper: http.DefaultTransport,
+	checker := &MarathonChecker{
+		cfg:         cfg,
+		pluginCfg:   pCfg,
+		transport:   http.DefaultTransport,
+		failedTasks: make(map[string][]failedTask),
 	}
-	marathonCfg.HTTPClient = &http.Client{
-		Transport: roundtripper,
+	if pCfg.DCOSToken != "" {
+		checker.dcos = &dcosAuthenticator{token: string(pCfg.DCOSToken)}
+	} else if pCfg.DCOSServiceAccount != nil {
+		checker.dcos = &dcosAuthenticator{
+			uid:        pCfg.DCOSServiceAccount.UID,
+			privateKey: pCfg.dcosPrivateKey,
+			loginURL:   pCfg.dcosLoginURL,
+		}
 	}
-	client, err := marathonlib.NewClient(marathonCfg)
-	if err != nil {
+
+	// validating client configuration
+	if _, err := checker.newClient(context.Background()); err != nil {
 		return nil, fmt.Errorf("marathon: %s", err)
 	}
 
-	log.Infof("marathon: Checker %q activated for application %q (warn: %d, crit; %d)", cfg.Type, cfg.ID, cfg.Warning, cfg.Critical)
-	return &MarathonChecker{
-		cfg:          cfg,
-		pluginCfg:    pCfg,
-		client:       client,
-		roundtripper: roundtripper,
-	}, nil
+	if cfg.Group != "" {
+		log.Infof("marathon: Checker %q activated for group %q (warn: %d, crit; %d)", cfg.Type, cfg.Group, cfg.Warning, cfg.Critical)
+	} else {
+		log.Infof("marathon: Checker %q activated for application %q (warn: %d, crit; %d)", cfg.Type, cfg.ID, cfg.Warning, cfg.Critical)
+	}
+	return checker, nil
+}
+
+// newClient creates a Marathon client performing its requests with the context of a run
+func (c *MarathonChecker) newClient(ctx context.Context) (marathonlib.Marathon, error) {
+	marathonCfg := marathonlib.NewDefaultConfig()
+	marathonCfg.URL = c.pluginCfg.Host
+	if c.pluginCfg.User != "" && c.pluginCfg.Password != "" {
+		marathonCfg.HTTPBasicAuthUser = c.pluginCfg.User
+		marathonCfg.HTTPBasicPassword = c.pluginCfg.Password
+	}
+	marathonCfg.HTTPClient = &http.Client{
+		Transport: &httproundtripper{
+			ctx:                 ctx,
+			defaultRoundTripper: c.transport,
+			dcos:                c.dcos,
+		},
+	}
+	return marathonlib.NewClient(marathonCfg)
 }
 
 // Name returns the name of the checker
-func (c MarathonChecker) Name() string {
+func (c *MarathonChecker) Name() string {
 	return pluginName
 }
 
 // ServiceName returns the name of the NSCA service associated to the checker
-func (c MarathonChecker) ServiceName() string {
+func (c *MarathonChecker) ServiceName() string {
 	return c.cfg.ServiceName()
 }
 
 // Periodicity returns the delay between two checks
-func (c MarathonChecker) Periodicity() *time.Duration {
+func (c *MarathonChecker) Periodicity() *time.Duration {
 	return c.cfg.Periodicity()
 }
 
+// httproundtripper performs the requests of Marathon client with the context of a run,
+// and authenticates them on DC/OS when configured
 type httproundtripper struct {
-	ctx                 *context.Context
+	ctx                 context.Context
 	defaultRoundTripper http.RoundTripper
+	dcos                *dcosAuthenticator
+}
+
+func (rt *httproundtripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := rt.ctx
+	req = req.WithContext(ctx)
+	if rt.dcos == nil {
+		return rt.defaultRoundTripper.RoundTrip(req)
+	}
+
+	token, err := rt.dcos.currentToken(ctx, rt.defaultRoundTripper)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := rt.defaultRoundTripper.RoundTrip(withDCOSToken(req, token))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || !rt.dcos.renewable() {
+		return resp, err
+	}
+	if req.Body != nil && req.GetBody == nil {
+		// request can't be sent again
+		return resp, nil
+	}
+
+	// token expired: logging in again and retrying once
+	resp.Body.Close()
+	if token, err = rt.dcos.renew(ctx, rt.defaultRoundTripper, token); err != nil {
+		return nil, err
+	}
+	retry := withDCOSToken(req, token)
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	return rt.defaultRoundTripper.RoundTrip(retry)
 }
 
-func (rt httproundtripper) RoundTrip(req *http.Request) (*http.Response, error) {
-	req = req.WithContext(*rt.ctx)
-	return rt.defaultRoundTripper.RoundTrip(req)
+// withDCOSToken returns a copy of the request, authenticated with a DC/OS token
+func withDCOSToken(req *http.Request, token string) *http.Request {
+	authenticated := req.WithContext(req.Context())
+	authenticated.Header = make(http.Header, len(req.Header)+1)
+	for key, values := range req.Header {
+		authenticated.Header[key] = values
+	}
+	authenticated.Header.Set("Authorization", "token="+token)
+	return authenticated
 }
 
 // Run is performing the checker protocol
 func (c *MarathonChecker) Run(ctx context.Context) plugins.Result {
-	appID := c.cfg.ID
-	c.roundtripper.ctx = &ctx
-	app, err := c.client.Application(appID)
+	client, err := c.newClient(ctx)
 	if err != nil {
 		return plugins.ResultFromError(c, err, "")
 	}
 
+	if c.cfg.Group != "" {
+		return c.runGroup(ctx, client)
+	}
+
+	app, err := client.Application(c.cfg.ID)
+	if err != nil {
+		return c.resultFromError(ctx, err, "")
+	}
+	return c.runApplication(ctx, client, *app)
+}
+
+// resultFromError generates a critical result from an error of Marathon client; the error of the run context
+// is reported when the run has been cancelled, as Marathon client hides it
+func (c *MarathonChecker) resultFromError(ctx context.Context, err error, prefix string) plugins.Result {
+	if ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	return plugins.ResultFromError(c, err, prefix)
+}
+
+// runApplication performs the check configured on an application
+func (c *MarathonChecker) runApplication(ctx context.Context, client marathonlib.Marathon, app marathonlib.Application) plugins.Result {
+	switch c.cfg.Type {
+	case deploymentStuckType:
+		return c.runDeploymentStuck(ctx, client, app)
+	case versionDriftType:
+		return c.runVersionDrift(ctx, app)
+	case healthRatioType:
+		return c.runHealthRatio(ctx, app)
+	default:
+		return c.runInstances(ctx, app)
+	}
+}
+
+// runInstances checks the number of running and healthy instances, staged tasks and task failures
+func (c *MarathonChecker) runInstances(ctx context.Context, app marathonlib.Application) plugins.Result {
 	log.WithFields(log.Fields{"healthy": app.TasksHealthy, "running": app.TasksRunning, "staged": app.TasksStaged, "unhealthy": app.TasksUnhealthy}).Info(app.ID)
 	running := int64(app.TasksRunning)
+	runningPerfData := plugins.NewPerfData("running", float64(running), "").WithLowerThresholds(float64(c.cfg.Warning), float64(c.cfg.Critical)).WithMin(0)
+	if app.Instances != nil {
+		runningPerfData = runningPerfData.WithMax(float64(*app.Instances))
+	}
+	perfdata := []plugins.PerfData{
+		runningPerfData,
+		plugins.NewPerfData("healthy", float64(app.TasksHealthy), "").WithMin(0),
+		plugins.NewPerfData("unhealthy", float64(app.TasksUnhealthy), "").WithMin(0),
+		plugins.NewPerfData("staged", float64(app.TasksStaged), "").WithMin(0),
+	}
+
 	if running < c.cfg.Critical {
 		return plugins.Result{
-			Status:  plugins.STATE_CRITICAL,
-			Message: fmt.Sprintf("%d/%d instances running, threshold: %d", running, *app.Instances, c.cfg.Critical),
-			Checker: c,
+			Status:   plugins.STATE_CRITICAL,
+			Message:  fmt.Sprintf("%d/%d instances running, threshold: %d", running, *app.Instances, c.cfg.Critical),
+			Checker:  c,
+			PerfData: perfdata,
 		}
 	} else if running < c.cfg.Warning {
 		return plugins.Result{
-			Status:  plugins.STATE_WARNING,
-			Message: fmt.Sprintf("%d/%d instances running, threshold: %d", running, *app.Instances, c.cfg.Warning),
-			Checker: c,
+			Status:   plugins.STATE_WARNING,
+			Message:  fmt.Sprintf("%d/%d instances running, threshold: %d", running, *app.Instances, c.cfg.Warning),
+			Checker:  c,
+			PerfData: perfdata,
 		}
 	} else if running != 0 && running == int64(app.TasksUnhealthy) {
 		return plugins.Result{
-			Status:  plugins.STATE_WARNING,
-			Message: fmt.Sprintf("%d unhealthy; %d/%d healthy instances running", app.TasksUnhealthy, (app.TasksRunning - app.TasksUnhealthy), *app.Instances),
-			Checker: c,
+			Status:   plugins.STATE_WARNING,
+			Message:  fmt.Sprintf("%d unhealthy; %d/%d healthy instances running", app.TasksUnhealthy, (app.TasksRunning - app.TasksUnhealthy), *app.Instances),
+			Checker:  c,
+			PerfData: perfdata,
 		}
 	}
 
-	log.Infof("%d instances found for %s", running, appID)
+	log.Infof("%d instances found for %s", running, app.ID)
 
-	if result := c.runStaggedTasks(ctx, *app); result.Status != plugins.STATE_OK {
+	if result := c.runStaggedTasks(ctx, app); result.Status != plugins.STATE_OK {
+		result.PerfData = perfdata
 		return result
 	}
 
-	if result := c.runExitedTasks(ctx, *app); result.Status != plugins.STATE_OK {
+	if result := c.runExitedTasks(ctx, app); result.Status != plugins.STATE_OK {
+		result.PerfData = perfdata
 		return result
 	}
 
 	return plugins.Result{
-		Status:  plugins.STATE_OK,
-		Message: fmt.Sprintf("OK: %d running; %d unhealthy; %d staged", (app.TasksRunning - app.TasksUnhealthy), app.TasksUnhealthy, app.TasksStaged),
-		Checker: c,
+		Status:   plugins.STATE_OK,
+		Message:  fmt.Sprintf("OK: %d running; %d unhealthy; %d staged", (app.TasksRunning - app.TasksUnhealthy), app.TasksUnhealthy, app.TasksStaged),
+		Checker:  c,
+		PerfData: perfdata,
 	}
 }
 
@@ -178,10 +291,10 @@ func (c *MarathonChecker) runStaggedTasks(ctx context.Context, app marathonlib.A
 		}
 
 		staggedSince := time.Since(staggedDate)
-		if staggedSince > fifteenMinute {
+		if staggedSince > c.cfg.staggerWindow() {
 			return plugins.Result{
 				Status:  plugins.STATE_WARNING,
-				Message: "task stagged since 15 minutes",
+				Message: fmt.Sprintf("task stagged since %s minutes", formatMinutes(c.cfg.staggerWindow())),
 				Checker: c,
 			}
 		}
@@ -206,7 +319,7 @@ func (c *MarathonChecker) runExitedTasks(ctx context.Context, app marathonlib.Ap
 	}
 
 	if app.LastTaskFailure == nil {
-		c.failedTasks = remainingTasks
+		delete(c.failedTasks, app.ID)
 		return resultOK
 	}
 
@@ -217,18 +330,18 @@ func (c *MarathonChecker) runExitedTasks(ctx context.Context, app marathonlib.Ap
 		return resultOK
 	}
 
-	fifteenMinuteAgo := time.Now().Add(-fifteenMinute)
-	if fifteenMinuteAgo.After(timestamp) {
-		// last task failure is older than 15 min, lets move out
-		c.failedTasks = remainingTasks
+	windowStart := time.Now().Add(-c.cfg.failureWindow())
+	if windowStart.After(timestamp) {
+		// last task failure is older than failure window, lets move out
+		delete(c.failedTasks, app.ID)
 		return resultOK
 	}
 
-	for _, task := range c.failedTasks {
+	for _, task := range c.failedTasks[app.ID] {
 		if task.taskID == ltf.TaskID {
 			continue
 		}
-		if fifteenMinuteAgo.After(task.date) {
+		if windowStart.After(task.date) {
 			continue
 		}
 		remainingTasks = append(remainingTasks, task)
@@ -238,11 +351,11 @@ func (c *MarathonChecker) runExitedTasks(ctx context.Context, app marathonlib.Ap
 		taskID: ltf.TaskID,
 	})
 
-	c.failedTasks = remainingTasks
-	if len(remainingTasks) >= taskFailureThreshold {
+	c.failedTasks[app.ID] = remainingTasks
+	if len(remainingTasks) >= c.cfg.FailureThreshold {
 		return plugins.Result{
 			Status:  plugins.STATE_WARNING,
-			Message: fmt.Sprintf("Last %d tasks failed (during last 15min): %s", taskFailureThreshold, ltf.Message),
+			Message: fmt.Sprintf("Last %d tasks failed (during last %smin): %s", c.cfg.FailureThreshold, formatMinutes(c.cfg.failureWindow()), ltf.Message),
 			Checker: c,
 		}
 	}
@@ -254,6 +367,11 @@ func (c *MarathonChecker) runExitedTasks(ctx context.Context, app marathonlib.Ap
 	}
 }
 
+// formatMinutes renders a duration as a number of minutes
+func formatMinutes(d time.Duration) string {
+	return strconv.FormatFloat(d.Minutes(), 'f', -1, 64)
+}
+
 func parseMarathonDateTime(value string) (time.Time, error) {
 	var date time.Time
 	if value == "" {
@@ -2,6 +2,19 @@ package marathon
 
 import (
 	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -71,7 +84,7 @@ func TestMarathon(t *testing.T) {
 	marathonChecker := checker.(*MarathonChecker)
 	mock := amock.NewMock()
 	mock.Expect(200, &marathonMock).OnIdentifier("app").OnFunc(marathonChecker.Run).Sticky()
-	marathonChecker.roundtripper.defaultRoundTripper = mock
+	marathonChecker.transport = mock
 
 	ctxRun, cancelFunc1 := context.WithTimeout(context.Background(), time.Second)
 	defer cancelFunc1()
@@ -135,7 +148,7 @@ func TestMarathon(t *testing.T) {
 	marathonChecker = checker.(*MarathonChecker)
 	mock = amock.NewMock()
 	mock.Expect(404, map[string]string{"message": "application not found"}).OnIdentifier("unknown-app").OnFunc(marathonChecker.Run)
-	marathonChecker.roundtripper.defaultRoundTripper = mock
+	marathonChecker.transport = mock
 
 	ctxRun, cancelFunc1 = context.WithTimeout(context.Background(), time.Second)
 	defer cancelFunc1()
@@ -178,7 +191,7 @@ func TestMarathonLastTaskFailure(t *testing.T) {
 	marathonChecker := checker.(*MarathonChecker)
 	mock := amock.NewMock()
 	mock.Expect(200, &marathonMock).OnIdentifier("app").OnFunc(marathonChecker.Run).Sticky()
-	marathonChecker.roundtripper.defaultRoundTripper = mock
+	marathonChecker.transport = mock
 
 	ctxRun, cancelFunc1 := context.WithTimeout(context.Background(), time.Second)
 	defer cancelFunc1()
@@ -272,3 +285,519 @@ func TestMarathonLastTaskFailure(t *testing.T) {
 	assert.Equal(t, plugins.STATE_WARNING, result.Status)
 	assert.Equal(t, "Last 5 tasks failed (during last 15min):  exit code: 2", result.Message)
 }
+
+func TestMarathonWindows(t *testing.T) {
+	marathonMock := mockApp
+	app := *marathonMock.Application
+	marathonMock.Application = &app
+	marathonMock.Application.Tasks = []*marathonlib.Task{
+		{
+			ID:       "app1",
+			AppID:    "/production/app",
+			StagedAt: time.Now().UTC().Add(-10 * time.Minute).Format(timeFormat),
+		},
+	}
+	marathonMock.Application.LastTaskFailure = &marathonlib.LastTaskFailure{
+		AppID:     "/production/app",
+		Message:   " exit code: 2",
+		State:     "TASK_FAILED",
+		TaskID:    "task1",
+		Timestamp: time.Now().UTC().Add(-20 * time.Minute).Format(timeFormat),
+	}
+
+	cfg := map[string]interface{}{
+		"type":              "minimum_healthy_instances",
+		"id":                marathonMock.Application.ID,
+		"warn":              2,
+		"crit":              1,
+		"name":              "test-1",
+		"stagger_window":    300,
+		"failure_window":    1800,
+		"failure_threshold": 2,
+	}
+	pluginCfg := map[string]interface{}{
+		"host": "http://example.com",
+	}
+	checker, err := NewMarathonChecker(cfg, pluginCfg)
+	assert.Nilf(t, err, "marathon checker instantiation failed: %q", err)
+
+	marathonChecker := checker.(*MarathonChecker)
+	mock := amock.NewMock()
+	mock.Expect(200, &marathonMock).OnIdentifier("app").OnFunc(marathonChecker.Run).Sticky()
+	marathonChecker.transport = mock
+
+	// task staged 10 minutes ago, above stagger window
+	result := marathonChecker.Run(context.Background())
+	assert.Equal(t, plugins.STATE_WARNING, result.Status)
+	assert.Equal(t, "task stagged since 5 minutes", result.Message)
+
+	// task failures within failure window
+	marathonMock.Application.Tasks = []*marathonlib.Task{}
+	result = marathonChecker.Run(context.Background())
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+
+	marathonMock.Application.LastTaskFailure.TaskID = "task2"
+	marathonMock.Application.LastTaskFailure.Timestamp = time.Now().UTC().Add(-10 * time.Minute).Format(timeFormat)
+	result = marathonChecker.Run(context.Background())
+	assert.Equal(t, plugins.STATE_WARNING, result.Status)
+	assert.Equal(t, "Last 2 tasks failed (during last 30min):  exit code: 2", result.Message)
+}
+
+func TestMarathonDeploymentStuck(t *testing.T) {
+	marathonMock := mockApp
+	app := *marathonMock.Application
+	marathonMock.Application = &app
+
+	cfg := map[string]interface{}{
+		"type": "deployment_stuck",
+		"id":   marathonMock.Application.ID,
+		"warn": 600,
+		"crit": 1800,
+		"name": "test-1",
+	}
+	pluginCfg := map[string]interface{}{
+		"host": "http://example.com",
+	}
+	checker, err := NewMarathonChecker(cfg, pluginCfg)
+	assert.Nilf(t, err, "marathon checker instantiation failed: %q", err)
+
+	deployments := []*marathonlib.Deployment{
+		{
+			ID:           "deployment-1",
+			Version:      time.Now().UTC().Add(-20 * time.Minute).Format(timeFormat),
+			AffectedApps: []string{"/production/app"},
+			CurrentStep:  1,
+			TotalSteps:   2,
+		},
+	}
+
+	marathonChecker := checker.(*MarathonChecker)
+	mock := amock.NewMock()
+	mock.Expect(200, &marathonMock).OnIdentifier("app").OnFunc(marathonChecker.Run).Sticky()
+	mock.Expect(200, &deployments).OnIdentifier("deployments").OnFunc(marathonChecker.Run).Sticky()
+	marathonChecker.transport = mock
+
+	result := marathonChecker.Run(context.Background())
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+	assert.Equal(t, "OK: no deployment in progress", result.Message)
+	assert.Equal(t, "deployment=0s;600;1800;0", plugins.FormatPerfData(result.PerfData))
+
+	// deployment in progress since 20 minutes
+	marathonMock.Application.Deployments = []map[string]string{{"id": "deployment-1"}}
+	result = marathonChecker.Run(context.Background())
+	assert.Equal(t, plugins.STATE_WARNING, result.Status)
+	assert.Equal(t, "deployment deployment-1 in progress since 20m0s (step 1/2), threshold: 10m0s", result.Message)
+
+	// deployment in progress since 1 hour
+	deployments[0].Version = time.Now().UTC().Add(-time.Hour).Format(timeFormat)
+	result = marathonChecker.Run(context.Background())
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+	assert.Equal(t, "deployment deployment-1 in progress since 1h0m0s (step 1/2), threshold: 30m0s", result.Message)
+
+	// deployment just started
+	deployments[0].Version = time.Now().UTC().Add(-time.Minute).Format(timeFormat)
+	result = marathonChecker.Run(context.Background())
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+	assert.Equal(t, "OK: deployment deployment-1 in progress since 1m0s (step 1/2)", result.Message)
+
+	// thresholds are required
+	delete(cfg, "warn")
+	delete(cfg, "crit")
+	_, err = NewMarathonChecker(cfg, pluginCfg)
+	assert.EqualError(t, err, `marathon/cfg: warn or crit key is required for type "deployment_stuck"`)
+}
+
+func TestMarathonVersionDrift(t *testing.T) {
+	marathonMock := mockApp
+	app := *marathonMock.Application
+	marathonMock.Application = &app
+	configuredAt := time.Now().UTC().Add(-2 * time.Hour).Format(timeFormat)
+	marathonMock.Application.Version = time.Now().UTC().Add(-time.Hour).Format(timeFormat)
+	marathonMock.Application.VersionInfo = &marathonlib.VersionInfo{
+		LastScalingAt:      marathonMock.Application.Version,
+		LastConfigChangeAt: configuredAt,
+	}
+	marathonMock.Application.Tasks = []*marathonlib.Task{
+		{ID: "app1", AppID: "/production/app", Version: configuredAt},
+		{ID: "app2", AppID: "/production/app", Version: marathonMock.Application.Version},
+	}
+
+	cfg := map[string]interface{}{
+		"type": "version_drift",
+		"id":   marathonMock.Application.ID,
+		"warn": 600,
+		"name": "test-1",
+	}
+	pluginCfg := map[string]interface{}{
+		"host": "http://example.com",
+	}
+	checker, err := NewMarathonChecker(cfg, pluginCfg)
+	assert.Nilf(t, err, "marathon checker instantiation failed: %q", err)
+
+	marathonChecker := checker.(*MarathonChecker)
+	mock := amock.NewMock()
+	mock.Expect(200, &marathonMock).OnIdentifier("app").OnFunc(marathonChecker.Run).Sticky()
+	marathonChecker.transport = mock
+
+	// scaled application: tasks run the current configuration
+	result := marathonChecker.Run(context.Background())
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+	assert.Equal(t, "OK: 2 tasks running version "+configuredAt, result.Message)
+	assert.Equal(t, "outdated=0;;;0;2", plugins.FormatPerfData(result.PerfData))
+
+	// configuration changed 1 hour ago, one task still running previous version
+	marathonMock.Application.VersionInfo.LastConfigChangeAt = marathonMock.Application.Version
+	result = marathonChecker.Run(context.Background())
+	assert.Equal(t, plugins.STATE_WARNING, result.Status)
+	assert.Equal(t, "1/2 tasks running a version older than "+marathonMock.Application.Version+" since 1h0m0s, threshold: 10m0s", result.Message)
+	assert.Equal(t, "outdated=1;;;0;2", plugins.FormatPerfData(result.PerfData))
+}
+
+func TestMarathonHealthRatio(t *testing.T) {
+	marathonMock := mockApp
+	app := *marathonMock.Application
+	marathonMock.Application = &app
+	marathonMock.Application.TasksRunning = 4
+	marathonMock.Application.TasksHealthy = 3
+	marathonMock.Application.TasksUnhealthy = 1
+
+	cfg := map[string]interface{}{
+		"type": "health_ratio",
+		"id":   marathonMock.Application.ID,
+		"warn": 20,
+		"crit": 50,
+		"name": "test-1",
+	}
+	pluginCfg := map[string]interface{}{
+		"host": "http://example.com",
+	}
+	checker, err := NewMarathonChecker(cfg, pluginCfg)
+	assert.Nilf(t, err, "marathon checker instantiation failed: %q", err)
+
+	marathonChecker := checker.(*MarathonChecker)
+	mock := amock.NewMock()
+	mock.Expect(200, &marathonMock).OnIdentifier("app").OnFunc(marathonChecker.Run).Sticky()
+	marathonChecker.transport = mock
+
+	result := marathonChecker.Run(context.Background())
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+	assert.Equal(t, "OK: no health checks defined", result.Message)
+
+	marathonMock.Application.HealthChecks = &[]marathonlib.HealthCheck{{Protocol: "HTTP"}}
+	result = marathonChecker.Run(context.Background())
+	assert.Equal(t, plugins.STATE_WARNING, result.Status)
+	assert.Equal(t, "1/4 running tasks unhealthy, threshold: 20%", result.Message)
+	assert.Equal(t, "unhealthy=25%;20;50;0;100", plugins.FormatPerfData(result.PerfData))
+
+	marathonMock.Application.TasksHealthy = 1
+	marathonMock.Application.TasksUnhealthy = 3
+	result = marathonChecker.Run(context.Background())
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+	assert.Equal(t, "3/4 running tasks unhealthy, threshold: 50%", result.Message)
+
+	marathonMock.Application.TasksHealthy = 4
+	marathonMock.Application.TasksUnhealthy = 0
+	result = marathonChecker.Run(context.Background())
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+	assert.Equal(t, "OK: 0/4 running tasks unhealthy", result.Message)
+}
+
+func TestMarathonGroup(t *testing.T) {
+	webMock := mockApp
+	web := *webMock.Application
+	webMock.Application = &web
+	webMock.Application.Tasks = []*marathonlib.Task{}
+
+	workerMock := mockApp
+	worker := *workerMock.Application
+	workerMock.Application = &worker
+	workerMock.Application.Tasks = []*marathonlib.Task{}
+	workerMock.Application.ID = "/production/workers/worker"
+	workerMock.Application.TasksRunning = 0
+	workerMock.Application.TasksHealthy = 0
+
+	group := &marathonlib.Group{
+		ID:   "/production",
+		Apps: []*marathonlib.Application{{ID: "/production/app"}},
+		Groups: []*marathonlib.Group{
+			{
+				ID:   "/production/workers",
+				Apps: []*marathonlib.Application{{ID: "/production/workers/worker"}},
+			},
+		},
+	}
+
+	cfg := map[string]interface{}{
+		"type":  "minimum_healthy_instances",
+		"group": "/production",
+		"warn":  2,
+		"crit":  1,
+		"name":  "test-1",
+	}
+	pluginCfg := map[string]interface{}{
+		"host": "http://example.com",
+	}
+	checker, err := NewMarathonChecker(cfg, pluginCfg)
+	assert.Nilf(t, err, "marathon checker instantiation failed: %q", err)
+
+	marathonChecker := checker.(*MarathonChecker)
+	mock := amock.NewMock()
+	mock.Expect(200, group).OnIdentifier("groups").OnFunc(marathonChecker.Run).Sticky()
+	mock.Expect(200, &webMock).OnIdentifier("app").OnFunc(marathonChecker.Run).Sticky()
+	mock.Expect(200, &workerMock).OnIdentifier("worker").OnFunc(marathonChecker.Run).Sticky()
+	marathonChecker.transport = mock
+
+	result := marathonChecker.Run(context.Background())
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+	assert.Equal(t, "1/2 applications failing: /production/workers/worker: 0/2 instances running, threshold: 1", result.Message)
+	assert.Equal(t, "applications=2;;;0 failing=1;;;0;2", plugins.FormatPerfData(result.PerfData))
+
+	workerMock.Application.TasksRunning = 2
+	workerMock.Application.TasksHealthy = 2
+	result = marathonChecker.Run(context.Background())
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+	assert.Equal(t, "OK: 2 applications", result.Message)
+
+	// id and group are exclusive
+	cfg["id"] = "/production/app"
+	_, err = NewMarathonChecker(cfg, pluginCfg)
+	assert.EqualError(t, err, "marathon/cfg: exactly one of id or group keys is required")
+}
+
+func TestMarathonConcurrentRuns(t *testing.T) {
+	marathonMock := mockApp
+	app := *marathonMock.Application
+	marathonMock.Application = &app
+	marathonMock.Application.Tasks = []*marathonlib.Task{}
+
+	cfg := map[string]interface{}{
+		"type": "minimum_healthy_instances",
+		"id":   marathonMock.Application.ID,
+		"warn": 2,
+		"crit": 1,
+		"name": "test-1",
+	}
+	pluginCfg := map[string]interface{}{
+		"host": "http://example.com",
+	}
+	checker, err := NewMarathonChecker(cfg, pluginCfg)
+	assert.Nilf(t, err, "marathon checker instantiation failed: %q", err)
+
+	marathonChecker := checker.(*MarathonChecker)
+	mock := amock.NewMock()
+	mock.Expect(200, &marathonMock).OnIdentifier("app").OnFunc(marathonChecker.Run).Sticky()
+	marathonChecker.transport = mock
+
+	// a cancelled run doesn't affect the other runs
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(cancelled bool) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			if cancelled {
+				cancel()
+			}
+
+			result := marathonChecker.Run(ctx)
+			if cancelled {
+				assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+				assert.Contains(t, result.Message, "context canceled")
+			} else {
+				assert.Equal(t, plugins.STATE_OK, result.Status)
+				assert.Equal(t, "OK: 2 running; 0 unhealthy; 0 staged", result.Message)
+			}
+		}(i%2 == 0)
+	}
+	wg.Wait()
+
+	// a slow run doesn't block the following ones
+	started := make(chan struct{})
+	marathonChecker.transport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Context().Value(slowRunKey{}) != nil {
+			close(started)
+			<-req.Context().Done()
+			return nil, req.Context().Err()
+		}
+		return mock.RoundTrip(req)
+	})
+
+	slowCtx, cancelSlow := context.WithCancel(context.WithValue(context.Background(), slowRunKey{}, true))
+	slowResult := make(chan plugins.Result)
+	go func() {
+		slowResult <- marathonChecker.Run(slowCtx)
+	}()
+	<-started
+
+	result := marathonChecker.Run(context.Background())
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+
+	cancelSlow()
+	result = <-slowResult
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+	assert.Contains(t, result.Message, "context canceled")
+}
+
+// slowRunKey marks the context of a run whose requests never complete
+type slowRunKey struct{}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// dcosServer is a fake DC/OS cluster, serving Marathon API and login endpoint
+type dcosServer struct {
+	t         *testing.T
+	publicKey *rsa.PublicKey
+	app       app
+
+	mutex  sync.Mutex
+	logins int
+	token  string
+}
+
+func (s *dcosServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if req.URL.Path == "/acs/api/v1/auth/login" {
+		var login struct {
+			UID   string `json:"uid"`
+			Token string `json:"token"`
+		}
+		assert.Nil(s.t, json.NewDecoder(req.Body).Decode(&login))
+		assert.Equal(s.t, "jagozzi", login.UID)
+
+		// verifying JWT signature and claims
+		parts := strings.Split(login.Token, ".")
+		if assert.Len(s.t, parts, 3) {
+			digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+			signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+			assert.Nil(s.t, rsa.VerifyPKCS1v15(s.publicKey, crypto.SHA256, digest[:], signature))
+
+			payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+			claims := map[string]interface{}{}
+			assert.Nil(s.t, json.Unmarshal(payload, &claims))
+			assert.Equal(s.t, "jagozzi", claims["uid"])
+		}
+
+		s.logins++
+		s.token = fmt.Sprintf("token-%d", s.logins)
+		json.NewEncoder(w).Encode(map[string]string{"token": s.token})
+		return
+	}
+
+	if s.token == "" || req.Header.Get("Authorization") != "token="+s.token {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"message": "invalid token"})
+		return
+	}
+	json.NewEncoder(w).Encode(&s.app)
+}
+
+// expire invalidates the current token
+func (s *dcosServer) expire() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.token = "expired"
+}
+
+func TestMarathonDCOSServiceAccount(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	privateKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	marathonMock := mockApp
+	application := *marathonMock.Application
+	marathonMock.Application = &application
+	marathonMock.Application.Tasks = []*marathonlib.Task{}
+
+	dcos := &dcosServer{t: t, publicKey: &key.PublicKey, app: marathonMock}
+	server := httptest.NewServer(dcos)
+	defer server.Close()
+
+	cfg := map[string]interface{}{
+		"type": "minimum_healthy_instances",
+		"id":   marathonMock.Application.ID,
+		"warn": 2,
+		"crit": 1,
+		"name": "test-1",
+	}
+	pluginCfg := map[string]interface{}{
+		"host": server.URL,
+		"dcos_service_account": map[string]interface{}{
+			"uid":         "jagozzi",
+			"private_key": string(privateKey),
+		},
+	}
+	checker, err := NewMarathonChecker(cfg, pluginCfg)
+	assert.Nilf(t, err, "marathon checker instantiation failed: %q", err)
+
+	result := checker.Run(context.Background())
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+	assert.Equal(t, "OK: 2 running; 0 unhealthy; 0 staged", result.Message)
+
+	// token is reused across runs
+	result = checker.Run(context.Background())
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+	assert.Equal(t, 1, dcos.logins)
+
+	// token is renewed once expired
+	dcos.expire()
+	result = checker.Run(context.Background())
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+	assert.Equal(t, 2, dcos.logins)
+
+	// static token can't be renewed
+	pluginCfg = map[string]interface{}{
+		"host":       server.URL,
+		"dcos_token": "token-2",
+	}
+	checker, err = NewMarathonChecker(cfg, pluginCfg)
+	assert.Nilf(t, err, "marathon checker instantiation failed: %q", err)
+
+	result = checker.Run(context.Background())
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+
+	dcos.expire()
+	result = checker.Run(context.Background())
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+	assert.Equal(t, "Marathon API error: invalid token", result.Message)
+	assert.Equal(t, 2, dcos.logins)
+
+	// invalid configurations
+	pluginCfg = map[string]interface{}{
+		"host":       server.URL,
+		"user":       "marathon",
+		"password":   "password",
+		"dcos_token": "token",
+	}
+	_, err = NewMarathonChecker(cfg, pluginCfg)
+	assert.EqualError(t, err, "marathon/pluginCfg: user/password, dcos_token and dcos_service_account keys are incompatible")
+
+	pluginCfg = map[string]interface{}{
+		"host": server.URL,
+		"dcos_service_account": map[string]interface{}{
+			"uid": "jagozzi",
+		},
+	}
+	_, err = NewMarathonChecker(cfg, pluginCfg)
+	assert.EqualError(t, err, "marathon/pluginCfg: dcos_service_account: exactly one of private_key or private_key_file keys is required")
+
+	pluginCfg = map[string]interface{}{
+		"host": server.URL,
+		"dcos_service_account": map[string]interface{}{
+			"uid":         "jagozzi",
+			"private_key": "invalid",
+		},
+	}
+	_, err = NewMarathonChecker(cfg, pluginCfg)
+	assert.EqualError(t, err, "marathon/pluginCfg: dcos_service_account: invalid private key: no PEM data found")
+}
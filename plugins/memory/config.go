@@ -0,0 +1,72 @@
+package memory
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/rbeuque74/jagozzi/config"
+	validator "gopkg.in/go-playground/validator.v9"
+)
+
+const (
+	typeUsedPercent     = "used_percent"
+	typeAvailable       = "available"
+	typeSwapUsedPercent = "swap_used_percent"
+)
+
+type rawMemoryConfig struct {
+	config.GenericPluginConfiguration
+	Type     string          `json:"type" validate:"required,eq=used_percent|eq=available|eq=swap_used_percent"`
+	Warning  json.RawMessage `json:"warn" validate:"required"`
+	Critical json.RawMessage `json:"crit" validate:"required"`
+}
+
+type memoryConfig struct {
+	rawMemoryConfig
+	// warning and critical are the thresholds, either in percent or in bytes depending on check type
+	warning  float64
+	critical float64
+	// warningPercent and criticalPercent are set when available thresholds are in percent of total memory
+	warningPercent  bool
+	criticalPercent bool
+}
+
+func (cfg *memoryConfig) UnmarshalJSON(b []byte) error {
+	raw := &rawMemoryConfig{}
+
+	if err := config.UnmarshalConfig(b, raw); err != nil {
+		return err
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(raw); err != nil {
+		return err
+	}
+
+	cfg.rawMemoryConfig = *raw
+
+	var err error
+	if cfg.warning, cfg.warningPercent, err = cfg.threshold(raw.Warning); err != nil {
+		return fmt.Errorf("warn: %s", err)
+	}
+	if cfg.critical, cfg.criticalPercent, err = cfg.threshold(raw.Critical); err != nil {
+		return fmt.Errorf("crit: %s", err)
+	}
+
+	return nil
+}
+
+// threshold parses a threshold as a percentage or as a size, depending on check type; available thresholds are sizes
+// unless suffixed by %
+func (cfg memoryConfig) threshold(b json.RawMessage) (float64, bool, error) {
+	if cfg.Type == typeAvailable && !strings.HasSuffix(strings.TrimSpace(strings.Trim(string(b), `"`)), "%") {
+		var size config.Size
+		err := json.Unmarshal(b, &size)
+		return float64(size), false, err
+	}
+
+	var percent config.Percent
+	err := json.Unmarshal(b, &percent)
+	return float64(percent), true, err
+}
@@ -0,0 +1,212 @@
+package memory
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/rbeuque74/jagozzi/config"
+	"github.com/rbeuque74/jagozzi/plugins"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	pluginName         = "Memory"
+	defaultMeminfoFile = "/proc/meminfo"
+)
+
+func init() {
+	plugins.Register(pluginName, NewMemoryChecker)
+}
+
+// MemoryChecker is a plugin to check memory and swap usage
+type MemoryChecker struct {
+	cfg         memoryConfig
+	meminfoFile string
+}
+
+// Name returns the name of the checker
+func (c MemoryChecker) Name() string {
+	return pluginName
+}
+
+// ServiceName returns the name of the NSCA service associated to the checker
+func (c MemoryChecker) ServiceName() string {
+	return c.cfg.Name
+}
+
+// Periodicity returns the delay between two checks
+func (c MemoryChecker) Periodicity() *time.Duration {
+	return c.cfg.Periodicity()
+}
+
+// Run is performing the checker protocol
+func (c *MemoryChecker) Run(ctx context.Context) plugins.Result {
+	meminfo, err := c.meminfo()
+	if err != nil {
+		return plugins.ResultFromError(c, err, "unable to read memory information")
+	}
+
+	switch c.cfg.Type {
+	case typeAvailable:
+		available := meminfo.available()
+		warning, critical := c.availableThresholds(meminfo["MemTotal"])
+		perfdata := plugins.NewPerfData("available", float64(available), "B").
+			WithLowerThresholds(warning, critical).
+			WithMin(0).
+			WithMax(float64(meminfo["MemTotal"]))
+		return plugins.Result{
+			Status:   statusLower(float64(available), warning, critical),
+			Message:  fmt.Sprintf("Memory available: %s", config.Size(available)),
+			Checker:  c,
+			PerfData: []plugins.PerfData{perfdata},
+		}
+	case typeSwapUsedPercent:
+		used := meminfo.swapUsedPercent()
+		return plugins.Result{
+			Status:   c.statusUpper(used),
+			Message:  fmt.Sprintf("Swap used: %g%%", used),
+			Checker:  c,
+			PerfData: []plugins.PerfData{c.percentPerfData("swap_used", used)},
+		}
+	default:
+		used := meminfo.usedPercent()
+		return plugins.Result{
+			Status:   c.statusUpper(used),
+			Message:  fmt.Sprintf("Memory used: %g%%", used),
+			Checker:  c,
+			PerfData: []plugins.PerfData{c.percentPerfData("used", used)},
+		}
+	}
+}
+
+// statusUpper returns the status of a value that is critical when going above thresholds
+func (c MemoryChecker) statusUpper(value float64) plugins.StatusEnum {
+	if value >= c.cfg.critical {
+		return plugins.STATE_CRITICAL
+	} else if value >= c.cfg.warning {
+		return plugins.STATE_WARNING
+	}
+	return plugins.STATE_OK
+}
+
+// availableThresholds returns the available thresholds in bytes, converting percentages of total memory
+func (c MemoryChecker) availableThresholds(total uint64) (float64, float64) {
+	warning, critical := c.cfg.warning, c.cfg.critical
+	if c.cfg.warningPercent {
+		warning = math.Floor(warning * float64(total) / 100)
+	}
+	if c.cfg.criticalPercent {
+		critical = math.Floor(critical * float64(total) / 100)
+	}
+	return warning, critical
+}
+
+// statusLower returns the status of a value that is critical when going below thresholds
+func statusLower(value, warning, critical float64) plugins.StatusEnum {
+	if value <= critical {
+		return plugins.STATE_CRITICAL
+	} else if value <= warning {
+		return plugins.STATE_WARNING
+	}
+	return plugins.STATE_OK
+}
+
+func (c MemoryChecker) percentPerfData(label string, value float64) plugins.PerfData {
+	return plugins.NewPerfData(label, value, "%").
+		WithThresholds(c.cfg.warning, c.cfg.critical).
+		WithMin(0).
+		WithMax(100)
+}
+
+// meminfo is the content of meminfo file, in bytes
+type meminfo map[string]uint64
+
+func (c MemoryChecker) meminfo() (meminfo, error) {
+	file, err := os.Open(c.meminfoFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info := make(meminfo)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(strings.Replace(scanner.Text(), ":", " ", 1))
+		if len(fields) < 2 {
+			continue
+		}
+
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for %q: %s", fields[0], err)
+		}
+		if len(fields) > 2 && fields[2] == "kB" {
+			value = value * 1024
+		}
+		info[fields[0]] = value
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if _, ok := info["MemTotal"]; !ok {
+		return nil, fmt.Errorf("MemTotal not found in %s", c.meminfoFile)
+	}
+	return info, nil
+}
+
+// available returns the memory that can be used without swapping
+func (info meminfo) available() uint64 {
+	if available, ok := info["MemAvailable"]; ok {
+		return available
+	}
+	// kernels older than 3.14 don't expose MemAvailable
+	return info["MemFree"] + info["Buffers"] + info["Cached"]
+}
+
+func (info meminfo) usedPercent() float64 {
+	total := info["MemTotal"]
+	available := info.available()
+	if total == 0 || available > total {
+		return 0
+	}
+	return plugins.Round(float64(total-available) / float64(total) * 100)
+}
+
+func (info meminfo) swapUsedPercent() float64 {
+	total, free := info["SwapTotal"], info["SwapFree"]
+	if total == 0 || free > total {
+		return 0
+	}
+	return plugins.Round(float64(total-free) / float64(total) * 100)
+}
+
+// NewMemoryChecker create a Memory checker
+func NewMemoryChecker(conf interface{}, pluginConf interface{}) (plugins.Checker, error) {
+	out, err := yaml.Marshal(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := memoryConfig{}
+	err = yaml.Unmarshal(out, &cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	checker := &MemoryChecker{
+		cfg:         cfg,
+		meminfoFile: defaultMeminfoFile,
+	}
+
+	log.Infof("memory: Checker %q activated", cfg.Type)
+	return checker, nil
+}
@@ -0,0 +1,161 @@
+package memory
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rbeuque74/jagozzi/plugins"
+	"github.com/stretchr/testify/assert"
+)
+
+// 4G total, 1G available, 2G of swap with 512M used
+const fixtureMeminfo = `MemTotal:        4194304 kB
+MemFree:          262144 kB
+MemAvailable:    1048576 kB
+Buffers:          131072 kB
+Cached:           524288 kB
+SwapCached:            0 kB
+SwapTotal:       2097152 kB
+SwapFree:        1572864 kB
+HugePages_Total:       0
+`
+
+func fixtureFile(t *testing.T, content string) (string, func()) {
+	file, err := ioutil.TempFile("", "jagozzi-meminfo")
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if _, err := file.WriteString(content); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	if err := file.Close(); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	return file.Name(), func() {
+		os.Remove(file.Name())
+	}
+}
+
+func runChecker(t *testing.T, cfg map[string]interface{}, meminfoFile string) plugins.Result {
+	checker, err := NewMemoryChecker(cfg, nil)
+	assert.Nilf(t, err, "memory checker instantiation failed: %q", err)
+	if err != nil {
+		t.FailNow()
+	}
+
+	checker.(*MemoryChecker).meminfoFile = meminfoFile
+
+	ctxRun, cancelFunc := context.WithTimeout(context.Background(), time.Second)
+	defer cancelFunc()
+	return checker.Run(ctxRun)
+}
+
+func TestMemoryUsedPercent(t *testing.T) {
+	meminfoFile, teardown := fixtureFile(t, fixtureMeminfo)
+	defer teardown()
+
+	cfg := map[string]interface{}{
+		"type": "used_percent",
+		"warn": "80%",
+		"crit": "90%",
+		"name": "test-1",
+	}
+	checker, err := NewMemoryChecker(cfg, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "Memory", checker.Name())
+	assert.Equal(t, "test-1", checker.ServiceName())
+
+	result := runChecker(t, cfg, meminfoFile)
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+	assert.Equal(t, "Memory used: 75%", result.Message)
+	assert.Equal(t, "used=75%;80;90;0;100", plugins.FormatPerfData(result.PerfData))
+
+	cfg["warn"] = 70
+	result = runChecker(t, cfg, meminfoFile)
+	assert.Equal(t, plugins.STATE_WARNING, result.Status)
+
+	cfg["crit"] = "75"
+	result = runChecker(t, cfg, meminfoFile)
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+}
+
+func TestMemoryAvailable(t *testing.T) {
+	meminfoFile, teardown := fixtureFile(t, fixtureMeminfo)
+	defer teardown()
+
+	cfg := map[string]interface{}{
+		"type": "available",
+		"warn": "512M",
+		"crit": "256M",
+		"name": "test-1",
+	}
+	result := runChecker(t, cfg, meminfoFile)
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+	assert.Equal(t, "Memory available: 1.0G", result.Message)
+	assert.Equal(t, "available=1073741824B;536870912:;268435456:;0;4294967296", plugins.FormatPerfData(result.PerfData))
+
+	cfg["warn"] = "1G"
+	result = runChecker(t, cfg, meminfoFile)
+	assert.Equal(t, plugins.STATE_WARNING, result.Status)
+
+	cfg["crit"] = "2GB"
+	result = runChecker(t, cfg, meminfoFile)
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+
+	// kernels without MemAvailable
+	oldMeminfoFile, teardownOld := fixtureFile(t, "MemTotal: 4194304 kB\nMemFree: 262144 kB\nBuffers: 131072 kB\nCached: 524288 kB\n")
+	defer teardownOld()
+
+	cfg["warn"] = "512M"
+	cfg["crit"] = "256M"
+	result = runChecker(t, cfg, oldMeminfoFile)
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+	assert.Equal(t, "Memory available: 896.0M", result.Message)
+
+	// thresholds in percent of total memory
+	cfg["warn"] = "30%"
+	cfg["crit"] = "256M"
+	result = runChecker(t, cfg, meminfoFile)
+	assert.Equal(t, plugins.STATE_WARNING, result.Status)
+	assert.Equal(t, "available=1073741824B;1288490188:;268435456:;0;4294967296", plugins.FormatPerfData(result.PerfData))
+
+	cfg["warn"] = "20%"
+	result = runChecker(t, cfg, meminfoFile)
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+
+	// invalid size
+	cfg["warn"] = "12X"
+	_, err := NewMemoryChecker(cfg, nil)
+	assert.NotNil(t, err)
+}
+
+func TestMemorySwap(t *testing.T) {
+	meminfoFile, teardown := fixtureFile(t, fixtureMeminfo)
+	defer teardown()
+
+	cfg := map[string]interface{}{
+		"type": "swap_used_percent",
+		"warn": "50%",
+		"crit": "70%",
+		"name": "test-1",
+	}
+	result := runChecker(t, cfg, meminfoFile)
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+	assert.Equal(t, "Swap used: 25%", result.Message)
+	assert.Equal(t, "swap_used=25%;50;70;0;100", plugins.FormatPerfData(result.PerfData))
+
+	cfg["crit"] = "20%"
+	result = runChecker(t, cfg, meminfoFile)
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+
+	// missing file
+	result = runChecker(t, cfg, "/not/found")
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+}
@@ -0,0 +1,194 @@
+package plugins
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var labelReplacer = strings.NewReplacer("'", "_", "=", "_", "|", "_", ",", "_", "\"", "_")
+
+// PerfData is a performance data value attached to a result, following Nagios plugins format
+type PerfData struct {
+	// Label is the name of the measured value
+	Label string
+	// Value is the measured value
+	Value float64
+	// Unit is the unit of measure of the value: s, us, ms, %, B, KB, MB, TB, c or empty
+	Unit string
+	// Warning is the warning threshold, using Nagios range format
+	Warning string
+	// Critical is the critical threshold, using Nagios range format
+	Critical string
+	// Min is the minimum value possible, if any
+	Min *float64
+	// Max is the maximum value possible, if any
+	Max *float64
+}
+
+// NewPerfData creates a performance data value without thresholds
+func NewPerfData(label string, value float64, unit string) PerfData {
+	return PerfData{
+		Label: label,
+		Value: value,
+		Unit:  unit,
+	}
+}
+
+// WithThresholds sets thresholds that are reached when value goes above them
+func (p PerfData) WithThresholds(warning, critical float64) PerfData {
+	p.Warning = FormatFloat(warning)
+	p.Critical = FormatFloat(critical)
+	return p
+}
+
+// WithLowerThresholds sets thresholds that are reached when value goes below them
+func (p PerfData) WithLowerThresholds(warning, critical float64) PerfData {
+	p.Warning = FormatFloat(warning) + ":"
+	p.Critical = FormatFloat(critical) + ":"
+	return p
+}
+
+// WithMin sets the minimum value possible
+func (p PerfData) WithMin(min float64) PerfData {
+	p.Min = &min
+	return p
+}
+
+// WithMax sets the maximum value possible
+func (p PerfData) WithMax(max float64) PerfData {
+	p.Max = &max
+	return p
+}
+
+// String renders performance data using Nagios format: 'label'=value[UOM];[warn];[crit];[min];[max]
+func (p PerfData) String() string {
+	label := labelReplacer.Replace(p.Label)
+	if strings.ContainsAny(label, " \t") {
+		label = "'" + label + "'"
+	}
+
+	fields := []string{FormatFloat(p.Value) + p.Unit, p.Warning, p.Critical, "", ""}
+	if p.Min != nil {
+		fields[3] = FormatFloat(*p.Min)
+	}
+	if p.Max != nil {
+		fields[4] = FormatFloat(*p.Max)
+	}
+
+	return label + "=" + strings.TrimRight(strings.Join(fields, ";"), ";")
+}
+
+// FormatPerfData renders a list of performance data using Nagios format
+func FormatPerfData(perfdata []PerfData) string {
+	values := make([]string, 0, len(perfdata))
+	for _, p := range perfdata {
+		values = append(values, p.String())
+	}
+	return strings.Join(values, " ")
+}
+
+// FormatFloat formats a value without exponent nor trailing zeros, as expected in performance data
+func FormatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// Round rounds a value to two decimals, the precision of values reported by checkers
+func Round(f float64) float64 {
+	return math.Round(f*100) / 100
+}
+
+// ParsePerfData parses performance data written using Nagios format, such as the output of Nagios plugins after |
+func ParsePerfData(str string) ([]PerfData, error) {
+	var perfdata []PerfData
+	for {
+		str = strings.TrimLeft(str, " \t\r\n")
+		if str == "" {
+			return perfdata, nil
+		}
+
+		var label string
+		if str[0] == '\'' {
+			// quoted label, quotes inside are doubled
+			end := 1
+			for {
+				next := strings.IndexByte(str[end:], '\'')
+				if next == -1 {
+					return perfdata, fmt.Errorf("unterminated quoted label in %q", str)
+				}
+				end += next
+				if end+1 < len(str) && str[end+1] == '\'' {
+					end += 2
+					continue
+				}
+				break
+			}
+			label = strings.Replace(str[1:end], "''", "'", -1)
+			str = str[end+1:]
+			if !strings.HasPrefix(str, "=") {
+				return perfdata, fmt.Errorf("missing value for label %q", label)
+			}
+		} else {
+			end := strings.IndexByte(str, '=')
+			if end == -1 {
+				return perfdata, fmt.Errorf("missing value in %q", str)
+			}
+			label = str[:end]
+			if strings.ContainsAny(label, " \t") {
+				return perfdata, fmt.Errorf("invalid label %q", label)
+			}
+			str = str[end:]
+		}
+
+		end := strings.IndexAny(str, " \t\r\n")
+		if end == -1 {
+			end = len(str)
+		}
+		fields := strings.Split(str[1:end], ";")
+		str = str[end:]
+
+		value := fields[0]
+		if value == "U" {
+			// value can't be determined
+			continue
+		}
+		unitStart := strings.LastIndexAny(value, "0123456789.") + 1
+		p, err := parsePerfDataValue(label, value[:unitStart], value[unitStart:], fields[1:])
+		if err != nil {
+			return perfdata, err
+		}
+		perfdata = append(perfdata, p)
+	}
+}
+
+func parsePerfDataValue(label, value, unit string, thresholds []string) (PerfData, error) {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return PerfData{}, fmt.Errorf("invalid value %q for label %q", value, label)
+	}
+
+	p := NewPerfData(label, f, unit)
+	for i, threshold := range thresholds {
+		switch i {
+		case 0:
+			p.Warning = threshold
+		case 1:
+			p.Critical = threshold
+		case 2, 3:
+			if threshold == "" {
+				continue
+			}
+			bound, err := strconv.ParseFloat(threshold, 64)
+			if err != nil {
+				return PerfData{}, fmt.Errorf("invalid bound %q for label %q", threshold, label)
+			}
+			if i == 2 {
+				p = p.WithMin(bound)
+			} else {
+				p = p.WithMax(bound)
+			}
+		}
+	}
+	return p, nil
+}
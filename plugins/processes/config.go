@@ -1,21 +1,109 @@
 package processes
 
 import (
+	"errors"
+	"fmt"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/rbeuque74/jagozzi/config"
 	validator "gopkg.in/go-playground/validator.v9"
+	defaults "gopkg.in/mcuadros/go-defaults.v1"
+)
+
+// defaultWarning and defaultCritical expect exactly one instance: a missing process is critical,
+// extra instances are a warning
+var (
+	defaultWarning  = config.Range{Min: float64Ptr(1), Max: float64Ptr(1)}
+	defaultCritical = config.Range{Min: float64Ptr(1)}
 )
 
 type rawProcessesConfig struct {
 	config.GenericPluginConfiguration
-	Command  string `json:"exec" validate:"required"`
-	Args     string `json:"args"`
-	Type     string `json:"type"`
-	Warning  int64  `json:"warn"`
-	Critical int64  `json:"crit"`
+	// Command is the path of the executable of the processes
+	Command string `json:"exec"`
+	// Args are the arguments of the processes, separated by spaces
+	Args string `json:"args"`
+	// ExecOnly matches processes on their executable only, whatever their arguments
+	ExecOnly bool `json:"exec_only"`
+	// CmdlineRegexp is a regular expression that the command line of the processes must match
+	CmdlineRegexp string `json:"cmdline_regexp"`
+	// User is the name or the ID of the user running the processes
+	User string `json:"user"`
+	// ParentPID is the PID of the parent of the processes
+	ParentPID int `json:"ppid" validate:"gte=0"`
+	// PIDFile is the path of a file containing the PID of the process
+	PIDFile string `json:"pidfile"`
+	Type    string `json:"type"`
+	// Warning and Critical are the ranges of instances expected, using Nagios format such as 1:4
+	Warning  *config.Range `json:"warn"`
+	Critical *config.Range `json:"crit"`
+	// Resources are the thresholds of resource usage of each process
+	Resources rawResources `json:"resources"`
+	// ProcRoot is the mount point of proc filesystem, such as /host/proc in a container
+	ProcRoot string `json:"proc_root" default:"/proc"`
+}
+
+// rawResources are the thresholds of resource usage; a zero threshold is disabled
+type rawResources struct {
+	// RSS is the resident memory size, such as 512M
+	RSS sizeThresholds `json:"rss"`
+	// CPU is the CPU usage percent since previous run, above 100 for processes using several CPUs
+	CPU floatThresholds `json:"cpu_percent"`
+	// FDs is the number of open file descriptors, as a percentage of the process limit
+	FDs floatThresholds `json:"fds_percent"`
+	// Threads is the number of threads
+	Threads floatThresholds `json:"threads"`
+	// Uptime is the minimum time since process start, to detect restarts
+	Uptime durationThresholds `json:"uptime"`
+}
+
+type sizeThresholds struct {
+	Warning  config.Size `json:"warn"`
+	Critical config.Size `json:"crit"`
+}
+
+type floatThresholds struct {
+	Warning  float64 `json:"warn" validate:"gte=0"`
+	Critical float64 `json:"crit" validate:"gte=0"`
+}
+
+type durationThresholds struct {
+	Warning  duration `json:"warn"`
+	Critical duration `json:"crit"`
+}
+
+// duration is a duration written as a number of seconds or as a string such as 5m
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	str := strings.Trim(string(b), `"`)
+	if seconds, err := strconv.ParseFloat(str, 64); err == nil {
+		*d = duration(seconds * float64(time.Second))
+		return nil
+	}
+
+	value, err := time.ParseDuration(str)
+	if err != nil {
+		return fmt.Errorf("invalid duration %s", b)
+	}
+	*d = duration(value)
+	return nil
+}
+
+// enabled returns true if at least one resource threshold is set
+func (r rawResources) enabled() bool {
+	return r != (rawResources{})
 }
 
 type processesConfig struct {
 	rawProcessesConfig
+	cmdlineRegexp *regexp.Regexp
+	uid           string
 }
 
 func (cfg *processesConfig) UnmarshalJSON(b []byte) error {
@@ -25,11 +113,56 @@ func (cfg *processesConfig) UnmarshalJSON(b []byte) error {
 		return err
 	}
 
+	defaults.SetDefaults(raw)
+
 	validate := validator.New()
 	if err := validate.Struct(raw); err != nil {
 		return err
 	}
 
+	if raw.Command == "" && raw.CmdlineRegexp == "" && raw.User == "" && raw.ParentPID == 0 && raw.PIDFile == "" {
+		return errors.New("one of exec, cmdline_regexp, user, ppid or pidfile keys is required")
+	}
+	if raw.Command == "" && (raw.Args != "" || raw.ExecOnly) {
+		return errors.New("args and exec_only keys require exec key")
+	}
+	if raw.Args != "" && raw.ExecOnly {
+		return errors.New("args and exec_only keys are incompatible")
+	}
+	if raw.Command != "" && !filepath.IsAbs(raw.Command) {
+		return fmt.Errorf("exec %q must be an absolute path", raw.Command)
+	}
+
+	if raw.Warning == nil {
+		raw.Warning = &defaultWarning
+	}
+	if raw.Critical == nil {
+		raw.Critical = &defaultCritical
+	}
+
 	cfg.rawProcessesConfig = *raw
+
+	if raw.CmdlineRegexp != "" {
+		var err error
+		if cfg.cmdlineRegexp, err = regexp.Compile(raw.CmdlineRegexp); err != nil {
+			return fmt.Errorf("cmdline_regexp: %s", err)
+		}
+	}
+
+	if raw.User != "" {
+		if _, err := strconv.ParseUint(raw.User, 10, 32); err == nil {
+			cfg.uid = raw.User
+		} else {
+			u, err := user.Lookup(raw.User)
+			if err != nil {
+				return err
+			}
+			cfg.uid = u.Uid
+		}
+	}
 	return nil
 }
+
+func float64Ptr(f float64) *float64 {
+	return &f
+}
@@ -0,0 +1,210 @@
+package processes
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clockTicks is the number of clock ticks per second used in proc filesystem (USER_HZ), 100 on all architectures
+const clockTicks = 100
+
+// deletedSuffix is appended by the kernel to the executable path when the file has been removed or replaced
+const deletedSuffix = " (deleted)"
+
+// process is a process read from a proc filesystem
+type process struct {
+	procRoot string
+	pid      int
+	ppid     int
+	// cpuTicks is the CPU time spent by the process in user and kernel modes, in clock ticks
+	cpuTicks uint64
+	// startTicks is the start time of the process after system boot, in clock ticks
+	startTicks uint64
+}
+
+// listProcesses returns the processes running, read from proc filesystem mounted on procRoot
+func listProcesses(procRoot string) ([]process, error) {
+	entries, err := ioutil.ReadDir(procRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	var processes []process
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+
+		proc, err := readProcess(procRoot, pid)
+		if err != nil {
+			// process exited since directory was listed
+			continue
+		}
+		processes = append(processes, proc)
+	}
+	return processes, nil
+}
+
+// readProcess reads the status of a process from /proc/<pid>/stat
+func readProcess(procRoot string, pid int) (process, error) {
+	proc := process{procRoot: procRoot, pid: pid}
+
+	b, err := ioutil.ReadFile(proc.path("stat"))
+	if err != nil {
+		return proc, err
+	}
+
+	// executable name is between parenthesis, and can contain spaces or parenthesis
+	start, end := bytes.IndexByte(b, '('), bytes.LastIndexByte(b, ')')
+	if start == -1 || end < start {
+		return proc, fmt.Errorf("invalid stat file for pid %d", pid)
+	}
+
+	// fields following executable name, starting at state: see proc(5)
+	fields := strings.Fields(string(b[end+1:]))
+	if len(fields) < 20 {
+		return proc, fmt.Errorf("invalid stat file for pid %d", pid)
+	}
+	if proc.ppid, err = strconv.Atoi(fields[1]); err != nil {
+		return proc, fmt.Errorf("invalid parent pid for pid %d: %s", pid, err)
+	}
+
+	var utime, stime uint64
+	for _, field := range []struct {
+		index int
+		value *uint64
+	}{{11, &utime}, {12, &stime}, {19, &proc.startTicks}} {
+		if *field.value, err = strconv.ParseUint(fields[field.index], 10, 64); err != nil {
+			return proc, fmt.Errorf("invalid stat file for pid %d: %s", pid, err)
+		}
+	}
+	proc.cpuTicks = utime + stime
+	return proc, nil
+}
+
+// bootTime returns the time of system boot, read from proc filesystem
+func bootTime(procRoot string) (time.Time, error) {
+	b, err := ioutil.ReadFile(filepath.Join(procRoot, "stat"))
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	for _, line := range strings.Split(string(b), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "btime" {
+			seconds, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("invalid btime: %s", err)
+			}
+			return time.Unix(seconds, 0), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("no btime found in %s", filepath.Join(procRoot, "stat"))
+}
+
+func (p process) path(name string) string {
+	return filepath.Join(p.procRoot, strconv.Itoa(p.pid), name)
+}
+
+// executable returns the path of the process executable
+func (p process) executable() (string, error) {
+	path, err := os.Readlink(p.path("exe"))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(path, deletedSuffix), nil
+}
+
+// cmdline returns the command line of the process: executable name as launched, and arguments
+func (p process) cmdline() ([]string, error) {
+	b, err := ioutil.ReadFile(p.path("cmdline"))
+	if err != nil {
+		return nil, err
+	}
+
+	// Removing last NUL characters
+	b = bytes.TrimSuffix(b, backslashZero)
+	if len(b) == 0 {
+		return nil, nil
+	}
+
+	var args []string
+	for _, arg := range bytes.Split(b, backslashZero) {
+		args = append(args, string(arg))
+	}
+	return args, nil
+}
+
+// status returns the values of /proc/<pid>/status, indexed by key
+func (p process) status() (map[string][]string, error) {
+	f, err := os.Open(p.path("status"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	status := make(map[string][]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 {
+			status[strings.TrimSuffix(fields[0], ":")] = fields[1:]
+		}
+	}
+	return status, scanner.Err()
+}
+
+// uid returns the effective user ID of the process
+func (p process) uid() (string, error) {
+	status, err := p.status()
+	if err != nil {
+		return "", err
+	}
+
+	// Uid: real effective saved filesystem
+	if uids := status["Uid"]; len(uids) >= 2 {
+		return uids[1], nil
+	}
+	return "", fmt.Errorf("no Uid found in status of pid %d", p.pid)
+}
+
+// openFiles returns the number of file descriptors opened by the process
+func (p process) openFiles() (int, error) {
+	f, err := os.Open(p.path("fd"))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	names, err := f.Readdirnames(-1)
+	return len(names), err
+}
+
+// openFilesLimit returns the soft limit of file descriptors of the process, 0 if unlimited
+func (p process) openFilesLimit() (int, error) {
+	b, err := ioutil.ReadFile(p.path("limits"))
+	if err != nil {
+		return 0, err
+	}
+
+	for _, line := range strings.Split(string(b), "\n") {
+		if !strings.HasPrefix(line, "Max open files") {
+			continue
+		}
+		// Limit Soft-Limit Hard-Limit Units
+		fields := strings.Fields(strings.TrimPrefix(line, "Max open files"))
+		if len(fields) == 0 || fields[0] == "unlimited" {
+			return 0, nil
+		}
+		return strconv.Atoi(fields[0])
+	}
+	return 0, fmt.Errorf("no open files limit found for pid %d", p.pid)
+}
@@ -1,16 +1,17 @@
 package processes
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"io/ioutil"
-	"path"
+	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/ghodss/yaml"
-	processlib "github.com/mitchellh/go-ps"
 	"github.com/rbeuque74/jagozzi/plugins"
 	log "github.com/sirupsen/logrus"
 )
@@ -23,99 +24,203 @@ func init() {
 	plugins.Register(pluginName, NewProcessesChecker)
 }
 
-// ProcessesChecker is a plugin to check status code of command
+// ProcessesChecker is a plugin to check the number of instances of a process
 type ProcessesChecker struct {
-	cfg            processesConfig
-	executableName string
+	cfg processesConfig
+	// executablePaths are the paths of the configured executable, before and after resolving symbolic links
+	executablePaths map[string]struct{}
+	// cpuSamples are the CPU times read during previous run, used to compute CPU usage across the check interval
+	cpuSamples      map[cpuSampleKey]cpuSample
+	cpuSamplesMutex sync.Mutex
 }
 
 // Name returns the name of the checker
-func (c ProcessesChecker) Name() string {
+func (c *ProcessesChecker) Name() string {
 	return pluginName
 }
 
 // ServiceName returns the name of the NSCA service associated to the checker
-func (c ProcessesChecker) ServiceName() string {
+func (c *ProcessesChecker) ServiceName() string {
 	return c.cfg.Name
 }
 
 // Periodicity returns the delay between two checks
-func (c ProcessesChecker) Periodicity() *time.Duration {
+func (c *ProcessesChecker) Periodicity() *time.Duration {
 	return c.cfg.Periodicity()
 }
 
 // Run is performing the checker protocol
 func (c *ProcessesChecker) Run(ctx context.Context) plugins.Result {
-	processes, err := processlib.Processes()
+	candidatesProcesses, err := c.candidates()
 	if err != nil {
 		return plugins.ResultFromError(c, err, "unable to retrieve processes")
 	}
 
-	var candidatesProcesses []processlib.Process
-	for _, proc := range processes {
-		if proc.Executable() != c.executableName {
-			continue
+	var selectedProcesses []process
+	for _, proc := range candidatesProcesses {
+		if c.matches(proc) {
+			selectedProcesses = append(selectedProcesses, proc)
 		}
-		candidatesProcesses = append(candidatesProcesses, proc)
 	}
 
-	var selectedProcesses []processlib.Process
-	for _, proc := range candidatesProcesses {
-		path, err := filepath.EvalSymlinks(fmt.Sprintf("/proc/%d/exe", proc.Pid()))
+	count := len(selectedProcesses)
+	perfdata := plugins.NewPerfData("procs", float64(count), "").WithMin(0)
+	perfdata.Warning = c.cfg.Warning.String()
+	perfdata.Critical = c.cfg.Critical.String()
+
+	result := plugins.Result{
+		Status:   plugins.STATE_OK,
+		Checker:  c,
+		PerfData: []plugins.PerfData{perfdata},
+	}
+
+	if !c.cfg.Critical.Contains(float64(count)) {
+		result.Status = plugins.STATE_CRITICAL
+	} else if !c.cfg.Warning.Contains(float64(count)) {
+		result.Status = plugins.STATE_WARNING
+	}
+
+	var resources resourcesResult
+	if c.cfg.Resources.enabled() && count > 0 {
+		resources = c.checkResources(selectedProcesses)
+		result.PerfData = append(result.PerfData, resources.perfData...)
+	}
+
+	switch {
+	case result.Status == plugins.STATE_OK && count == 1:
+		result.Message = fmt.Sprintf("Process %s is running", c.description())
+	case result.Status == plugins.STATE_OK:
+		result.Message = fmt.Sprintf("Process %s has %d instances running", c.description(), count)
+	case count == 0:
+		result.Message = fmt.Sprintf("Process %s is not running", c.description())
+	case c.tooMany(count):
+		result.Message = fmt.Sprintf("Process %s have too many instances running", c.description())
+	default:
+		result.Message = fmt.Sprintf("Process %s have too few instances running", c.description())
+	}
+
+	if len(resources.failures) > 0 {
+		if resources.status.Severity() > result.Status.Severity() {
+			result.Status = resources.status
+		}
+		result.Message = fmt.Sprintf("%s: %s", result.Message, strings.Join(resources.failures, "; "))
+	}
+	return result
+}
+
+// tooMany returns true if the count of instances goes above a threshold it doesn't respect
+func (c *ProcessesChecker) tooMany(count int) bool {
+	threshold := c.cfg.Critical
+	if threshold.Contains(float64(count)) {
+		threshold = c.cfg.Warning
+	}
+	return threshold.Max != nil && float64(count) > *threshold.Max
+}
+
+// candidates returns the processes that may match: the one of the pidfile if configured, all processes otherwise
+func (c *ProcessesChecker) candidates() ([]process, error) {
+	if c.cfg.PIDFile == "" {
+		return listProcesses(c.cfg.ProcRoot)
+	}
+
+	b, err := ioutil.ReadFile(c.cfg.PIDFile)
+	if os.IsNotExist(err) {
+		log.Debugf("processes: pidfile %q doesn't exist", c.cfg.PIDFile)
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid pidfile %q: %s", c.cfg.PIDFile, err)
+	}
+
+	proc, err := readProcess(c.cfg.ProcRoot, pid)
+	if err != nil {
+		log.Debugf("processes: pid [%d] of pidfile %q is not running: %s", pid, c.cfg.PIDFile, err)
+		return nil, nil
+	}
+	return []process{proc}, nil
+}
+
+// matches returns true if the process respects all the configured criteria
+func (c *ProcessesChecker) matches(proc process) bool {
+	if c.cfg.ParentPID != 0 && proc.ppid != c.cfg.ParentPID {
+		return false
+	}
+
+	if c.cfg.Command != "" {
+		path, err := proc.executable()
 		if err != nil {
-			return plugins.ResultFromError(c, err, "can't open executable symlink from pid")
+			log.Debugf("processes: pid [%d] can't open executable symlink: %s", proc.pid, err)
+			return false
+		}
+		if _, ok := c.executablePaths[path]; !ok {
+			log.Debugf("processes: pid [%d] %q doesn't match command line", proc.pid, path)
+			return false
 		}
+	}
 
-		if path != c.cfg.Command {
-			log.Debugf("processes: pid [%d] %q doesn't match command line", proc.Pid(), path)
-			continue
+	if c.cfg.uid != "" {
+		uid, err := proc.uid()
+		if err != nil {
+			log.Debugf("processes: pid [%d] can't read user: %s", proc.pid, err)
+			return false
+		}
+		if uid != c.cfg.uid {
+			return false
 		}
+	}
 
-		b, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/cmdline", proc.Pid()))
+	if (c.cfg.Command != "" && !c.cfg.ExecOnly) || c.cfg.cmdlineRegexp != nil {
+		args, err := proc.cmdline()
 		if err != nil {
-			return plugins.ResultFromError(c, err, "can't open cmdline")
+			log.Debugf("processes: pid [%d] can't open cmdline: %s", proc.pid, err)
+			return false
+		}
+
+		if c.cfg.cmdlineRegexp != nil && !c.cfg.cmdlineRegexp.MatchString(strings.Join(args, " ")) {
+			log.Debugf("processes: pid [%d] %q doesn't match cmdline regexp", proc.pid, args)
+			return false
 		}
 
-		// Removing last NUL characters
-		b = bytes.TrimSuffix(b, backslashZero)
-		// Splitting all parts
-		args := bytes.Split(b, backslashZero)
 		// Removing first segment as it's the name of launched executable
 		if len(args) != 0 {
 			args = args[1:]
 		}
-		// Putting back in one piece
-		b = bytes.Join(args, []byte(" "))
+		cmdargs := strings.Join(args, " ")
 
-		cmdargs := string(b[:])
-
-		if cmdargs != c.cfg.Args {
-			log.Debugf("processes: pid [%d] %q %q doesn't match cmdargs", proc.Pid(), path, cmdargs)
-			continue
+		if c.cfg.Command != "" && !c.cfg.ExecOnly && cmdargs != c.cfg.Args {
+			log.Debugf("processes: pid [%d] %q doesn't match cmdargs", proc.pid, cmdargs)
+			return false
 		}
-
-		selectedProcesses = append(selectedProcesses, proc)
 	}
 
-	if len(selectedProcesses) == 0 {
-		return plugins.Result{
-			Status:  plugins.STATE_CRITICAL,
-			Message: fmt.Sprintf("Process %s %s is not running", c.cfg.Command, c.cfg.Args),
-			Checker: c,
-		}
-	} else if len(selectedProcesses) > 1 {
-		return plugins.Result{
-			Status:  plugins.STATE_WARNING,
-			Message: fmt.Sprintf("Process %s %s have too many instances running", c.cfg.Command, c.cfg.Args),
-			Checker: c,
-		}
-	} else {
-		return plugins.Result{
-			Status:  plugins.STATE_OK,
-			Message: fmt.Sprintf("Process %s %s is running", c.cfg.Command, c.cfg.Args),
-			Checker: c,
-		}
+	return true
+}
+
+// description returns the criteria of the processes, used in result messages
+func (c *ProcessesChecker) description() string {
+	var parts []string
+	if c.cfg.Command != "" && c.cfg.ExecOnly {
+		parts = append(parts, c.cfg.Command)
+	} else if c.cfg.Command != "" {
+		parts = append(parts, fmt.Sprintf("%s %s", c.cfg.Command, c.cfg.Args))
 	}
+	if c.cfg.CmdlineRegexp != "" {
+		parts = append(parts, fmt.Sprintf("matching %q", c.cfg.CmdlineRegexp))
+	}
+	if c.cfg.User != "" {
+		parts = append(parts, fmt.Sprintf("of user %s", c.cfg.User))
+	}
+	if c.cfg.ParentPID != 0 {
+		parts = append(parts, fmt.Sprintf("with parent pid %d", c.cfg.ParentPID))
+	}
+	if c.cfg.PIDFile != "" {
+		parts = append(parts, fmt.Sprintf("from pidfile %s", c.cfg.PIDFile))
+	}
+	return strings.Join(parts, " ")
 }
 
 // NewProcessesChecker create a Processes checker
@@ -132,11 +237,18 @@ func NewProcessesChecker(conf interface{}, pluginConf interface{}) (plugins.Chec
 	}
 
 	checker := &ProcessesChecker{
-		cfg: cfg,
+		cfg:             cfg,
+		executablePaths: make(map[string]struct{}),
 	}
 
-	checker.executableName = path.Base(checker.cfg.Command)
+	if cfg.Command != "" {
+		checker.executablePaths[cfg.Command] = struct{}{}
+		// executable may be reached through a symbolic link, such as /bin on merged /usr systems
+		if resolved, err := filepath.EvalSymlinks(cfg.Command); err == nil {
+			checker.executablePaths[resolved] = struct{}{}
+		}
+	}
 
-	log.Infof("processes: Checker activated for watching %q", checker.cfg.Command)
+	log.Infof("processes: Checker activated for watching %q", checker.description())
 	return checker, nil
 }
@@ -2,8 +2,13 @@ package processes
 
 import (
 	"context"
+	"fmt"
+	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -147,3 +152,256 @@ func TestProcesses(t *testing.T) {
 	assert.Equal(t, plugins.STATE_WARNING, result.Status)
 	assert.Equal(t, "Process /bin/sleep 13 have too many instances running", result.Message)
 }
+
+// writeProc creates the files of a process in a fake proc filesystem
+func writeProc(t *testing.T, procRoot string, pid, ppid int, exe string, cmdline []string, uid int) {
+	dir := filepath.Join(procRoot, strconv.Itoa(pid))
+	if err := os.MkdirAll(filepath.Join(dir, "fd"), 0700); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	writeStat(t, procRoot, pid, ppid, filepath.Base(exe), 20)
+	writeProcFile(t, filepath.Join(dir, "cmdline"), strings.Join(cmdline, "\x00")+"\x00")
+	writeProcFile(t, filepath.Join(dir, "status"), fmt.Sprintf("Name:\t%s\nUid:\t%d\t%d\t%d\t%d\nThreads:\t4\nVmRSS:\t  10240 kB\n", filepath.Base(exe), uid, uid, uid, uid))
+	writeProcFile(t, filepath.Join(dir, "limits"), "Limit                     Soft Limit           Hard Limit           Units\nMax open files            10                   4096                 files\n")
+	for fd := 0; fd < 3; fd++ {
+		if err := os.Symlink("/dev/null", filepath.Join(dir, "fd", strconv.Itoa(fd))); err != nil {
+			t.Error(err)
+			t.FailNow()
+		}
+	}
+	if err := os.Symlink(exe, filepath.Join(dir, "exe")); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+}
+
+// writeStat writes the stat file of a process started 10 seconds after boot, that spent 10 ticks in kernel mode
+func writeStat(t *testing.T, procRoot string, pid, ppid int, comm string, utime int) {
+	stat := fmt.Sprintf("%d (%s) S %d %d 0 0 -1 4194304 100 0 0 0 %d 10 0 0 20 0 1 0 1000 1000000 200 0 0", pid, comm, ppid, pid, utime)
+	writeProcFile(t, filepath.Join(procRoot, strconv.Itoa(pid), "stat"), stat)
+}
+
+func writeProcFile(t *testing.T, path string, content string) {
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+}
+
+func newFixtureChecker(t *testing.T, cfg map[string]interface{}, procRoot string) *ProcessesChecker {
+	cfg["proc_root"] = procRoot
+	checker, err := NewProcessesChecker(cfg, nil)
+	assert.Nilf(t, err, "processes checker instantiation failed: %q", err)
+	if err != nil {
+		t.FailNow()
+	}
+	return checker.(*ProcessesChecker)
+}
+
+func TestProcessesThresholds(t *testing.T) {
+	procRoot, err := ioutil.TempDir("", "jagozzi-proc")
+	assert.Nil(t, err)
+	defer os.RemoveAll(procRoot)
+
+	writeProc(t, procRoot, 1, 0, "/sbin/init", []string{"/sbin/init"}, 0)
+	writeProc(t, procRoot, 100, 1, "/usr/sbin/nginx", []string{"nginx: master process /usr/sbin/nginx"}, 0)
+	for pid := 101; pid <= 104; pid++ {
+		writeProc(t, procRoot, pid, 100, "/usr/sbin/nginx", []string{"nginx: worker process"}, 33)
+	}
+	writeProc(t, procRoot, 200, 1, "/usr/bin/worker (deleted)", []string{"/usr/bin/worker", "--queue", "mails"}, 1000)
+	writeProc(t, procRoot, 201, 1, "/usr/bin/worker", []string{"/usr/bin/worker", "--queue", "sms"}, 1000)
+
+	ctxRun, cancelFunc1 := context.WithTimeout(context.Background(), time.Second)
+	defer cancelFunc1()
+
+	// executable only, with instances range
+	cfg := map[string]interface{}{
+		"exec":      "/usr/sbin/nginx",
+		"exec_only": true,
+		"warn":      "5:",
+		"crit":      "2:10",
+		"name":      "test-1",
+	}
+	checker := newFixtureChecker(t, cfg, procRoot)
+	result := checker.Run(ctxRun)
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+	assert.Equal(t, "Process /usr/sbin/nginx has 5 instances running", result.Message)
+	assert.Equal(t, "procs=5;5:;2:10;0", plugins.FormatPerfData(result.PerfData))
+
+	cfg["warn"] = "~:3"
+	checker = newFixtureChecker(t, cfg, procRoot)
+	result = checker.Run(ctxRun)
+	assert.Equal(t, plugins.STATE_WARNING, result.Status)
+	assert.Equal(t, "Process /usr/sbin/nginx have too many instances running", result.Message)
+
+	cfg["crit"] = 4
+	checker = newFixtureChecker(t, cfg, procRoot)
+	result = checker.Run(ctxRun)
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+
+	// by user and parent pid
+	cfg = map[string]interface{}{
+		"exec":      "/usr/sbin/nginx",
+		"exec_only": true,
+		"user":      "33",
+		"ppid":      100,
+		"warn":      "4:4",
+		"crit":      "1:",
+		"name":      "test-1",
+	}
+	checker = newFixtureChecker(t, cfg, procRoot)
+	result = checker.Run(ctxRun)
+	assert.Equalf(t, plugins.STATE_OK, result.Status, "processes bad message: %q", result.Message)
+
+	cfg["warn"] = "6:"
+	checker = newFixtureChecker(t, cfg, procRoot)
+	result = checker.Run(ctxRun)
+	assert.Equal(t, plugins.STATE_WARNING, result.Status)
+	assert.Equal(t, "Process /usr/sbin/nginx of user 33 with parent pid 100 have too few instances running", result.Message)
+
+	// cmdline regexp, executable replaced on disk still matches
+	cfg = map[string]interface{}{
+		"exec":           "/usr/bin/worker",
+		"exec_only":      true,
+		"cmdline_regexp": "--queue (mails|sms)",
+		"warn":           "2",
+		"name":           "test-1",
+	}
+	checker = newFixtureChecker(t, cfg, procRoot)
+	result = checker.Run(ctxRun)
+	assert.Equalf(t, plugins.STATE_OK, result.Status, "processes bad message: %q", result.Message)
+	assert.Equal(t, "Process /usr/bin/worker matching \"--queue (mails|sms)\" has 2 instances running", result.Message)
+
+	cfg = map[string]interface{}{
+		"cmdline_regexp": "^nginx: master",
+		"name":           "test-1",
+	}
+	checker = newFixtureChecker(t, cfg, procRoot)
+	result = checker.Run(ctxRun)
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+	assert.Equal(t, "Process matching \"^nginx: master\" is running", result.Message)
+
+	// pidfile
+	pidfile := filepath.Join(procRoot, "nginx.pid")
+	assert.Nil(t, ioutil.WriteFile(pidfile, []byte("100\n"), 0600))
+	cfg = map[string]interface{}{
+		"exec":      "/usr/sbin/nginx",
+		"exec_only": true,
+		"pidfile":   pidfile,
+		"name":      "test-1",
+	}
+	checker = newFixtureChecker(t, cfg, procRoot)
+	result = checker.Run(ctxRun)
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+	assert.Equal(t, "Process /usr/sbin/nginx from pidfile "+pidfile+" is running", result.Message)
+
+	assert.Nil(t, ioutil.WriteFile(pidfile, []byte("300\n"), 0600))
+	result = checker.Run(ctxRun)
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+	assert.Equal(t, "Process /usr/sbin/nginx from pidfile "+pidfile+" is not running", result.Message)
+
+	assert.Nil(t, os.Remove(pidfile))
+	result = checker.Run(ctxRun)
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+
+	// invalid configurations
+	for _, invalid := range []map[string]interface{}{
+		{"name": "test-1"},
+		{"exec": "nginx", "name": "test-1"},
+		{"args": "-g daemon", "name": "test-1"},
+		{"exec": "/usr/sbin/nginx", "exec_only": true, "args": "-g", "name": "test-1"},
+		{"cmdline_regexp": "(", "name": "test-1"},
+		{"exec": "/usr/sbin/nginx", "warn": "5:2", "name": "test-1"},
+		{"exec": "/usr/sbin/nginx", "crit": "abc", "name": "test-1"},
+	} {
+		_, err := NewProcessesChecker(invalid, nil)
+		assert.NotNilf(t, err, "configuration should be invalid: %v", invalid)
+	}
+}
+
+func TestProcessesResources(t *testing.T) {
+	procRoot, err := ioutil.TempDir("", "jagozzi-proc")
+	assert.Nil(t, err)
+	defer os.RemoveAll(procRoot)
+
+	// system booted 100 seconds ago, processes started 90 seconds ago
+	writeProcFile(t, filepath.Join(procRoot, "stat"), fmt.Sprintf("cpu  1 2 3 4\nbtime %d\nprocesses 42\n", time.Now().Add(-100*time.Second).Unix()))
+	writeProc(t, procRoot, 100, 1, "/usr/bin/worker", []string{"/usr/bin/worker"}, 1000)
+	writeProc(t, procRoot, 101, 1, "/usr/bin/worker", []string{"/usr/bin/worker"}, 1000)
+	writeProcFile(t, filepath.Join(procRoot, "101", "status"), "Name:\tworker\nUid:\t1000\t1000\t1000\t1000\nThreads:\t40\nVmRSS:\t  2097152 kB\n")
+
+	ctxRun, cancelFunc1 := context.WithTimeout(context.Background(), time.Second)
+	defer cancelFunc1()
+
+	cfg := map[string]interface{}{
+		"exec":      "/usr/bin/worker",
+		"exec_only": true,
+		"warn":      "1:2",
+		"crit":      "1:",
+		"resources": map[string]interface{}{
+			"rss":         map[string]interface{}{"warn": "1G", "crit": "4G"},
+			"threads":     map[string]interface{}{"warn": 50, "crit": 100},
+			"fds_percent": map[string]interface{}{"warn": 50, "crit": 90},
+			"uptime":      map[string]interface{}{"warn": "1m"},
+		},
+		"name": "test-1",
+	}
+	checker := newFixtureChecker(t, cfg, procRoot)
+	result := checker.Run(ctxRun)
+	assert.Equal(t, plugins.STATE_WARNING, result.Status)
+	assert.Equal(t, "Process /usr/bin/worker has 2 instances running: pid 101 rss 2.0G above 1.0G", result.Message)
+	// boot time is rounded to the second
+	assert.Regexp(t, `^procs=2;1:2;1:;0 rss=2147483648B;1073741824;4294967296;0 threads=40;50;100;0 uptime=(90|91)s;60:;0:;0 fds=30%;50;90;0$`, plugins.FormatPerfData(result.PerfData))
+
+	// every failure is listed, worst status is kept
+	cfg["resources"] = map[string]interface{}{
+		"threads":     map[string]interface{}{"warn": 20, "crit": 30},
+		"fds_percent": map[string]interface{}{"warn": 20},
+		"uptime":      map[string]interface{}{"warn": "5m", "crit": "2m"},
+	}
+	checker = newFixtureChecker(t, cfg, procRoot)
+	result = checker.Run(ctxRun)
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+	assert.Regexp(t, `pid 100 uptime 1m3(0|1)s below 2m0s`, result.Message)
+	assert.Contains(t, result.Message, "pid 100 fds 30% above 20%")
+	assert.Contains(t, result.Message, "pid 101 threads 40 above 30")
+	assert.NotContains(t, result.Message, "pid 100 threads")
+
+	// CPU usage since process start on first run, then since previous run
+	cfg["resources"] = map[string]interface{}{
+		"cpu_percent": map[string]interface{}{"warn": 40, "crit": 80},
+	}
+	checker = newFixtureChecker(t, cfg, procRoot)
+	result = checker.Run(ctxRun)
+	assert.Equalf(t, plugins.STATE_OK, result.Status, "processes bad message: %q", result.Message)
+	assert.Equal(t, "procs=2;1:2;1:;0 cpu=0.33%;40;80;0", plugins.FormatPerfData(result.PerfData))
+
+	// pretending previous run happened 10 seconds ago, pid 100 spent 5 seconds in user mode since
+	for key, sample := range checker.cpuSamples {
+		sample.time = sample.time.Add(-10 * time.Second)
+		checker.cpuSamples[key] = sample
+	}
+	writeStat(t, procRoot, 100, 1, "worker", 520)
+	result = checker.Run(ctxRun)
+	assert.Equal(t, plugins.STATE_WARNING, result.Status)
+	assert.Regexp(t, `pid 100 cpu (49\.9\d*|50)% above 40%`, result.Message)
+	assert.NotContains(t, result.Message, "pid 101")
+
+	// unreadable resources
+	assert.Nil(t, os.RemoveAll(filepath.Join(procRoot, "101", "fd")))
+	cfg["resources"] = map[string]interface{}{
+		"fds_percent": map[string]interface{}{"warn": 50},
+	}
+	checker = newFixtureChecker(t, cfg, procRoot)
+	result = checker.Run(ctxRun)
+	assert.Equal(t, plugins.STATE_UNKNOWN, result.Status)
+	assert.Contains(t, result.Message, "pid 101 can't read open files")
+
+	cfg["resources"] = map[string]interface{}{
+		"rss": map[string]interface{}{"warn": "abc"},
+	}
+	_, err = NewProcessesChecker(cfg, nil)
+	assert.NotNil(t, err)
+}
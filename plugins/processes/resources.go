@@ -0,0 +1,261 @@
+package processes
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/rbeuque74/jagozzi/config"
+	"github.com/rbeuque74/jagozzi/plugins"
+)
+
+// cpuSampleKey identifies a process across runs; start time protects against PID reuse
+type cpuSampleKey struct {
+	pid        int
+	startTicks uint64
+}
+
+// cpuSample is the CPU time of a process read during a run
+type cpuSample struct {
+	cpuTicks uint64
+	time     time.Time
+}
+
+// measure is a resource usage of a process, compared to thresholds
+type measure struct {
+	// label is the name of the resource, used in messages and performance data
+	label string
+	unit  string
+	value float64
+	// warning and critical are the thresholds, disabled when zero
+	warning  float64
+	critical float64
+	// lower is true when thresholds are reached when value goes below them
+	lower bool
+	// format renders the value and thresholds in messages
+	format func(float64) string
+}
+
+// status returns the status of the measure according to its thresholds
+func (m measure) status() plugins.StatusEnum {
+	reached := func(threshold float64) bool {
+		if threshold == 0 {
+			return false
+		}
+		if m.lower {
+			return m.value < threshold
+		}
+		return m.value > threshold
+	}
+
+	if reached(m.critical) {
+		return plugins.STATE_CRITICAL
+	} else if reached(m.warning) {
+		return plugins.STATE_WARNING
+	}
+	return plugins.STATE_OK
+}
+
+// message explains which threshold has been reached
+func (m measure) message(pid int, status plugins.StatusEnum) string {
+	threshold, direction := m.warning, "above"
+	if status == plugins.STATE_CRITICAL {
+		threshold = m.critical
+	}
+	if m.lower {
+		direction = "below"
+	}
+	return fmt.Sprintf("pid %d %s %s %s %s", pid, m.label, m.format(m.value), direction, m.format(threshold))
+}
+
+// perfData returns the performance data of the measure
+func (m measure) perfData() plugins.PerfData {
+	p := plugins.NewPerfData(m.label, m.value, m.unit).WithMin(0)
+	if m.lower {
+		return p.WithLowerThresholds(m.warning, m.critical)
+	}
+	return p.WithThresholds(m.warning, m.critical)
+}
+
+// resourcesResult is the outcome of resource thresholds evaluation on all selected processes
+type resourcesResult struct {
+	status   plugins.StatusEnum
+	failures []string
+	perfData []plugins.PerfData
+}
+
+// add takes into account the status of a process resource
+func (r *resourcesResult) add(status plugins.StatusEnum, message string) {
+	if status.Severity() > r.status.Severity() {
+		r.status = status
+	}
+	if status != plugins.STATE_OK {
+		r.failures = append(r.failures, message)
+	}
+}
+
+// checkResources evaluates the resource thresholds on each process; performance data reports the worst value
+func (c *ProcessesChecker) checkResources(processes []process) resourcesResult {
+	result := resourcesResult{status: plugins.STATE_OK}
+	now := time.Now()
+
+	boot, err := bootTime(c.cfg.ProcRoot)
+	if err != nil {
+		result.add(plugins.STATE_UNKNOWN, fmt.Sprintf("can't read boot time: %s", err))
+		return result
+	}
+
+	samples := make(map[cpuSampleKey]cpuSample, len(processes))
+	worst := make(map[string]measure)
+	var labels []string
+
+	for _, proc := range processes {
+		sample := cpuSample{cpuTicks: proc.cpuTicks, time: now}
+		samples[cpuSampleKey{pid: proc.pid, startTicks: proc.startTicks}] = sample
+
+		measures, err := c.measures(proc, boot, sample)
+		if err != nil {
+			result.add(plugins.STATE_UNKNOWN, fmt.Sprintf("pid %d %s", proc.pid, err))
+		}
+
+		for _, m := range measures {
+			status := m.status()
+			result.add(status, m.message(proc.pid, status))
+
+			previous, ok := worst[m.label]
+			if !ok {
+				labels = append(labels, m.label)
+			}
+			if !ok || (m.lower && m.value < previous.value) || (!m.lower && m.value > previous.value) {
+				worst[m.label] = m
+			}
+		}
+	}
+
+	c.cpuSamplesMutex.Lock()
+	c.cpuSamples = samples
+	c.cpuSamplesMutex.Unlock()
+
+	for _, label := range labels {
+		result.perfData = append(result.perfData, worst[label].perfData())
+	}
+	return result
+}
+
+// measures reads the resource usage of a process for which thresholds are configured
+func (c *ProcessesChecker) measures(proc process, boot time.Time, sample cpuSample) ([]measure, error) {
+	resources := c.cfg.Resources
+	var measures []measure
+
+	if resources.RSS != (sizeThresholds{}) || resources.Threads != (floatThresholds{}) {
+		status, err := proc.status()
+		if err != nil {
+			return measures, fmt.Errorf("can't read status: %s", err)
+		}
+
+		if resources.RSS != (sizeThresholds{}) {
+			// VmRSS: size kB; absent for kernel threads
+			var rss uint64
+			if values := status["VmRSS"]; len(values) >= 1 {
+				if rss, err = strconv.ParseUint(values[0], 10, 64); err != nil {
+					return measures, fmt.Errorf("invalid VmRSS: %s", err)
+				}
+			}
+			measures = append(measures, measure{
+				label:    "rss",
+				unit:     "B",
+				value:    float64(rss * 1024),
+				warning:  float64(resources.RSS.Warning),
+				critical: float64(resources.RSS.Critical),
+				format:   func(f float64) string { return config.Size(f).String() },
+			})
+		}
+
+		if resources.Threads != (floatThresholds{}) {
+			var threads int
+			if values := status["Threads"]; len(values) >= 1 {
+				if threads, err = strconv.Atoi(values[0]); err != nil {
+					return measures, fmt.Errorf("invalid Threads: %s", err)
+				}
+			}
+			measures = append(measures, measure{
+				label:    "threads",
+				value:    float64(threads),
+				warning:  resources.Threads.Warning,
+				critical: resources.Threads.Critical,
+				format:   plugins.FormatFloat,
+			})
+		}
+	}
+
+	if resources.CPU != (floatThresholds{}) {
+		measures = append(measures, measure{
+			label:    "cpu",
+			unit:     "%",
+			value:    c.cpuUsage(proc, boot, sample),
+			warning:  resources.CPU.Warning,
+			critical: resources.CPU.Critical,
+			format:   func(f float64) string { return plugins.FormatFloat(f) + "%" },
+		})
+	}
+
+	if resources.Uptime != (durationThresholds{}) {
+		uptime := sample.time.Sub(proc.startTime(boot))
+		measures = append(measures, measure{
+			label:    "uptime",
+			unit:     "s",
+			value:    math.Floor(uptime.Seconds()),
+			warning:  time.Duration(resources.Uptime.Warning).Seconds(),
+			critical: time.Duration(resources.Uptime.Critical).Seconds(),
+			lower:    true,
+			format:   func(f float64) string { return (time.Duration(f) * time.Second).String() },
+		})
+	}
+
+	if resources.FDs != (floatThresholds{}) {
+		open, err := proc.openFiles()
+		if err != nil {
+			return measures, fmt.Errorf("can't read open files: %s", err)
+		}
+		limit, err := proc.openFilesLimit()
+		if err != nil {
+			return measures, fmt.Errorf("can't read open files limit: %s", err)
+		}
+		if limit > 0 {
+			measures = append(measures, measure{
+				label:    "fds",
+				unit:     "%",
+				value:    plugins.Round(float64(open) / float64(limit) * 100),
+				warning:  resources.FDs.Warning,
+				critical: resources.FDs.Critical,
+				format:   func(f float64) string { return plugins.FormatFloat(f) + "%" },
+			})
+		}
+	}
+
+	return measures, nil
+}
+
+// cpuUsage returns the CPU usage percent of the process since previous run, or since its start on first run
+func (c *ProcessesChecker) cpuUsage(proc process, boot time.Time, sample cpuSample) float64 {
+	c.cpuSamplesMutex.Lock()
+	previous, ok := c.cpuSamples[cpuSampleKey{pid: proc.pid, startTicks: proc.startTicks}]
+	c.cpuSamplesMutex.Unlock()
+
+	if !ok || proc.cpuTicks < previous.cpuTicks {
+		previous = cpuSample{time: proc.startTime(boot)}
+	}
+
+	elapsed := sample.time.Sub(previous.time).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	used := float64(proc.cpuTicks-previous.cpuTicks) / clockTicks
+	return plugins.Round(used / elapsed * 100)
+}
+
+// startTime returns the time when the process started
+func (p process) startTime(boot time.Time) time.Time {
+	return boot.Add(time.Duration(p.startTicks) * time.Second / clockTicks)
+}
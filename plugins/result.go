@@ -25,6 +25,20 @@ const (
 	errFailedTemplate = "unable to apply jagozzi template %q: %s"
 )
 
+// statusSeverity orders statuses, from healthy to worst
+var statusSeverity = map[StatusEnum]int{
+	STATE_OK:       0,
+	STATE_UNKNOWN:  1,
+	STATE_WARNING:  2,
+	STATE_CRITICAL: 3,
+}
+
+// Severity ranks the status, from 0 for a healthy service to 3 for a critical one; unknown status is ranked between
+// ok and warning
+func (s StatusEnum) Severity() int {
+	return statusSeverity[s]
+}
+
 // Result is the structure that represents a checker result
 type Result struct {
 	// Status indicates if check was successful or not
@@ -33,6 +47,8 @@ type Result struct {
 	Message string
 	// Checker is the checker that returns this result
 	Checker Checker
+	// PerfData is the list of performance data measured by the checker
+	PerfData []PerfData
 }
 
 // RenderError allow personalised rendering if checker contains a template
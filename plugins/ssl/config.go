@@ -1,7 +1,10 @@
 package ssl
 
 import (
+	"errors"
 	"fmt"
+	"net"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
@@ -9,17 +12,40 @@ import (
 
 	"github.com/rbeuque74/jagozzi/config"
 	validator "gopkg.in/go-playground/validator.v9"
+	defaults "gopkg.in/mcuadros/go-defaults.v1"
 )
 
 type rawSSLConfig struct {
 	config.GenericPluginConfiguration
-	Host     string   `json:"host" validate:"required"`
-	Warning  Duration `json:"warn"`
-	Critical Duration `json:"crit"`
+	Host       string   `json:"host"`
+	Warning    Duration `json:"warn"`
+	Critical   Duration `json:"crit"`
+	RawTimeout int64    `json:"timeout" default:"5000"`
+	StartTLS   string   `json:"starttls" validate:"omitempty,eq=smtp|eq=imap|eq=pop3|eq=ftp|eq=postgres|eq=ldap"`
+	// ServerName is the name sent using SNI and expected in certificate, host name is used if empty
+	ServerName string `json:"server_name"`
+	// AllowUntrusted inspects certificates even when chain can't be verified
+	AllowUntrusted bool `json:"allow_untrusted"`
+	// Issuer is the expected common name or distinguished name of leaf certificate issuer
+	Issuer string `json:"issuer"`
+	// Fingerprints are the SHA-256 fingerprints of certificates; one certificate of the chain must match
+	Fingerprints []string `json:"fingerprints"`
+	// MinKeySize is the minimum size in bits of RSA and DSA keys
+	MinKeySize int `json:"min_key_size"`
+	// RejectWeakSignatures rejects certificates signed using MD2, MD5 or SHA-1
+	RejectWeakSignatures bool `json:"reject_weak_signatures"`
+	// RequireOCSPStapling requires server to staple an OCSP response
+	RequireOCSPStapling bool `json:"require_ocsp_stapling"`
+	// Files are the paths or globs of local PEM or DER certificate files, checked instead of host;
+	// directories are expanded to the files they contain
+	Files []string `json:"files"`
+	// CAFile is the path of a PEM bundle of certificate authorities used instead of system ones to verify chains
+	CAFile string `json:"ca_file"`
 }
 
 type sslConfig struct {
 	rawSSLConfig
+	Timeout time.Duration `json:"-"`
 }
 
 func (cfg *sslConfig) UnmarshalJSON(b []byte) error {
@@ -29,22 +55,55 @@ func (cfg *sslConfig) UnmarshalJSON(b []byte) error {
 		return err
 	}
 
+	defaults.SetDefaults(raw)
+
 	validate := validator.New()
 	if err := validate.Struct(raw); err != nil {
 		return err
 	}
 
 	cfg.rawSSLConfig = *raw
+	cfg.Timeout = time.Duration(raw.RawTimeout) * time.Millisecond
+
+	if cfg.Host != "" && len(cfg.Files) > 0 {
+		return errors.New("host and files keys are incompatible")
+	} else if cfg.Host == "" && len(cfg.Files) == 0 {
+		return errors.New("host or files key is required")
+	} else if len(cfg.Files) > 0 {
+		for _, pattern := range cfg.Files {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid files pattern %q: %s", pattern, err)
+			}
+		}
+		return nil
+	}
 
-	if !strings.Contains(cfg.Host, ":") {
-		// adding default https port
-		cfg.Host = cfg.Host + ":443"
+	if _, _, err := net.SplitHostPort(cfg.Host); err != nil {
+		// adding default port of the protocol
+		cfg.Host = net.JoinHostPort(strings.Trim(cfg.Host, "[]"), defaultPorts[cfg.StartTLS])
+	}
+
+	if cfg.ServerName == "" {
+		host, _, err := net.SplitHostPort(cfg.Host)
+		if err != nil {
+			return err
+		}
+		cfg.ServerName = host
+	}
+
+	for i, fingerprint := range cfg.Fingerprints {
+		fingerprint = strings.ToLower(strings.Replace(fingerprint, ":", "", -1))
+		if !validFingerprint.MatchString(fingerprint) {
+			return fmt.Errorf("invalid SHA-256 fingerprint %q", cfg.Fingerprints[i])
+		}
+		cfg.Fingerprints[i] = fingerprint
 	}
 
 	return nil
 }
 
 var validBigDuration = regexp.MustCompile(`^(\d+)(d|mo)$`)
+var validFingerprint = regexp.MustCompile(`^[0-9a-f]{64}$`)
 
 type Duration struct {
 	time.Duration
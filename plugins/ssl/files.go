@@ -0,0 +1,157 @@
+package ssl
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/rbeuque74/jagozzi/plugins"
+	log "github.com/sirupsen/logrus"
+)
+
+// certificateFiles returns the files matched by the configured patterns; directories are expanded to the
+// regular files they contain
+func (c SSLChecker) certificateFiles() ([]string, error) {
+	seen := make(map[string]struct{})
+	var files []string
+	add := func(path string) {
+		if _, ok := seen[path]; !ok {
+			seen[path] = struct{}{}
+			files = append(files, path)
+		}
+	}
+
+	for _, pattern := range c.cfg.Files {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				return nil, err
+			}
+			if !info.IsDir() {
+				add(match)
+				continue
+			}
+
+			entries, err := ioutil.ReadDir(match)
+			if err != nil {
+				return nil, err
+			}
+			for _, entry := range entries {
+				if entry.Mode().IsRegular() {
+					add(filepath.Join(match, entry.Name()))
+				}
+			}
+		}
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+// readCertificates parses every certificate of a PEM file, or the certificates of a DER file.
+// Files without any certificate, such as private keys, are ignored.
+func readCertificates(path string) ([]*x509.Certificate, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var certs []*x509.Certificate
+	var foundPEM bool
+	for rest := data; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		foundPEM = true
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("can't parse certificate in %q: %s", path, err)
+		}
+		certs = append(certs, cert)
+	}
+
+	if !foundPEM {
+		// DER file, silently ignored if it isn't a certificate
+		if derCerts, err := x509.ParseCertificates(data); err == nil {
+			certs = derCerts
+		}
+	}
+	return certs, nil
+}
+
+// runFiles checks the expiration of the certificates stored in local files
+func (c *SSLChecker) runFiles() plugins.Result {
+	files, err := c.certificateFiles()
+	if err != nil {
+		return plugins.ResultFromError(c, err, "can't list certificate files")
+	}
+
+	timeNow := time.Now()
+
+	var failures []failure
+	var leastResultCN, leastResultFile string
+	var leastResultExpiration time.Duration
+	var found bool
+
+	for _, file := range files {
+		certs, err := readCertificates(file)
+		if err != nil {
+			failures = append(failures, failure{plugins.STATE_CRITICAL, err.Error()})
+			continue
+		}
+
+		for _, cert := range certs {
+			lastResultExpiration := cert.NotAfter.Sub(timeNow).Truncate(time.Minute)
+			log.Debugf("certificate %s in %s expires in %s", cert.Subject.CommonName, file, Duration{Duration: lastResultExpiration})
+
+			if f := c.checkExpiration(cert, lastResultExpiration); f != nil {
+				f.message = fmt.Sprintf("%s in %s", f.message, file)
+				failures = append(failures, *f)
+			}
+
+			if !found || lastResultExpiration < leastResultExpiration {
+				leastResultExpiration = lastResultExpiration
+				leastResultCN = cert.Subject.CommonName
+				leastResultFile = file
+			}
+			found = true
+		}
+	}
+
+	if !found && len(failures) == 0 {
+		return plugins.Result{
+			Status:  plugins.STATE_CRITICAL,
+			Message: fmt.Sprintf("no certificate found in %q", c.cfg.Files),
+			Checker: c,
+		}
+	}
+
+	status, message := worstFailure(failures)
+	if status == plugins.STATE_OK {
+		message = fmt.Sprintf("%q in %s expires in %s", leastResultCN, leastResultFile, Duration{Duration: leastResultExpiration})
+	}
+
+	result := plugins.Result{
+		Status:  status,
+		Message: message,
+		Checker: c,
+	}
+	if found {
+		result.PerfData = c.perfData(leastResultExpiration)
+	}
+	return result
+}
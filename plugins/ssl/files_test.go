@@ -0,0 +1,93 @@
+package ssl
+
+import (
+	"context"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rbeuque74/jagozzi/plugins"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFile(t *testing.T, path string, data []byte) {
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+}
+
+func TestSSLFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jagozzi-ssl")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	longCert, _ := generateCertificate(t, 60*24*time.Hour)
+	shortCert, _ := generateCertificate(t, 20*24*time.Hour)
+
+	// PEM bundle, with a private key
+	bundle := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: []byte("not a key")})
+	bundle = append(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: longCert.Certificate[0]})...)
+	writeFile(t, filepath.Join(dir, "bundle.pem"), bundle)
+
+	// DER certificate in a sub directory
+	assert.Nil(t, os.Mkdir(filepath.Join(dir, "certs"), 0700))
+	writeFile(t, filepath.Join(dir, "certs", "short.der"), shortCert.Certificate[0])
+	writeFile(t, filepath.Join(dir, "certs", "README"), []byte("certificates of internal CA"))
+
+	cfg := map[string]interface{}{
+		"files": []string{filepath.Join(dir, "*.pem")},
+		"warn":  "10d",
+		"crit":  "5d",
+		"name":  "test-1",
+	}
+	checker := newChecker(t, cfg, nil)
+
+	result := checker.Run(context.Background())
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+	assert.Equalf(t, `"jagozzi.test" in `+filepath.Join(dir, "bundle.pem")+` expires in 1months29d23h59m0s`, result.Message, "ssl bad message: %q", result.Message)
+
+	// directory is expanded, soonest expiring certificate is reported
+	cfg["files"] = []string{filepath.Join(dir, "*.pem"), filepath.Join(dir, "certs")}
+	checker = newChecker(t, cfg, nil)
+	result = checker.Run(context.Background())
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+	assert.Containsf(t, result.Message, filepath.Join(dir, "certs", "short.der")+" expires in 19d", "ssl bad message: %q", result.Message)
+	if assert.Len(t, result.PerfData, 1) {
+		assert.Equal(t, "days", result.PerfData[0].Label)
+	}
+
+	cfg["warn"] = "1mo"
+	checker = newChecker(t, cfg, nil)
+	result = checker.Run(context.Background())
+	assert.Equal(t, plugins.STATE_WARNING, result.Status)
+	assert.Containsf(t, result.Message, `expiration due in 19d`, "ssl bad message: %q", result.Message)
+	assert.Containsf(t, result.Message, `for "jagozzi.test" in `+filepath.Join(dir, "certs", "short.der"), "ssl bad message: %q", result.Message)
+
+	// invalid certificate
+	writeFile(t, filepath.Join(dir, "broken.pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("broken")}))
+	checker = newChecker(t, cfg, nil)
+	result = checker.Run(context.Background())
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+	assert.Containsf(t, result.Message, "can't parse certificate in", "ssl bad message: %q", result.Message)
+
+	// no certificate found
+	cfg["files"] = []string{filepath.Join(dir, "*.crt")}
+	checker = newChecker(t, cfg, nil)
+	result = checker.Run(context.Background())
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+	assert.Containsf(t, result.Message, "no certificate found", "ssl bad message: %q", result.Message)
+
+	// host and files are exclusive
+	cfg["host"] = "jagozzi.test:443"
+	_, err = NewSSLChecker(cfg, nil)
+	assert.NotNil(t, err)
+
+	delete(cfg, "host")
+	delete(cfg, "files")
+	_, err = NewSSLChecker(cfg, nil)
+	assert.NotNil(t, err)
+}
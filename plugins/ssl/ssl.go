@@ -3,7 +3,10 @@ package ssl
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"io/ioutil"
+	"math"
 	"net"
 	"time"
 
@@ -18,10 +21,12 @@ func init() {
 	plugins.Register(pluginName, NewSSLChecker)
 }
 
-// SSLChecker is a plugin to check SSL certificate expiration date
+// SSLChecker is a plugin to check SSL certificate expiration date and validity
 type SSLChecker struct {
 	cfg            sslConfig
 	executableName string
+	// rootCAs are the certificate authorities used to verify certificates, system ones if nil
+	rootCAs *x509.CertPool
 }
 
 // Name returns the name of the checker
@@ -41,10 +46,11 @@ func (c SSLChecker) Periodicity() *time.Duration {
 
 // Run is performing the checker protocol
 func (c *SSLChecker) Run(ctx context.Context) plugins.Result {
-	dialer := &net.Dialer{
-		Timeout: 5 * time.Second,
+	if len(c.cfg.Files) > 0 {
+		return c.runFiles()
 	}
-	conn, err := tls.DialWithDialer(dialer, "tcp", c.cfg.Host, nil)
+
+	conn, err := c.dial(ctx)
 	if conn != nil {
 		defer conn.Close()
 	}
@@ -53,55 +59,37 @@ func (c *SSLChecker) Run(ctx context.Context) plugins.Result {
 	}
 
 	timeNow := time.Now()
+	state := conn.ConnectionState()
+
+	chains, verifyErr := c.verify(state.PeerCertificates, timeNow)
+	if verifyErr != nil && !c.cfg.AllowUntrusted {
+		return plugins.ResultFromError(c, verifyErr, "untrusted certificate chain")
+	}
 
-	checkedCerts := make(map[string]struct{})
+	var failures []failure
 	var leastResultCN string
 	var leastResultExpiration time.Duration
+	certs := inspectedCertificates(chains, state.PeerCertificates)
+
+	for i, cert := range certs {
+		lastResultCN := cert.Subject.CommonName
+		lastResultExpiration := cert.NotAfter.Sub(timeNow).Truncate(time.Minute)
+
+		log.Debugf("certificate %s expires in %s", lastResultCN, Duration{Duration: lastResultExpiration})
+		log.Debugf("alternative names %+v", cert.DNSNames)
 
-	for _, chain := range conn.ConnectionState().VerifiedChains {
-		for _, cert := range chain {
-			if _, checked := checkedCerts[string(cert.Signature)]; checked {
-				continue
-			}
-			checkedCerts[string(cert.Signature)] = struct{}{}
-
-			if timeNow.After(cert.NotAfter) {
-				return plugins.Result{
-					Status:  plugins.STATE_CRITICAL,
-					Message: fmt.Sprintf("certificate expired: %q", cert.Subject.CommonName),
-					Checker: c,
-				}
-			}
-
-			lastResultCN := cert.Subject.CommonName
-			lastResultExpiration := cert.NotAfter.Sub(timeNow).Truncate(time.Minute)
-
-			log.Debugf("certificate %s expires in %s", lastResultCN, Duration{Duration: lastResultExpiration})
-			log.Debugf("alternative names %+v", cert.Subject.ExtraNames)
-
-			// Check the expiration.
-			if lastResultExpiration < c.cfg.Critical.Duration {
-				return plugins.Result{
-					Status:  plugins.STATE_CRITICAL,
-					Message: fmt.Sprintf("expiration due in %s for %q", Duration{Duration: lastResultExpiration}, cert.Subject.CommonName),
-					Checker: c,
-				}
-			} else if lastResultExpiration < c.cfg.Warning.Duration {
-				return plugins.Result{
-					Status:  plugins.STATE_WARNING,
-					Message: fmt.Sprintf("expiration due in %s for %q", Duration{Duration: lastResultExpiration}, cert.Subject.CommonName),
-					Checker: c,
-				}
-			}
-
-			if leastResultExpiration == 0 || lastResultExpiration < leastResultExpiration {
-				leastResultExpiration = lastResultExpiration
-				leastResultCN = lastResultCN
-			}
+		if f := c.checkExpiration(cert, lastResultExpiration); f != nil {
+			failures = append(failures, *f)
+		}
+		failures = append(failures, c.checkCertificate(cert)...)
+
+		if i == 0 || lastResultExpiration < leastResultExpiration {
+			leastResultExpiration = lastResultExpiration
+			leastResultCN = lastResultCN
 		}
 	}
 
-	if leastResultExpiration == 0 {
+	if len(certs) == 0 {
 		return plugins.Result{
 			Status:  plugins.STATE_CRITICAL,
 			Message: fmt.Sprintf("no certificate found for %q", c.cfg.Host),
@@ -109,13 +97,75 @@ func (c *SSLChecker) Run(ctx context.Context) plugins.Result {
 		}
 	}
 
+	failures = append(failures, c.checkConnection(state)...)
+
+	status, message := worstFailure(failures)
+	if status == plugins.STATE_OK {
+		message = fmt.Sprintf("%q expires in %s", leastResultCN, Duration{Duration: leastResultExpiration})
+	}
+	if verifyErr != nil {
+		message = fmt.Sprintf("%s (untrusted: %s)", message, verifyErr)
+	}
+
 	return plugins.Result{
-		Status:  plugins.STATE_OK,
-		Message: fmt.Sprintf("%q expires in %s", leastResultCN, Duration{Duration: leastResultExpiration}),
-		Checker: c,
+		Status:   status,
+		Message:  message,
+		Checker:  c,
+		PerfData: c.perfData(leastResultExpiration),
 	}
 }
 
+// dial opens a TLS connection to the host, negotiating STARTTLS if needed, bound to the run context and timeout
+func (c SSLChecker) dial(ctx context.Context) (*tls.Conn, error) {
+	if c.cfg.Timeout > 0 {
+		var cancel func()
+		ctx, cancel = context.WithTimeout(ctx, c.cfg.Timeout)
+		defer cancel()
+	}
+
+	dialer := &net.Dialer{}
+	rawConn, err := dialer.DialContext(ctx, "tcp", c.cfg.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := rawConn.SetDeadline(deadline); err != nil {
+			rawConn.Close()
+			return nil, err
+		}
+	}
+
+	if negotiate, ok := starttlsNegotiators[c.cfg.StartTLS]; ok {
+		if err := negotiate(rawConn); err != nil {
+			rawConn.Close()
+			return nil, fmt.Errorf("%s STARTTLS: %s", c.cfg.StartTLS, err)
+		}
+	}
+
+	// certificates are verified by the checker, in order to inspect them even when chain is untrusted
+	conn := tls.Client(rawConn, &tls.Config{
+		ServerName:         c.cfg.ServerName,
+		InsecureSkipVerify: true,
+	})
+	if err := conn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// perfData returns the performance data of a certificate expiring in the given duration
+func (c SSLChecker) perfData(expiration time.Duration) []plugins.PerfData {
+	return []plugins.PerfData{
+		plugins.NewPerfData("days", days(expiration), "").WithLowerThresholds(days(c.cfg.Warning.Duration), days(c.cfg.Critical.Duration)),
+	}
+}
+
+func days(d time.Duration) float64 {
+	return math.Round(d.Hours()/24*100) / 100
+}
+
 // NewSSLChecker create a SSL checker
 func NewSSLChecker(conf interface{}, pluginConf interface{}) (plugins.Checker, error) {
 	out, err := yaml.Marshal(conf)
@@ -133,6 +183,23 @@ func NewSSLChecker(conf interface{}, pluginConf interface{}) (plugins.Checker, e
 		cfg: cfg,
 	}
 
-	log.Infof("SSL: Checker activated for %q", checker.cfg.Host)
+	if cfg.CAFile != "" {
+		bundle, err := ioutil.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("ca_file: %s", err)
+		}
+		checker.rootCAs = x509.NewCertPool()
+		if !checker.rootCAs.AppendCertsFromPEM(bundle) {
+			return nil, fmt.Errorf("ca_file: no PEM certificate found in %q", cfg.CAFile)
+		}
+	}
+
+	if len(cfg.Files) > 0 {
+		log.Infof("SSL: Checker activated for files %q", cfg.Files)
+	} else if cfg.StartTLS != "" {
+		log.Infof("SSL: Checker activated for %q using %s STARTTLS", checker.cfg.Host, cfg.StartTLS)
+	} else {
+		log.Infof("SSL: Checker activated for %q", checker.cfg.Host)
+	}
 	return checker, nil
 }
@@ -0,0 +1,509 @@
+package ssl
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rbeuque74/jagozzi/plugins"
+	"github.com/stretchr/testify/assert"
+)
+
+// generateCertificate creates a self-signed certificate for 127.0.0.1 expiring in the given duration
+func generateCertificate(t *testing.T, expiration time.Duration) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "jagozzi.test"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(expiration),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+// newTLSServer starts a server that negotiates the given protocol before TLS handshake
+func newTLSServer(t *testing.T, cert tls.Certificate, negotiate func(conn net.Conn) error) (string, func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				if negotiate != nil {
+					if err := negotiate(conn); err != nil {
+						return
+					}
+				}
+				tlsConn := tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{cert}})
+				tlsConn.Handshake()
+				io.Copy(ioutil.Discard, tlsConn)
+			}(conn)
+		}
+	}()
+
+	return listener.Addr().String(), func() {
+		listener.Close()
+	}
+}
+
+// lineServer returns a negotiation that sends a greeting, then answers to each expected command
+func lineServer(greeting string, replies map[string]string, upgrade string) func(conn net.Conn) error {
+	return func(conn net.Conn) error {
+		io.WriteString(conn, greeting)
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return err
+			}
+			line = strings.TrimRight(line, "\r\n")
+			io.WriteString(conn, replies[line])
+			if line == upgrade {
+				return nil
+			}
+		}
+	}
+}
+
+func postgresServer(conn net.Conn) error {
+	request := make([]byte, 8)
+	if _, err := io.ReadFull(conn, request); err != nil {
+		return err
+	}
+	if binary.BigEndian.Uint32(request[4:8]) != postgresSSLRequestCode {
+		conn.Write([]byte("N"))
+		return io.EOF
+	}
+	_, err := conn.Write([]byte("S"))
+	return err
+}
+
+func ldapServer(conn net.Conn) error {
+	if _, _, err := readBER(conn); err != nil {
+		return err
+	}
+	// LDAPMessage { messageID 1, ExtendedResponse { resultCode success, matchedDN "", diagnosticMessage "" } }
+	_, err := conn.Write([]byte{0x30, 0x0c, 0x02, 0x01, 0x01, 0x78, 0x07, 0x0a, 0x01, 0x00, 0x04, 0x00, 0x04, 0x00})
+	return err
+}
+
+// generateSignedCertificate creates a RSA certificate authority, and a certificate for 127.0.0.1 signed by it
+func generateSignedCertificate(t *testing.T, keySize int, algorithm x509.SignatureAlgorithm) (tls.Certificate, *x509.CertPool) {
+	caKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "jagozzi CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, keySize)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+	template := &x509.Certificate{
+		SerialNumber:       big.NewInt(2),
+		Subject:            pkix.Name{CommonName: "jagozzi.test"},
+		IPAddresses:        []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:          time.Now().Add(-time.Hour),
+		NotAfter:           time.Now().Add(20 * 24 * time.Hour),
+		KeyUsage:           x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:        []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		SignatureAlgorithm: algorithm,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	return tls.Certificate{Certificate: [][]byte{der, caDER}, PrivateKey: key}, pool
+}
+
+func newChecker(t *testing.T, cfg map[string]interface{}, rootCAs *x509.CertPool) *SSLChecker {
+	checker, err := NewSSLChecker(cfg, nil)
+	assert.Nilf(t, err, "ssl checker instantiation failed: %q", err)
+	if err != nil {
+		t.FailNow()
+	}
+
+	sslChecker := checker.(*SSLChecker)
+	sslChecker.rootCAs = rootCAs
+	return sslChecker
+}
+
+func TestSSL(t *testing.T) {
+	cert, pool := generateCertificate(t, 20*24*time.Hour)
+	host, shutdown := newTLSServer(t, cert, nil)
+	defer shutdown()
+
+	cfg := map[string]interface{}{
+		"host": host,
+		"warn": "10d",
+		"crit": "5d",
+		"name": "test-1",
+	}
+	checker := newChecker(t, cfg, pool)
+
+	assert.Equal(t, "SSL", checker.Name())
+	assert.Equal(t, "test-1", checker.ServiceName())
+
+	ctxRun, cancelFunc1 := context.WithTimeout(context.Background(), time.Second)
+	defer cancelFunc1()
+	result := checker.Run(ctxRun)
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+	assert.Containsf(t, result.Message, `"jagozzi.test" expires in 19d`, "ssl bad message: %q", result.Message)
+
+	cfg["warn"] = "1mo"
+	checker = newChecker(t, cfg, pool)
+	result = checker.Run(ctxRun)
+	assert.Equal(t, plugins.STATE_WARNING, result.Status)
+
+	// certificate is not trusted
+	checker = newChecker(t, cfg, nil)
+	result = checker.Run(ctxRun)
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+	assert.Containsf(t, result.Message, "untrusted certificate chain", "ssl bad message: %q", result.Message)
+
+	// expiration is reported even if chain is trusted
+	expiredCert, expiredPool := generateCertificate(t, -time.Minute)
+	expiredHost, shutdownExpired := newTLSServer(t, expiredCert, nil)
+	defer shutdownExpired()
+	cfg["host"] = expiredHost
+	checker = newChecker(t, cfg, expiredPool)
+	result = checker.Run(ctxRun)
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+	assert.Equalf(t, `certificate expired: "jagozzi.test"`, result.Message, "ssl bad message: %q", result.Message)
+}
+
+func TestSSLTimeout(t *testing.T) {
+	// server never answers to TLS handshake
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+
+	cfg := map[string]interface{}{
+		"host":    listener.Addr().String(),
+		"warn":    "10d",
+		"crit":    "5d",
+		"timeout": 100,
+		"name":    "test-1",
+	}
+	checker := newChecker(t, cfg, nil)
+
+	start := time.Now()
+	result := checker.Run(context.Background())
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+	assert.True(t, time.Since(start) < 500*time.Millisecond)
+
+	// run context is honoured
+	cfg["timeout"] = 5000
+	checker = newChecker(t, cfg, nil)
+
+	ctxRun, cancelFunc1 := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancelFunc1()
+	start = time.Now()
+	result = checker.Run(ctxRun)
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+	assert.True(t, time.Since(start) < 500*time.Millisecond)
+}
+
+func TestSSLStartTLS(t *testing.T) {
+	cert, pool := generateCertificate(t, 20*24*time.Hour)
+
+	servers := map[string]func(conn net.Conn) error{
+		"smtp": lineServer("220-jagozzi.test ESMTP\r\n220 ready\r\n", map[string]string{
+			"EHLO jagozzi": "250-jagozzi.test\r\n250 STARTTLS\r\n",
+			"STARTTLS":     "220 go ahead\r\n",
+		}, "STARTTLS"),
+		"imap": lineServer("* OK IMAP4rev1 ready\r\n", map[string]string{
+			"a001 STARTTLS": "* CAPABILITY IMAP4rev1\r\na001 OK begin TLS\r\n",
+		}, "a001 STARTTLS"),
+		"pop3": lineServer("+OK POP3 ready\r\n", map[string]string{
+			"STLS": "+OK begin TLS\r\n",
+		}, "STLS"),
+		"ftp": lineServer("220 FTP ready\r\n", map[string]string{
+			"AUTH TLS": "234 AUTH TLS successful\r\n",
+		}, "AUTH TLS"),
+		"postgres": postgresServer,
+		"ldap":     ldapServer,
+	}
+
+	for protocol, negotiate := range servers {
+		host, shutdown := newTLSServer(t, cert, negotiate)
+
+		cfg := map[string]interface{}{
+			"host":     host,
+			"warn":     "10d",
+			"crit":     "5d",
+			"starttls": protocol,
+			"name":     "test-1",
+		}
+		checker := newChecker(t, cfg, pool)
+
+		ctxRun, cancelFunc1 := context.WithTimeout(context.Background(), time.Second)
+		result := checker.Run(ctxRun)
+		assert.Equalf(t, plugins.STATE_OK, result.Status, "%s: %s", protocol, result.Message)
+		cancelFunc1()
+
+		// server doesn't speak the protocol
+		cfg["starttls"] = "smtp"
+		if protocol == "smtp" {
+			cfg["starttls"] = "pop3"
+		}
+		checker = newChecker(t, cfg, pool)
+
+		ctxRun, cancelFunc1 = context.WithTimeout(context.Background(), 200*time.Millisecond)
+		result = checker.Run(ctxRun)
+		assert.Equalf(t, plugins.STATE_CRITICAL, result.Status, "%s: %s", protocol, result.Message)
+		cancelFunc1()
+
+		shutdown()
+	}
+
+	// default port of protocol
+	cfg := map[string]interface{}{
+		"host":     "mail.jagozzi.test",
+		"warn":     "10d",
+		"crit":     "5d",
+		"starttls": "smtp",
+		"name":     "test-1",
+	}
+	checker := newChecker(t, cfg, pool)
+	assert.Equal(t, "mail.jagozzi.test:25", checker.cfg.Host)
+
+	cfg["starttls"] = "xmpp"
+	_, err := NewSSLChecker(cfg, nil)
+	assert.NotNil(t, err)
+}
+
+func TestSSLValidation(t *testing.T) {
+	cert, pool := generateCertificate(t, 20*24*time.Hour)
+	host, shutdown := newTLSServer(t, cert, nil)
+	defer shutdown()
+
+	ctxRun, cancelFunc1 := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFunc1()
+
+	newConfig := func(options map[string]interface{}) map[string]interface{} {
+		cfg := map[string]interface{}{
+			"host": host,
+			"warn": "10d",
+			"crit": "5d",
+			"name": "test-1",
+		}
+		for key, value := range options {
+			cfg[key] = value
+		}
+		return cfg
+	}
+
+	// hostname mismatch
+	checker := newChecker(t, newConfig(map[string]interface{}{"server_name": "other.test"}), pool)
+	result := checker.Run(ctxRun)
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+	assert.Containsf(t, result.Message, `hostname mismatch for "jagozzi.test"`, "ssl bad message: %q", result.Message)
+
+	// untrusted chain is inspected
+	checker = newChecker(t, newConfig(map[string]interface{}{"allow_untrusted": true}), nil)
+	result = checker.Run(ctxRun)
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+	assert.Containsf(t, result.Message, `"jagozzi.test" expires in 19d`, "ssl bad message: %q", result.Message)
+	assert.Containsf(t, result.Message, "(untrusted: ", "ssl bad message: %q", result.Message)
+
+	// fingerprint pinning
+	sum := sha256.Sum256(cert.Certificate[0])
+	pin := strings.ToUpper(hex.EncodeToString(sum[:]))
+	checker = newChecker(t, newConfig(map[string]interface{}{"fingerprints": []string{pin[:2] + ":" + pin[2:]}}), pool)
+	result = checker.Run(ctxRun)
+	assert.Equalf(t, plugins.STATE_OK, result.Status, "ssl bad message: %q", result.Message)
+
+	checker = newChecker(t, newConfig(map[string]interface{}{"fingerprints": []string{strings.Repeat("0", 64)}}), pool)
+	result = checker.Run(ctxRun)
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+	assert.Containsf(t, result.Message, "no certificate matches pinned fingerprints", "ssl bad message: %q", result.Message)
+
+	_, err := NewSSLChecker(newConfig(map[string]interface{}{"fingerprints": []string{"abcd"}}), nil)
+	assert.NotNil(t, err)
+
+	// expected issuer
+	checker = newChecker(t, newConfig(map[string]interface{}{"issuer": "jagozzi.test"}), pool)
+	result = checker.Run(ctxRun)
+	assert.Equalf(t, plugins.STATE_OK, result.Status, "ssl bad message: %q", result.Message)
+
+	checker = newChecker(t, newConfig(map[string]interface{}{"issuer": "Other CA"}), pool)
+	result = checker.Run(ctxRun)
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+	assert.Containsf(t, result.Message, `is not "Other CA" for "jagozzi.test"`, "ssl bad message: %q", result.Message)
+
+	// OCSP stapling
+	checker = newChecker(t, newConfig(map[string]interface{}{"require_ocsp_stapling": true}), pool)
+	result = checker.Run(ctxRun)
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+	assert.Containsf(t, result.Message, `no OCSP response stapled for "jagozzi.test"`, "ssl bad message: %q", result.Message)
+
+	stapledCert := cert
+	stapledCert.OCSPStaple = []byte{0x30, 0x03, 0x0a, 0x01, 0x00}
+	stapledHost, shutdownStapled := newTLSServer(t, stapledCert, nil)
+	defer shutdownStapled()
+	cfg := newConfig(map[string]interface{}{"require_ocsp_stapling": true})
+	cfg["host"] = stapledHost
+	checker = newChecker(t, cfg, pool)
+	result = checker.Run(ctxRun)
+	assert.Equalf(t, plugins.STATE_OK, result.Status, "ssl bad message: %q", result.Message)
+}
+
+func TestSSLCAFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jagozzi-ssl")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	cert, _ := generateCertificate(t, 20*24*time.Hour)
+	host, shutdown := newTLSServer(t, cert, nil)
+	defer shutdown()
+
+	caFile := filepath.Join(dir, "ca.pem")
+	writeFile(t, caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}))
+
+	cfg := map[string]interface{}{
+		"host":    host,
+		"warn":    "10d",
+		"crit":    "5d",
+		"ca_file": caFile,
+		"name":    "test-1",
+	}
+	checker, err := NewSSLChecker(cfg, nil)
+	assert.Nilf(t, err, "ssl checker instantiation failed: %q", err)
+	if err != nil {
+		t.FailNow()
+	}
+
+	ctxRun, cancelFunc1 := context.WithTimeout(context.Background(), time.Second)
+	defer cancelFunc1()
+	result := checker.Run(ctxRun)
+	assert.Equalf(t, plugins.STATE_OK, result.Status, "ssl bad message: %q", result.Message)
+
+	// file without certificate
+	writeFile(t, caFile, []byte("not a certificate"))
+	_, err = NewSSLChecker(cfg, nil)
+	assert.NotNil(t, err)
+
+	// missing file
+	cfg["ca_file"] = filepath.Join(dir, "missing.pem")
+	_, err = NewSSLChecker(cfg, nil)
+	assert.NotNil(t, err)
+}
+
+func TestSSLWeakCertificate(t *testing.T) {
+	cert, pool := generateSignedCertificate(t, 1024, x509.SHA1WithRSA)
+	host, shutdown := newTLSServer(t, cert, nil)
+	defer shutdown()
+
+	ctxRun, cancelFunc1 := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFunc1()
+
+	cfg := map[string]interface{}{
+		"host":            host,
+		"warn":            "10d",
+		"crit":            "5d",
+		"allow_untrusted": true,
+		"name":            "test-1",
+	}
+	checker := newChecker(t, cfg, pool)
+	result := checker.Run(ctxRun)
+	assert.Equalf(t, plugins.STATE_OK, result.Status, "ssl bad message: %q", result.Message)
+
+	// every failed rule is listed
+	cfg["min_key_size"] = 2048
+	cfg["reject_weak_signatures"] = true
+	cfg["warn"] = "1mo"
+	checker = newChecker(t, cfg, pool)
+	result = checker.Run(ctxRun)
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+	assert.Containsf(t, result.Message, `expiration due in 19d`, "ssl bad message: %q", result.Message)
+	assert.Containsf(t, result.Message, `key size of 1024 bits is below 2048 for "jagozzi.test"`, "ssl bad message: %q", result.Message)
+	assert.Containsf(t, result.Message, `weak signature algorithm SHA1-RSA for "jagozzi.test"`, "ssl bad message: %q", result.Message)
+	assert.NotContainsf(t, result.Message, `for "jagozzi CA"`, "ssl bad message: %q", result.Message)
+}
+
+func TestReadBERTooLarge(t *testing.T) {
+	// sequence announcing a 4 GiB content
+	_, _, err := readBER(bytes.NewReader([]byte{0x30, 0x84, 0xff, 0xff, 0xff, 0xff}))
+	assert.EqualError(t, err, "BER element too large: 4294967295 bytes")
+
+	tag, content, err := readBER(bytes.NewReader([]byte{0x02, 0x01, 0x05}))
+	assert.Nil(t, err)
+	assert.Equal(t, byte(0x02), tag)
+	assert.Equal(t, []byte{0x05}, content)
+}
@@ -0,0 +1,231 @@
+package ssl
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// starttlsNegotiators upgrade a plain connection so that TLS handshake can start, by protocol
+var starttlsNegotiators = map[string]func(conn net.Conn) error{
+	"smtp":     starttlsSMTP,
+	"imap":     starttlsIMAP,
+	"pop3":     starttlsPOP3,
+	"ftp":      starttlsFTP,
+	"postgres": starttlsPostgres,
+	"ldap":     starttlsLDAP,
+}
+
+// defaultPorts are the ports used when host doesn't specify one, by protocol
+var defaultPorts = map[string]string{
+	"":         "443",
+	"smtp":     "25",
+	"imap":     "143",
+	"pop3":     "110",
+	"ftp":      "21",
+	"postgres": "5432",
+	"ldap":     "389",
+}
+
+// readReply reads a reply of a line based protocol, following multi-line replies such as "250-" lines of SMTP and FTP
+func readReply(reader *bufio.Reader) (string, error) {
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if len(line) >= 4 && line[3] == '-' {
+			continue
+		}
+		return line, nil
+	}
+}
+
+// command sends a command and checks that reply starts with expected prefix
+func command(conn net.Conn, reader *bufio.Reader, cmd, expected string) error {
+	if _, err := io.WriteString(conn, cmd+"\r\n"); err != nil {
+		return err
+	}
+	reply, err := readReply(reader)
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(reply, expected) {
+		return fmt.Errorf("unexpected reply to %s: %q", cmd, reply)
+	}
+	return nil
+}
+
+// greeting reads the server greeting and checks that it starts with expected prefix
+func greeting(reader *bufio.Reader, expected string) error {
+	reply, err := readReply(reader)
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(reply, expected) {
+		return fmt.Errorf("unexpected greeting: %q", reply)
+	}
+	return nil
+}
+
+func starttlsSMTP(conn net.Conn) error {
+	reader := bufio.NewReader(conn)
+	if err := greeting(reader, "220"); err != nil {
+		return err
+	}
+	if err := command(conn, reader, "EHLO jagozzi", "250"); err != nil {
+		return err
+	}
+	return command(conn, reader, "STARTTLS", "220")
+}
+
+func starttlsIMAP(conn net.Conn) error {
+	reader := bufio.NewReader(conn)
+	if err := greeting(reader, "* OK"); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(conn, "a001 STARTTLS\r\n"); err != nil {
+		return err
+	}
+	// untagged responses can be sent before the tagged one
+	for {
+		reply, err := readReply(reader)
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(reply, "a001 ") {
+			if !strings.HasPrefix(reply, "a001 OK") {
+				return fmt.Errorf("unexpected reply to STARTTLS: %q", reply)
+			}
+			return nil
+		}
+	}
+}
+
+func starttlsPOP3(conn net.Conn) error {
+	reader := bufio.NewReader(conn)
+	if err := greeting(reader, "+OK"); err != nil {
+		return err
+	}
+	return command(conn, reader, "STLS", "+OK")
+}
+
+func starttlsFTP(conn net.Conn) error {
+	reader := bufio.NewReader(conn)
+	if err := greeting(reader, "220"); err != nil {
+		return err
+	}
+	return command(conn, reader, "AUTH TLS", "234")
+}
+
+// postgresSSLRequestCode is the code of SSLRequest message of PostgreSQL protocol
+const postgresSSLRequestCode = 80877103
+
+func starttlsPostgres(conn net.Conn) error {
+	request := make([]byte, 8)
+	binary.BigEndian.PutUint32(request[0:4], 8)
+	binary.BigEndian.PutUint32(request[4:8], postgresSSLRequestCode)
+	if _, err := conn.Write(request); err != nil {
+		return err
+	}
+
+	response := make([]byte, 1)
+	if _, err := io.ReadFull(conn, response); err != nil {
+		return err
+	}
+	if response[0] != 'S' {
+		return errors.New("server doesn't support SSL")
+	}
+	return nil
+}
+
+// ldapStartTLSOID is the name of the StartTLS extended request of LDAP
+const ldapStartTLSOID = "1.3.6.1.4.1.1466.20037"
+
+func starttlsLDAP(conn net.Conn) error {
+	// LDAPMessage { messageID 1, ExtendedRequest { requestName StartTLS } }
+	extendedRequest := append([]byte{0x80, byte(len(ldapStartTLSOID))}, ldapStartTLSOID...)
+	message := append([]byte{0x02, 0x01, 0x01, 0x77, byte(len(extendedRequest))}, extendedRequest...)
+	request := append([]byte{0x30, byte(len(message))}, message...)
+	if _, err := conn.Write(request); err != nil {
+		return err
+	}
+
+	_, content, err := readBER(conn)
+	if err != nil {
+		return err
+	}
+
+	// skipping messageID to read ExtendedResponse, whose first element is resultCode
+	tag, _, rest, err := parseBER(content)
+	if err != nil {
+		return err
+	}
+	if tag != 0x02 {
+		return fmt.Errorf("unexpected LDAP response")
+	}
+	tag, response, _, err := parseBER(rest)
+	if err != nil {
+		return err
+	}
+	if tag != 0x78 || len(response) < 3 || response[0] != 0x0a || response[1] != 0x01 {
+		return fmt.Errorf("unexpected LDAP response")
+	}
+	if resultCode := response[2]; resultCode != 0 {
+		return fmt.Errorf("StartTLS refused with LDAP result code %d", resultCode)
+	}
+	return nil
+}
+
+// maxBERLength is the maximum size of a BER element read from the server, LDAP StartTLS responses are a few bytes
+const maxBERLength = 64 * 1024
+
+// readBER reads a BER element from the connection and returns its tag and its content
+func readBER(reader io.Reader) (byte, []byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return 0, nil, err
+	}
+
+	length := int(header[1])
+	if length&0x80 != 0 {
+		size := length & 0x7f
+		if size == 0 || size > 4 {
+			return 0, nil, fmt.Errorf("invalid BER length")
+		}
+		lengthBytes := make([]byte, size)
+		if _, err := io.ReadFull(reader, lengthBytes); err != nil {
+			return 0, nil, err
+		}
+		length = 0
+		for _, b := range lengthBytes {
+			length = length<<8 | int(b)
+		}
+	}
+
+	if length < 0 || length > maxBERLength {
+		return 0, nil, fmt.Errorf("BER element too large: %d bytes", length)
+	}
+
+	content := make([]byte, length)
+	if _, err := io.ReadFull(reader, content); err != nil {
+		return 0, nil, err
+	}
+	return header[0], content, nil
+}
+
+// parseBER parses the first BER element of data and returns its tag, its content and the remaining data
+func parseBER(data []byte) (byte, []byte, []byte, error) {
+	reader := bytes.NewReader(data)
+	tag, content, err := readBER(reader)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	return tag, content, data[len(data)-reader.Len():], nil
+}
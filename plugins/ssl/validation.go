@@ -0,0 +1,190 @@
+package ssl
+
+import (
+	"bytes"
+	"crypto/dsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rbeuque74/jagozzi/plugins"
+)
+
+// weakSignatureAlgorithms are the signature algorithms rejected by reject_weak_signatures option
+var weakSignatureAlgorithms = map[x509.SignatureAlgorithm]struct{}{
+	x509.MD2WithRSA:    {},
+	x509.MD5WithRSA:    {},
+	x509.SHA1WithRSA:   {},
+	x509.DSAWithSHA1:   {},
+	x509.ECDSAWithSHA1: {},
+}
+
+// failure is a validation rule not respected by the certificates presented by the server
+type failure struct {
+	status  plugins.StatusEnum
+	message string
+}
+
+// verify checks the chain presented by the server against the trusted authorities.
+// Expiration is not considered here, as it is reported by the expiration rule.
+func (c SSLChecker) verify(peerCerts []*x509.Certificate, timeNow time.Time) ([][]*x509.Certificate, error) {
+	if len(peerCerts) == 0 {
+		return nil, fmt.Errorf("no certificate presented by %q", c.cfg.Host)
+	}
+
+	intermediates := x509.NewCertPool()
+	verifyTime := timeNow
+	for i, cert := range peerCerts {
+		if i > 0 {
+			intermediates.AddCert(cert)
+		}
+		if !cert.NotAfter.After(verifyTime) {
+			verifyTime = cert.NotAfter.Add(-time.Second)
+		}
+	}
+
+	return peerCerts[0].Verify(x509.VerifyOptions{
+		Roots:         c.rootCAs,
+		Intermediates: intermediates,
+		CurrentTime:   verifyTime,
+	})
+}
+
+// inspectedCertificates returns the certificates of the verified chains, or the ones presented by the server
+// if chain is untrusted; each certificate is returned once
+func inspectedCertificates(chains [][]*x509.Certificate, peerCerts []*x509.Certificate) []*x509.Certificate {
+	if len(chains) == 0 {
+		chains = [][]*x509.Certificate{peerCerts}
+	}
+
+	checkedCerts := make(map[string]struct{})
+	var certs []*x509.Certificate
+	for _, chain := range chains {
+		for _, cert := range chain {
+			if _, checked := checkedCerts[string(cert.Signature)]; checked {
+				continue
+			}
+			checkedCerts[string(cert.Signature)] = struct{}{}
+			certs = append(certs, cert)
+		}
+	}
+	return certs
+}
+
+// checkExpiration returns a failure if the certificate is expired or expires before thresholds
+func (c SSLChecker) checkExpiration(cert *x509.Certificate, expiration time.Duration) *failure {
+	switch {
+	case expiration <= 0:
+		return &failure{plugins.STATE_CRITICAL, fmt.Sprintf("certificate expired: %q", cert.Subject.CommonName)}
+	case expiration < c.cfg.Critical.Duration:
+		return &failure{plugins.STATE_CRITICAL, fmt.Sprintf("expiration due in %s for %q", Duration{Duration: expiration}, cert.Subject.CommonName)}
+	case expiration < c.cfg.Warning.Duration:
+		return &failure{plugins.STATE_WARNING, fmt.Sprintf("expiration due in %s for %q", Duration{Duration: expiration}, cert.Subject.CommonName)}
+	}
+	return nil
+}
+
+// checkCertificate applies the rules concerning each certificate of the chain
+func (c SSLChecker) checkCertificate(cert *x509.Certificate) []failure {
+	var failures []failure
+
+	if c.cfg.MinKeySize > 0 {
+		var size int
+		switch key := cert.PublicKey.(type) {
+		case *rsa.PublicKey:
+			size = key.N.BitLen()
+		case *dsa.PublicKey:
+			size = key.P.BitLen()
+		}
+		if size > 0 && size < c.cfg.MinKeySize {
+			failures = append(failures, failure{
+				plugins.STATE_CRITICAL,
+				fmt.Sprintf("key size of %d bits is below %d for %q", size, c.cfg.MinKeySize, cert.Subject.CommonName),
+			})
+		}
+	}
+
+	// signature of self-signed certificates is not relevant, as they are trusted as is
+	selfSigned := bytes.Equal(cert.RawIssuer, cert.RawSubject)
+	if _, weak := weakSignatureAlgorithms[cert.SignatureAlgorithm]; c.cfg.RejectWeakSignatures && weak && !selfSigned {
+		failures = append(failures, failure{
+			plugins.STATE_CRITICAL,
+			fmt.Sprintf("weak signature algorithm %s for %q", cert.SignatureAlgorithm, cert.Subject.CommonName),
+		})
+	}
+
+	return failures
+}
+
+// checkConnection applies the rules concerning the leaf certificate and the connection
+func (c SSLChecker) checkConnection(state tls.ConnectionState) []failure {
+	var failures []failure
+	leaf := state.PeerCertificates[0]
+
+	if err := leaf.VerifyHostname(c.cfg.ServerName); err != nil {
+		failures = append(failures, failure{
+			plugins.STATE_CRITICAL,
+			fmt.Sprintf("hostname mismatch for %q: %s", leaf.Subject.CommonName, err),
+		})
+	}
+
+	if c.cfg.Issuer != "" && leaf.Issuer.CommonName != c.cfg.Issuer && leaf.Issuer.String() != c.cfg.Issuer {
+		failures = append(failures, failure{
+			plugins.STATE_CRITICAL,
+			fmt.Sprintf("issuer %q is not %q for %q", leaf.Issuer.String(), c.cfg.Issuer, leaf.Subject.CommonName),
+		})
+	}
+
+	if len(c.cfg.Fingerprints) > 0 && !c.pinned(state.PeerCertificates) {
+		failures = append(failures, failure{
+			plugins.STATE_CRITICAL,
+			fmt.Sprintf("no certificate matches pinned fingerprints, %q has fingerprint %s", leaf.Subject.CommonName, fingerprint(leaf)),
+		})
+	}
+
+	if c.cfg.RequireOCSPStapling && len(state.OCSPResponse) == 0 {
+		failures = append(failures, failure{
+			plugins.STATE_CRITICAL,
+			fmt.Sprintf("no OCSP response stapled for %q", leaf.Subject.CommonName),
+		})
+	}
+
+	return failures
+}
+
+// pinned returns true if one of the certificates matches a configured fingerprint
+func (c SSLChecker) pinned(certs []*x509.Certificate) bool {
+	for _, cert := range certs {
+		certFingerprint := fingerprint(cert)
+		for _, expected := range c.cfg.Fingerprints {
+			if certFingerprint == expected {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// fingerprint returns the SHA-256 fingerprint of a certificate, as lowercase hexadecimal
+func fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// worstFailure returns the status and the message listing all the failures
+func worstFailure(failures []failure) (plugins.StatusEnum, string) {
+	status := plugins.STATE_OK
+	messages := make([]string, 0, len(failures))
+	for _, f := range failures {
+		if f.status == plugins.STATE_CRITICAL || status == plugins.STATE_OK {
+			status = f.status
+		}
+		messages = append(messages, f.message)
+	}
+	return status, strings.Join(messages, "; ")
+}
@@ -3,22 +3,60 @@ package supervisor
 import (
 	"fmt"
 	"net/url"
+	"path"
+	"strings"
 	"time"
 
 	"github.com/ghodss/yaml"
+	"github.com/ochinchina/supervisord/process"
 	"github.com/rbeuque74/jagozzi/config"
+	"github.com/rbeuque74/jagozzi/plugins"
 	validator "gopkg.in/go-playground/validator.v9"
 	defaults "gopkg.in/mcuadros/go-defaults.v1"
 )
 
 type checkerConfig struct {
 	rawCheckerConfig
+	// severities is the status reported for each state of a program that is not running
+	severities map[process.ProcessState]plugins.StatusEnum
+}
+
+// states are the states of a program that is not running, by name
+var states = map[string]process.ProcessState{
+	"STOPPED":  process.STOPPED,
+	"STARTING": process.STARTING,
+	"BACKOFF":  process.BACKOFF,
+	"STOPPING": process.STOPPING,
+	"EXITED":   process.EXITED,
+	"FATAL":    process.FATAL,
+	"UNKNOWN":  process.UNKNOWN,
+}
+
+// severities are the statuses that can be reported for a program state
+var severities = map[string]plugins.StatusEnum{
+	"ok":       plugins.STATE_OK,
+	"warning":  plugins.STATE_WARNING,
+	"critical": plugins.STATE_CRITICAL,
+	"unknown":  plugins.STATE_UNKNOWN,
 }
 
 type rawCheckerConfig struct {
 	config.GenericPluginConfiguration
-	Type    string  `json:"type" validate:"required,eq=service|eq=services"`
+	Type string `json:"type" validate:"required,eq=service|eq=services"`
+	// Service is the name of the checked program, or group:program to check a program of a group
 	Service *string `json:"service"`
+	// Include and Exclude are globs selecting the services checked in services mode
+	Include []string `json:"include"`
+	Exclude []string `json:"exclude"`
+	// MinUptime is the uptime in seconds below which a running service is a warning, as it just restarted
+	MinUptime int64 `json:"min_uptime" validate:"gte=0"`
+	// FlapThreshold is the number of restarts during flap window from which a service is flapping
+	FlapThreshold int `json:"flap_threshold" validate:"gte=0"`
+	// FlapWindow is the duration in seconds during which restarts are counted
+	FlapWindow int64 `json:"flap_window" default:"3600" validate:"gte=0"`
+	// States maps the states of programs that are not running to a severity, such as STARTING: warning;
+	// other states are critical
+	States map[string]string `json:"states"`
 }
 
 type pluginConfig struct {
@@ -81,6 +119,8 @@ func loadConfiguration(conf interface{}) (checkerConfig, error) {
 		return cfg, err
 	}
 
+	defaults.SetDefaults(&cfg.rawCheckerConfig)
+
 	validate := validator.New()
 	if err := validate.Struct(cfg); err != nil {
 		return cfg, err
@@ -89,6 +129,27 @@ func loadConfiguration(conf interface{}) (checkerConfig, error) {
 	if cfg.Service != nil && cfg.Type == "services" {
 		return cfg, fmt.Errorf("type 'services' and service key are incompatible")
 	}
+	if (len(cfg.Include) > 0 || len(cfg.Exclude) > 0) && cfg.Type != "services" {
+		return cfg, fmt.Errorf("include and exclude keys require type 'services'")
+	}
+	for _, pattern := range append(cfg.Include, cfg.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return cfg, fmt.Errorf("invalid pattern %q: %s", pattern, err)
+		}
+	}
+
+	cfg.severities = make(map[process.ProcessState]plugins.StatusEnum, len(cfg.States))
+	for name, severity := range cfg.States {
+		state, ok := states[strings.ToUpper(name)]
+		if !ok {
+			return cfg, fmt.Errorf("states: unknown state %q", name)
+		}
+		status, ok := severities[strings.ToLower(severity)]
+		if !ok {
+			return cfg, fmt.Errorf("states: severity of %s must be ok, warning, critical or unknown, not %q", name, severity)
+		}
+		cfg.severities[state] = status
+	}
 
 	return cfg, nil
 }
@@ -3,7 +3,11 @@ package supervisor
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"path"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ochinchina/supervisord/process"
@@ -20,26 +24,59 @@ func init() {
 
 // SupervisorChecker is a plugin to check status code of command
 type SupervisorChecker struct {
-	cfg            checkerConfig
-	pluginCfg      pluginConfig
-	executableName string
+	cfg       checkerConfig
+	pluginCfg pluginConfig
+	// transport is shared by XML-RPC calls of all runs, to reuse connections to supervisor daemon
+	transport http.RoundTripper
+	// history is the restarts of each program, used for flap detection
+	history      map[string]*restartHistory
+	historyMutex sync.Mutex
 }
 
 // Name returns the name of the checker
-func (c SupervisorChecker) Name() string {
+func (c *SupervisorChecker) Name() string {
 	return pluginName
 }
 
 // ServiceName returns the name of the NSCA service associated to the checker
-func (c SupervisorChecker) ServiceName() string {
+func (c *SupervisorChecker) ServiceName() string {
 	return c.cfg.Name
 }
 
 // Periodicity returns the delay between two checks
-func (c SupervisorChecker) Periodicity() *time.Duration {
+func (c *SupervisorChecker) Periodicity() *time.Duration {
 	return c.cfg.Periodicity()
 }
 
+// program is the status of a process managed by supervisor
+type program struct {
+	name        string
+	group       string
+	description string
+	state       process.ProcessState
+	pid         int
+	uptime      time.Duration
+}
+
+// key identifies the program among supervisor groups
+func (p program) key() string {
+	return p.group + ":" + p.name
+}
+
+// String returns the name of the program, prefixed by its group when it belongs to a group of several programs
+func (p program) String() string {
+	if p.group == "" || p.group == p.name {
+		return p.name
+	}
+	return p.key()
+}
+
+// restartHistory is the restarts of a program observed across runs
+type restartHistory struct {
+	pid      int
+	restarts []time.Time
+}
+
 // Run is performing the checker protocol
 func (c *SupervisorChecker) Run(ctx context.Context) plugins.Result {
 	rpcc := xmlrpcclient.NewXmlRPCClient(c.pluginCfg.ServerURL.String())
@@ -58,46 +95,190 @@ func (c *SupervisorChecker) Run(ctx context.Context) plugins.Result {
 		return plugins.ResultFromError(c, err, "unable to contact supervisor daemon")
 	}
 
+	now := time.Now()
+	running := 0
+	var programs []program
+	var stopped bool
 	for _, pinfo := range processesStates.Value {
-		name := strings.ToLower(pinfo.Name)
-
-		if c.cfg.Service != nil && *c.cfg.Service != name {
-			continue
-		}
-
 		description := pinfo.Description
-		processState := process.ProcessState(pinfo.State)
 		if strings.ToLower(description) == "<string></string>" {
 			description = ""
 		}
-		if pinfo.State != process.RUNNING {
-			return plugins.Result{
-				Status:  plugins.STATE_CRITICAL,
-				Message: fmt.Sprintf("Service %q is currently %s: %s", name, processState.String(), description),
-				Checker: c,
-			}
-		} else if c.cfg.Service != nil {
-			return plugins.Result{
-				Status:  plugins.STATE_OK,
-				Message: fmt.Sprintf("Service %q is running: %s", name, description),
-				Checker: c,
-			}
+		prog := program{
+			name:        strings.ToLower(pinfo.Name),
+			group:       strings.ToLower(pinfo.Group),
+			description: description,
+			state:       process.ProcessState(pinfo.State),
+			pid:         pinfo.Pid,
+			uptime:      time.Duration(pinfo.Now-pinfo.Start) * time.Second,
+		}
+		if !c.selected(prog) {
+			continue
+		}
+		programs = append(programs, prog)
+		stopped = stopped || prog.state == process.STOPPED
+		if prog.state == process.RUNNING {
+			running++
 		}
 	}
 
-	if c.cfg.Service != nil {
+	// programs that are not started automatically are expected to be stopped
+	var autostart map[string]bool
+	if stopped {
+		if autostart, err = c.autostartPrograms(ctx); err != nil {
+			log.Warnf("supervisor: unable to retrieve programs configuration: %s", err)
+		}
+	}
+
+	var failures []failure
+	var status plugins.StatusEnum
+	var message string
+	for _, prog := range programs {
+		status, message = c.evaluate(prog, c.recordRestarts(prog, now), autostart)
+		if status != plugins.STATE_OK {
+			failures = append(failures, failure{status: status, message: message})
+		}
+	}
+
+	if c.cfg.Service != nil && len(programs) == 0 {
 		return plugins.Result{
 			Status:  plugins.STATE_CRITICAL,
 			Message: fmt.Sprintf("Service %q not found", *c.cfg.Service),
 			Checker: c,
 		}
+	} else if c.cfg.Service != nil && len(programs) == 1 {
+		result := plugins.Result{
+			Status:  status,
+			Message: message,
+			Checker: c,
+		}
+		if programs[0].state == process.RUNNING {
+			result.PerfData = []plugins.PerfData{
+				plugins.NewPerfData("uptime", programs[0].uptime.Seconds(), "s").WithMin(0),
+			}
+		}
+		return result
 	}
 
-	return plugins.Result{
+	// services mode, or a service name found in several groups
+	result := plugins.Result{
 		Status:  plugins.STATE_OK,
 		Message: "All services are running",
 		Checker: c,
+		PerfData: []plugins.PerfData{
+			plugins.NewPerfData("running", float64(running), "").WithMin(0).WithMax(float64(len(programs))),
+		},
+	}
+	if len(failures) > 0 {
+		result.Status, result.Message = aggregate(failures)
+	}
+	return result
+}
+
+// failure is a program that is not healthy
+type failure struct {
+	status  plugins.StatusEnum
+	message string
+}
+
+// aggregate returns the worst status of failures, and a message listing them from the worst
+func aggregate(failures []failure) (plugins.StatusEnum, string) {
+	sort.SliceStable(failures, func(i, j int) bool {
+		return failures[i].status.Severity() > failures[j].status.Severity()
+	})
+
+	if len(failures) == 1 {
+		return failures[0].status, failures[0].message
+	}
+
+	messages := make([]string, 0, len(failures))
+	for _, f := range failures {
+		messages = append(messages, f.message)
+	}
+	return failures[0].status, fmt.Sprintf("%d services failing: %s", len(failures), strings.Join(messages, "; "))
+}
+
+// selected returns true if the program is checked
+func (c *SupervisorChecker) selected(prog program) bool {
+	if c.cfg.Service != nil {
+		return *c.cfg.Service == prog.name || *c.cfg.Service == prog.key()
+	}
+
+	// patterns match program name, or group:program to select programs of a group
+	matches := func(patterns []string) bool {
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, prog.name); ok {
+				return true
+			}
+			if ok, _ := path.Match(pattern, prog.key()); ok {
+				return true
+			}
+		}
+		return false
+	}
+	if len(c.cfg.Include) > 0 && !matches(c.cfg.Include) {
+		return false
+	}
+	return !matches(c.cfg.Exclude)
+}
+
+// evaluate returns the status of a program, according to its state, its uptime and its restarts
+func (c *SupervisorChecker) evaluate(prog program, restarts int, autostart map[string]bool) (plugins.StatusEnum, string) {
+	if prog.state != process.RUNNING {
+		status, configured := c.cfg.severities[prog.state]
+		if enabled, ok := autostart[prog.key()]; !configured && ok && !enabled && prog.state == process.STOPPED {
+			return plugins.STATE_OK, fmt.Sprintf("Service %q is stopped: autostart is disabled", prog.String())
+		}
+		if !configured {
+			status = plugins.STATE_CRITICAL
+		}
+		return status, fmt.Sprintf("Service %q is currently %s: %s", prog.String(), prog.state.String(), prog.description)
 	}
+
+	if c.cfg.FlapThreshold > 0 && restarts >= c.cfg.FlapThreshold {
+		return plugins.STATE_WARNING, fmt.Sprintf("Service %q is flapping, %d restarts in %s: %s", prog.String(), restarts, c.flapWindow(), prog.description)
+	}
+	if c.cfg.MinUptime > 0 && prog.uptime < time.Duration(c.cfg.MinUptime)*time.Second {
+		return plugins.STATE_WARNING, fmt.Sprintf("Service %q restarted %s ago: %s", prog.String(), prog.uptime, prog.description)
+	}
+	return plugins.STATE_OK, fmt.Sprintf("Service %q is running: %s", prog.String(), prog.description)
+}
+
+// recordRestarts remembers the pid of the program, and returns the number of restarts during flap window
+func (c *SupervisorChecker) recordRestarts(prog program, now time.Time) int {
+	if c.cfg.FlapThreshold == 0 {
+		return 0
+	}
+
+	c.historyMutex.Lock()
+	defer c.historyMutex.Unlock()
+
+	history, ok := c.history[prog.key()]
+	if !ok {
+		history = &restartHistory{}
+		c.history[prog.key()] = history
+	}
+
+	// pid is 0 while program is not running
+	if prog.pid != 0 {
+		if history.pid != 0 && history.pid != prog.pid {
+			history.restarts = append(history.restarts, now)
+		}
+		history.pid = prog.pid
+	}
+
+	restarts := history.restarts[:0]
+	for _, restart := range history.restarts {
+		if now.Sub(restart) < c.flapWindow() {
+			restarts = append(restarts, restart)
+		}
+	}
+	history.restarts = restarts
+	return len(restarts)
+}
+
+func (c *SupervisorChecker) flapWindow() time.Duration {
+	return time.Duration(c.cfg.FlapWindow) * time.Second
 }
 
 // NewSupervisorChecker create a Supervisor checker
@@ -115,6 +296,8 @@ func NewSupervisorChecker(checkerCfg interface{}, pluginCfg interface{}) (plugin
 	checker := &SupervisorChecker{
 		cfg:       cfg,
 		pluginCfg: pCfg,
+		transport: newTransport(pCfg.ServerURL),
+		history:   make(map[string]*restartHistory),
 	}
 
 	log.Infof("supervisor: Checker %q activated", checker.cfg.Type)
@@ -9,6 +9,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/ochinchina/supervisord/process"
 	"github.com/rbeuque74/jagozzi/plugins"
 	"github.com/stretchr/testify/assert"
 )
@@ -249,3 +250,240 @@ func TestSupervisorNotRunning(t *testing.T) {
 	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
 	assert.Equal(t, "unable to contact supervisor daemon: read unix @->/tmp/supervisord.sock: i/o timeout", result.Message)
 }
+
+func TestSupervisorFilters(t *testing.T) {
+	server := newFakeSupervisor(t,
+		fakeProgram{name: "web", group: "web", state: process.RUNNING, pid: 100, uptime: time.Hour, autostart: true},
+		fakeProgram{name: "worker-1", group: "workers", state: process.FATAL, autostart: true},
+		fakeProgram{name: "worker-2", group: "workers", state: process.RUNNING, pid: 102, uptime: time.Hour, autostart: true},
+	)
+	defer server.Close()
+
+	cfg := map[string]interface{}{
+		"type": "services",
+		"name": "test-1",
+	}
+
+	checker, err := NewSupervisorChecker(cfg, server.pluginConfig())
+	assert.Nilf(t, err, "supervisor checker instantiation failed: %q", err)
+
+	result := checker.Run(context.Background())
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+	assert.Equal(t, `Service "workers:worker-1" is currently FATAL: Exited too quickly (process log may have details)`, result.Message)
+
+	// excluding failing worker
+	cfg["exclude"] = []string{"worker-1"}
+	checker, err = NewSupervisorChecker(cfg, server.pluginConfig())
+	assert.Nilf(t, err, "supervisor checker instantiation failed: %q", err)
+
+	result = checker.Run(context.Background())
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+	assert.Equal(t, "All services are running", result.Message)
+
+	// including only web
+	delete(cfg, "exclude")
+	cfg["include"] = []string{"w*b"}
+	checker, err = NewSupervisorChecker(cfg, server.pluginConfig())
+	assert.Nilf(t, err, "supervisor checker instantiation failed: %q", err)
+
+	result = checker.Run(context.Background())
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+
+	// including workers, and excluding the failing one
+	cfg["include"] = []string{"worker-*"}
+	cfg["exclude"] = []string{"*-1"}
+	checker, err = NewSupervisorChecker(cfg, server.pluginConfig())
+	assert.Nilf(t, err, "supervisor checker instantiation failed: %q", err)
+
+	result = checker.Run(context.Background())
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+
+	// invalid configurations
+	cfg["include"] = []string{"["}
+	_, err = NewSupervisorChecker(cfg, server.pluginConfig())
+	assert.EqualError(t, err, `supervisor/cfg: invalid pattern "[": syntax error in pattern`)
+
+	cfg["type"] = "service"
+	cfg["service"] = "web"
+	cfg["include"] = []string{"web"}
+	_, err = NewSupervisorChecker(cfg, server.pluginConfig())
+	assert.EqualError(t, err, "supervisor/cfg: include and exclude keys require type 'services'")
+}
+
+func TestSupervisorUptime(t *testing.T) {
+	server := newFakeSupervisor(t,
+		fakeProgram{name: "app", group: "app", state: process.RUNNING, pid: 100, uptime: 30 * time.Second, autostart: true},
+	)
+	defer server.Close()
+
+	cfg := map[string]interface{}{
+		"type":       "service",
+		"name":       "test-1",
+		"service":    "app",
+		"min_uptime": 60,
+	}
+
+	checker, err := NewSupervisorChecker(cfg, server.pluginConfig())
+	assert.Nilf(t, err, "supervisor checker instantiation failed: %q", err)
+
+	result := checker.Run(context.Background())
+	assert.Equal(t, plugins.STATE_WARNING, result.Status)
+	assert.Equal(t, `Service "app" restarted 30s ago: pid 100, uptime 30s`, result.Message)
+	assert.Equal(t, "uptime=30s;;;0", plugins.FormatPerfData(result.PerfData))
+
+	server.setProgram(fakeProgram{name: "app", group: "app", state: process.RUNNING, pid: 100, uptime: 2 * time.Minute, autostart: true})
+	result = checker.Run(context.Background())
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+	assert.Equal(t, `Service "app" is running: pid 100, uptime 2m0s`, result.Message)
+}
+
+func TestSupervisorFlapping(t *testing.T) {
+	server := newFakeSupervisor(t,
+		fakeProgram{name: "app", group: "app", state: process.RUNNING, pid: 100, uptime: time.Hour, autostart: true},
+	)
+	defer server.Close()
+
+	cfg := map[string]interface{}{
+		"type":           "services",
+		"name":           "test-1",
+		"flap_threshold": 2,
+	}
+
+	checker, err := NewSupervisorChecker(cfg, server.pluginConfig())
+	assert.Nilf(t, err, "supervisor checker instantiation failed: %q", err)
+
+	result := checker.Run(context.Background())
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+
+	// first restart, below threshold
+	server.setProgram(fakeProgram{name: "app", group: "app", state: process.RUNNING, pid: 101, uptime: time.Second, autostart: true})
+	result = checker.Run(context.Background())
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+
+	// stopped between two restarts, pid is 0
+	server.setProgram(fakeProgram{name: "app", group: "app", state: process.STARTING, autostart: true})
+	result = checker.Run(context.Background())
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+	assert.Equal(t, `Service "app" is currently STARTING: Exited too quickly (process log may have details)`, result.Message)
+
+	server.setProgram(fakeProgram{name: "app", group: "app", state: process.RUNNING, pid: 102, uptime: time.Second, autostart: true})
+	result = checker.Run(context.Background())
+	assert.Equal(t, plugins.STATE_WARNING, result.Status)
+	assert.Equal(t, `Service "app" is flapping, 2 restarts in 1h0m0s: pid 102, uptime 1s`, result.Message)
+
+	// restarts are forgotten after flap window
+	checker.(*SupervisorChecker).cfg.FlapWindow = 0
+	result = checker.Run(context.Background())
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+}
+
+func TestSupervisorAutostart(t *testing.T) {
+	server := newFakeSupervisor(t,
+		fakeProgram{name: "app", group: "app", state: process.RUNNING, pid: 100, uptime: time.Hour, autostart: true},
+		fakeProgram{name: "cron", group: "cron", state: process.STOPPED, autostart: false},
+	)
+	defer server.Close()
+
+	cfg := map[string]interface{}{
+		"type":    "service",
+		"name":    "test-1",
+		"service": "cron",
+	}
+
+	checker, err := NewSupervisorChecker(cfg, server.pluginConfig())
+	assert.Nilf(t, err, "supervisor checker instantiation failed: %q", err)
+
+	result := checker.Run(context.Background())
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+	assert.Equal(t, `Service "cron" is stopped: autostart is disabled`, result.Message)
+
+	// stopped program supposed to be started
+	server.setProgram(fakeProgram{name: "cron", group: "cron", state: process.STOPPED, autostart: true})
+	result = checker.Run(context.Background())
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+	assert.Equal(t, `Service "cron" is currently STOPPED: Exited too quickly (process log may have details)`, result.Message)
+
+	// configuration not available: stopped programs are critical
+	server.setProgram(fakeProgram{name: "cron", group: "cron", state: process.STOPPED, autostart: false})
+	server.configInfo = false
+	result = checker.Run(context.Background())
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+}
+
+func TestSupervisorMultipleFailures(t *testing.T) {
+	server := newFakeSupervisor(t,
+		fakeProgram{name: "web", group: "web", state: process.STARTING, autostart: true},
+		fakeProgram{name: "worker-1", group: "workers", state: process.BACKOFF, autostart: true},
+		fakeProgram{name: "worker-2", group: "workers", state: process.RUNNING, pid: 102, uptime: time.Hour, autostart: true},
+		fakeProgram{name: "worker-1", group: "batch", state: process.RUNNING, pid: 103, uptime: time.Hour, autostart: true},
+	)
+	defer server.Close()
+
+	cfg := map[string]interface{}{
+		"type": "services",
+		"name": "test-1",
+	}
+
+	checker, err := NewSupervisorChecker(cfg, server.pluginConfig())
+	assert.Nilf(t, err, "supervisor checker instantiation failed: %q", err)
+
+	result := checker.Run(context.Background())
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+	assert.Equal(t, `2 services failing: `+
+		`Service "web" is currently STARTING: Exited too quickly (process log may have details); `+
+		`Service "workers:worker-1" is currently BACKOFF: Exited too quickly (process log may have details)`, result.Message)
+	assert.Equal(t, "running=2;;;0;4", plugins.FormatPerfData(result.PerfData))
+
+	// starting programs are a warning, reported after critical ones
+	cfg["states"] = map[string]interface{}{"starting": "warning", "BACKOFF": "critical"}
+	checker, err = NewSupervisorChecker(cfg, server.pluginConfig())
+	assert.Nilf(t, err, "supervisor checker instantiation failed: %q", err)
+
+	result = checker.Run(context.Background())
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+	assert.Equal(t, `2 services failing: `+
+		`Service "workers:worker-1" is currently BACKOFF: Exited too quickly (process log may have details); `+
+		`Service "web" is currently STARTING: Exited too quickly (process log may have details)`, result.Message)
+
+	// selecting a group
+	cfg["include"] = []string{"workers:*"}
+	cfg["states"] = map[string]interface{}{"backoff": "warning"}
+	checker, err = NewSupervisorChecker(cfg, server.pluginConfig())
+	assert.Nilf(t, err, "supervisor checker instantiation failed: %q", err)
+
+	result = checker.Run(context.Background())
+	assert.Equal(t, plugins.STATE_WARNING, result.Status)
+	assert.Equal(t, `Service "workers:worker-1" is currently BACKOFF: Exited too quickly (process log may have details)`, result.Message)
+	assert.Equal(t, "running=1;;;0;2", plugins.FormatPerfData(result.PerfData))
+
+	// service mode with group name
+	delete(cfg, "include")
+	delete(cfg, "states")
+	cfg["type"] = "service"
+	cfg["service"] = "batch:worker-1"
+	checker, err = NewSupervisorChecker(cfg, server.pluginConfig())
+	assert.Nilf(t, err, "supervisor checker instantiation failed: %q", err)
+
+	result = checker.Run(context.Background())
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+	assert.Equal(t, `Service "batch:worker-1" is running: pid 103, uptime 1h0m0s`, result.Message)
+	assert.Equal(t, "uptime=3600s;;;0", plugins.FormatPerfData(result.PerfData))
+
+	// service mode with a program name present in several groups
+	cfg["service"] = "worker-1"
+	checker, err = NewSupervisorChecker(cfg, server.pluginConfig())
+	assert.Nilf(t, err, "supervisor checker instantiation failed: %q", err)
+
+	result = checker.Run(context.Background())
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+	assert.Equal(t, `Service "workers:worker-1" is currently BACKOFF: Exited too quickly (process log may have details)`, result.Message)
+
+	// invalid configurations
+	cfg["states"] = map[string]interface{}{"crashed": "warning"}
+	_, err = NewSupervisorChecker(cfg, server.pluginConfig())
+	assert.EqualError(t, err, `supervisor/cfg: states: unknown state "crashed"`)
+
+	cfg["states"] = map[string]interface{}{"FATAL": "fatal"}
+	_, err = NewSupervisorChecker(cfg, server.pluginConfig())
+	assert.EqualError(t, err, `supervisor/cfg: states: severity of FATAL must be ok, warning, critical or unknown, not "fatal"`)
+}
@@ -0,0 +1,150 @@
+package supervisor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ochinchina/supervisord/process"
+)
+
+var methodNameRegexp = regexp.MustCompile(`<methodName>([^<]+)</methodName>`)
+
+// fakeProgram is a program managed by the fake supervisor daemon
+type fakeProgram struct {
+	name      string
+	group     string
+	state     process.ProcessState
+	pid       int
+	uptime    time.Duration
+	autostart bool
+}
+
+// fakeSupervisor answers to supervisor XML-RPC calls on a unix socket
+type fakeSupervisor struct {
+	mutex    sync.Mutex
+	programs []fakeProgram
+	// configInfo enables supervisor.getAllConfigInfo method, absent from old supervisor versions
+	configInfo bool
+	socket     string
+	server     *http.Server
+	dir        string
+}
+
+func newFakeSupervisor(t *testing.T, programs ...fakeProgram) *fakeSupervisor {
+	dir, err := ioutil.TempDir("", "jagozzi-supervisor")
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	s := &fakeSupervisor{
+		programs:   programs,
+		configInfo: true,
+		socket:     filepath.Join(dir, "supervisor.sock"),
+		dir:        dir,
+	}
+
+	listener, err := net.Listen("unix", s.socket)
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	s.server = &http.Server{Handler: http.HandlerFunc(s.serveHTTP)}
+	go s.server.Serve(listener)
+	return s
+}
+
+func (s *fakeSupervisor) Close() {
+	s.server.Close()
+	os.RemoveAll(s.dir)
+}
+
+// pluginConfig returns the plugin configuration to reach the fake supervisor
+func (s *fakeSupervisor) pluginConfig() map[string]interface{} {
+	return map[string]interface{}{
+		"serverurl": "unix://" + s.socket,
+	}
+}
+
+// setProgram replaces the state of a program
+func (s *fakeSupervisor) setProgram(program fakeProgram) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i, p := range s.programs {
+		if p.group == program.group && p.name == program.name {
+			s.programs[i] = program
+		}
+	}
+}
+
+func (s *fakeSupervisor) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := ioutil.ReadAll(req.Body)
+	method := methodNameRegexp.FindStringSubmatch(string(body))
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now().Unix()
+	var values []string
+	switch {
+	case method != nil && method[1] == "supervisor.getAllProcessInfo":
+		for _, p := range s.programs {
+			start := now - int64(p.uptime.Seconds())
+			description := fmt.Sprintf("pid %d, uptime %s", p.pid, p.uptime)
+			if p.state != process.RUNNING {
+				description = "Exited too quickly (process log may have details)"
+			}
+			values = append(values, xmlrpcStruct(map[string]string{
+				"name":        "<string>" + p.name + "</string>",
+				"group":       "<string>" + p.group + "</string>",
+				"description": "<string>" + description + "</string>",
+				"start":       fmt.Sprintf("<int>%d</int>", start),
+				"now":         fmt.Sprintf("<int>%d</int>", now),
+				"state":       fmt.Sprintf("<int>%d</int>", p.state),
+				"statename":   "<string>" + p.state.String() + "</string>",
+				"pid":         fmt.Sprintf("<int>%d</int>", p.pid),
+			}))
+		}
+	case method != nil && method[1] == "supervisor.getAllConfigInfo" && s.configInfo:
+		for _, p := range s.programs {
+			autostart := "0"
+			if p.autostart {
+				autostart = "1"
+			}
+			values = append(values, xmlrpcStruct(map[string]string{
+				"name":      "<string>" + p.name + "</string>",
+				"group":     "<string>" + p.group + "</string>",
+				"autostart": "<boolean>" + autostart + "</boolean>",
+			}))
+		}
+	default:
+		fmt.Fprint(w, `<?xml version="1.0"?><methodResponse><fault><value><struct>`+
+			`<member><name>faultCode</name><value><int>1</int></value></member>`+
+			`<member><name>faultString</name><value><string>UNKNOWN_METHOD</string></value></member>`+
+			`</struct></value></fault></methodResponse>`)
+		return
+	}
+
+	fmt.Fprintf(w, `<?xml version="1.0"?><methodResponse><params><param><value><array><data>%s</data></array></value></param></params></methodResponse>`, strings.Join(values, ""))
+}
+
+func xmlrpcStruct(members map[string]string) string {
+	var b strings.Builder
+	b.WriteString("<value><struct>")
+	for name, value := range members {
+		fmt.Fprintf(&b, "<member><name>%s</name><value>%s</value></member>", name, value)
+	}
+	b.WriteString("</struct></value>")
+	return b.String()
+}
@@ -0,0 +1,126 @@
+package supervisor
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// xmlrpcValue is a value of a XML-RPC response
+type xmlrpcValue struct {
+	Boolean *string        `xml:"boolean"`
+	String  *string        `xml:"string"`
+	Chars   string         `xml:",chardata"`
+	Struct  []xmlrpcMember `xml:"struct>member"`
+	Array   []xmlrpcValue  `xml:"array>data>value"`
+}
+
+type xmlrpcMember struct {
+	Name  string      `xml:"name"`
+	Value xmlrpcValue `xml:"value"`
+}
+
+type xmlrpcResponse struct {
+	Params []xmlrpcValue `xml:"params>param>value"`
+	Fault  *xmlrpcValue  `xml:"fault>value"`
+}
+
+// str returns the value as a string, strings can be written without type in XML-RPC
+func (v xmlrpcValue) str() string {
+	if v.String != nil {
+		return *v.String
+	}
+	return strings.TrimSpace(v.Chars)
+}
+
+// member returns the member of a struct value
+func (v xmlrpcValue) member(name string) xmlrpcValue {
+	for _, m := range v.Struct {
+		if m.Name == name {
+			return m.Value
+		}
+	}
+	return xmlrpcValue{}
+}
+
+// newTransport returns the HTTP transport used for XML-RPC calls, dialing the unix socket of supervisor daemon when
+// server URL uses unix scheme
+func newTransport(serverURL url.URL) *http.Transport {
+	transport := &http.Transport{}
+	if serverURL.Scheme == "unix" {
+		socket := serverURL.Path
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			dialer := net.Dialer{}
+			return dialer.DialContext(ctx, "unix", socket)
+		}
+	}
+	return transport
+}
+
+// call performs a XML-RPC call without parameters on supervisor daemon, for methods that xmlrpcclient library
+// doesn't provide
+func (c *SupervisorChecker) call(ctx context.Context, method string) (xmlrpcValue, error) {
+	serverURL := c.pluginCfg.ServerURL
+	target := serverURL.String() + "/RPC2"
+	if serverURL.Scheme == "unix" {
+		target = "http://unix/RPC2"
+	}
+
+	body := fmt.Sprintf(`<?xml version="1.0"?><methodCall><methodName>%s.%s</methodName><params></params></methodCall>`, c.pluginCfg.RPCNamespace, method)
+	req, err := http.NewRequest(http.MethodPost, target, bytes.NewBufferString(body))
+	if err != nil {
+		return xmlrpcValue{}, err
+	}
+	req.Header.Set("Content-Type", "text/xml")
+	if password, passwordSet := serverURL.User.Password(); passwordSet && serverURL.User.Username() != "" {
+		req.SetBasicAuth(serverURL.User.Username(), password)
+	}
+
+	if c.pluginCfg.Timeout > 0 {
+		var cancel func()
+		ctx, cancel = context.WithTimeout(ctx, c.pluginCfg.Timeout)
+		defer cancel()
+	}
+
+	resp, err := c.transport.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		return xmlrpcValue{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return xmlrpcValue{}, fmt.Errorf("%s: unexpected status %s", method, resp.Status)
+	}
+
+	res := xmlrpcResponse{}
+	if err := xml.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return xmlrpcValue{}, fmt.Errorf("%s: %s", method, err)
+	}
+	if res.Fault != nil {
+		return xmlrpcValue{}, fmt.Errorf("%s: %s", method, res.Fault.member("faultString").str())
+	}
+	if len(res.Params) == 0 {
+		return xmlrpcValue{}, fmt.Errorf("%s: empty response", method)
+	}
+	return res.Params[0], nil
+}
+
+// autostartPrograms returns the autostart option of each program, indexed by group:name
+func (c *SupervisorChecker) autostartPrograms(ctx context.Context) (map[string]bool, error) {
+	configs, err := c.call(ctx, "getAllConfigInfo")
+	if err != nil {
+		return nil, err
+	}
+
+	autostart := make(map[string]bool, len(configs.Array))
+	for _, cfg := range configs.Array {
+		key := cfg.member("group").str() + ":" + cfg.member("name").str()
+		autostart[key] = cfg.member("autostart").Boolean != nil && strings.TrimSpace(*cfg.member("autostart").Boolean) == "1"
+	}
+	return autostart, nil
+}
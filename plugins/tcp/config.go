@@ -0,0 +1,63 @@
+package tcp
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/rbeuque74/jagozzi/config"
+	validator "gopkg.in/go-playground/validator.v9"
+)
+
+type rawTCPConfig struct {
+	config.GenericPluginConfiguration
+	Host         string `json:"host" validate:"required"`
+	Send         string `json:"send"`
+	Expect       string `json:"expect"`
+	ExpectRegexp string `json:"expect_regexp"`
+	RawTimeout   int64  `json:"timeout"`
+	RawWarning   int64  `json:"warn"`
+	RawCritical  int64  `json:"crit"`
+}
+
+type tcpConfig struct {
+	rawTCPConfig
+	Timeout  time.Duration  `json:"-"`
+	Warning  time.Duration  `json:"-"`
+	Critical time.Duration  `json:"-"`
+	expect   *regexp.Regexp `json:"-"`
+}
+
+func (cfg *tcpConfig) UnmarshalJSON(b []byte) error {
+	raw := &rawTCPConfig{}
+
+	if err := config.UnmarshalConfig(b, raw); err != nil {
+		return err
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(raw); err != nil {
+		return err
+	}
+
+	if raw.Expect != "" && raw.ExpectRegexp != "" {
+		return fmt.Errorf("expect and expect_regexp keys are incompatible")
+	}
+
+	cfg.rawTCPConfig = *raw
+	cfg.Timeout = time.Duration(raw.RawTimeout) * time.Millisecond
+	cfg.Warning = time.Duration(raw.RawWarning) * time.Millisecond
+	cfg.Critical = time.Duration(raw.RawCritical) * time.Millisecond
+
+	if raw.ExpectRegexp != "" {
+		expect, err := regexp.Compile(raw.ExpectRegexp)
+		if err != nil {
+			return fmt.Errorf("expect_regexp: %s", err)
+		}
+		cfg.expect = expect
+	} else if raw.Expect != "" {
+		cfg.expect = regexp.MustCompile(regexp.QuoteMeta(raw.Expect))
+	}
+
+	return nil
+}
@@ -0,0 +1,155 @@
+package tcp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/rbeuque74/jagozzi/plugins"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	pluginName = "TCP"
+	// maxResponseSize is the amount of bytes read from the connection to match the expected response
+	maxResponseSize = 64 * 1024
+)
+
+func init() {
+	plugins.Register(pluginName, NewTCPChecker)
+}
+
+// TCPChecker is a plugin to check TCP services
+type TCPChecker struct {
+	cfg tcpConfig
+}
+
+// Name returns the name of the checker
+func (c TCPChecker) Name() string {
+	return pluginName
+}
+
+// ServiceName returns the name of the NSCA service associated to the checker
+func (c TCPChecker) ServiceName() string {
+	return c.cfg.Name
+}
+
+// Periodicity returns the delay between two checks
+func (c TCPChecker) Periodicity() *time.Duration {
+	return c.cfg.Periodicity()
+}
+
+// Run is performing the checker protocol
+func (c *TCPChecker) Run(ctx context.Context) plugins.Result {
+	if c.cfg.Timeout > 0 {
+		var cancel func()
+		ctx, cancel = context.WithTimeout(ctx, c.cfg.Timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", c.cfg.Host)
+	if err != nil {
+		return plugins.ResultFromError(c, err, fmt.Sprintf("unable to connect to %s", c.cfg.Host))
+	}
+	defer conn.Close()
+
+	elapsedTime := time.Since(start).Round(time.Millisecond)
+	perfdata := []plugins.PerfData{
+		plugins.NewPerfData("time", elapsedTime.Seconds(), "s").WithThresholds(c.cfg.Warning.Seconds(), c.cfg.Critical.Seconds()).WithMin(0),
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return plugins.ResultFromError(c, err, "")
+		}
+	}
+
+	if c.cfg.Send != "" {
+		if _, err := io.WriteString(conn, c.cfg.Send); err != nil {
+			return plugins.Result{
+				Status:   plugins.STATE_CRITICAL,
+				Message:  fmt.Sprintf("unable to send payload to %s: %s", c.cfg.Host, err),
+				Checker:  c,
+				PerfData: perfdata,
+			}
+		}
+	}
+
+	if c.cfg.expect != nil {
+		response, err := c.readResponse(conn)
+		if err != nil {
+			return plugins.Result{
+				Status:   plugins.STATE_CRITICAL,
+				Message:  fmt.Sprintf("unexpected response from %s: %s (received %q)", c.cfg.Host, err, response),
+				Checker:  c,
+				PerfData: perfdata,
+			}
+		}
+	}
+
+	if c.cfg.Critical > 0 && elapsedTime > c.cfg.Critical {
+		return plugins.Result{
+			Status:   plugins.STATE_CRITICAL,
+			Message:  fmt.Sprintf("critical timeout: connection took %s instead of %s", elapsedTime, c.cfg.Critical),
+			Checker:  c,
+			PerfData: perfdata,
+		}
+	} else if c.cfg.Warning > 0 && elapsedTime > c.cfg.Warning {
+		return plugins.Result{
+			Status:   plugins.STATE_WARNING,
+			Message:  fmt.Sprintf("timeout: connection took %s instead of %s", elapsedTime, c.cfg.Warning),
+			Checker:  c,
+			PerfData: perfdata,
+		}
+	}
+
+	return plugins.Result{
+		Status:   plugins.STATE_OK,
+		Message:  fmt.Sprintf("connected to %s - %s elapsed", c.cfg.Host, elapsedTime),
+		Checker:  c,
+		PerfData: perfdata,
+	}
+}
+
+// readResponse reads from the connection until the expected response is found
+func (c TCPChecker) readResponse(conn net.Conn) (string, error) {
+	response := make([]byte, 0, 512)
+	buf := make([]byte, 512)
+	for len(response) < maxResponseSize {
+		n, err := conn.Read(buf)
+		response = append(response, buf[:n]...)
+		if c.cfg.expect.Match(response) {
+			return string(response), nil
+		}
+		if err == io.EOF {
+			return string(response), fmt.Errorf("connection closed before expected response")
+		} else if err != nil {
+			return string(response), err
+		}
+	}
+	return string(response), fmt.Errorf("expected response not found in the first %d bytes", maxResponseSize)
+}
+
+// NewTCPChecker create a TCP checker
+func NewTCPChecker(conf interface{}, pluginConf interface{}) (plugins.Checker, error) {
+	out, err := yaml.Marshal(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := tcpConfig{}
+	err = yaml.Unmarshal(out, &cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof("tcp: Checker activated for %q", cfg.Host)
+	return &TCPChecker{
+		cfg: cfg,
+	}, nil
+}
@@ -0,0 +1,134 @@
+package tcp
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rbeuque74/jagozzi/plugins"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTCPServer starts a server that sends a banner, then answers PONG to PING lines
+func newTCPServer(t *testing.T) (string, func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				conn.Write([]byte("220 jagozzi ready\n"))
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					if strings.TrimSpace(scanner.Text()) == "PING" {
+						conn.Write([]byte("PONG\n"))
+					} else {
+						conn.Write([]byte("ERR\n"))
+					}
+				}
+			}(conn)
+		}
+	}()
+
+	return listener.Addr().String(), func() {
+		listener.Close()
+	}
+}
+
+func runChecker(t *testing.T, cfg map[string]interface{}) plugins.Result {
+	checker, err := NewTCPChecker(cfg, nil)
+	assert.Nilf(t, err, "tcp checker instantiation failed: %q", err)
+	if err != nil {
+		t.FailNow()
+	}
+
+	ctxRun, cancelFunc := context.WithTimeout(context.Background(), time.Second)
+	defer cancelFunc()
+	return checker.Run(ctxRun)
+}
+
+func TestTCP(t *testing.T) {
+	host, shutdown := newTCPServer(t)
+	defer shutdown()
+
+	cfg := map[string]interface{}{
+		"host": host,
+		"warn": 200,
+		"crit": 400,
+		"name": "test-1",
+	}
+	checker, err := NewTCPChecker(cfg, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "TCP", checker.Name())
+	assert.Equal(t, "test-1", checker.ServiceName())
+
+	result := runChecker(t, cfg)
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+	assert.Containsf(t, result.Message, "connected to "+host, "tcp bad message: %q", result.Message)
+	if assert.Len(t, result.PerfData, 1) {
+		assert.Equal(t, "time", result.PerfData[0].Label)
+		assert.Equal(t, "0.2", result.PerfData[0].Warning)
+		assert.Equal(t, "0.4", result.PerfData[0].Critical)
+	}
+
+	// banner
+	cfg["expect"] = "220 jagozzi"
+	result = runChecker(t, cfg)
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+
+	// payload and regexp
+	delete(cfg, "expect")
+	cfg["send"] = "PING\n"
+	cfg["expect_regexp"] = "(?m)^PONG$"
+	result = runChecker(t, cfg)
+	assert.Equal(t, plugins.STATE_OK, result.Status)
+
+	// unexpected response
+	cfg["send"] = "HELLO\n"
+	result = runChecker(t, cfg)
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+	assert.Containsf(t, result.Message, "unexpected response", "tcp bad message: %q", result.Message)
+
+	// incompatible configuration
+	cfg["expect"] = "PONG"
+	_, err = NewTCPChecker(cfg, nil)
+	assert.NotNil(t, err)
+}
+
+func TestTCPFails(t *testing.T) {
+	host, shutdown := newTCPServer(t)
+	shutdown()
+
+	cfg := map[string]interface{}{
+		"host": host,
+		"name": "test-1",
+	}
+	result := runChecker(t, cfg)
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+	assert.Containsf(t, result.Message, "unable to connect to "+host, "tcp bad message: %q", result.Message)
+
+	// server never answers
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+
+	cfg["host"] = listener.Addr().String()
+	cfg["expect"] = "220"
+	cfg["timeout"] = 100
+	start := time.Now()
+	result = runChecker(t, cfg)
+	assert.Equal(t, plugins.STATE_CRITICAL, result.Status)
+	assert.Containsf(t, result.Message, "timeout", "tcp bad message: %q", result.Message)
+	assert.True(t, time.Since(start) < 500*time.Millisecond)
+}
@@ -26,6 +26,13 @@ func exitSignalHandling(cancel context.CancelFunc) <-chan interface{} {
 	return exiting
 }
 
+// reloadSignalHandling returns a channel notified every time jagozzi is asked to reload its configuration
+func reloadSignalHandling() <-chan os.Signal {
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	return reload
+}
+
 func exitTimeout(ctx context.Context) {
 	<-ctx.Done()
 	after := time.After(5 * time.Second)